@@ -5,21 +5,73 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/internal/logging"
+	"github.com/felipemacedo1/go-coregit-pe/internal/metrics"
 	"github.com/felipemacedo1/go-coregit-pe/pkg/api"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/audit"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core/execgit"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/index"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/policy"
 )
 
 var version = "dev"
 
+// stringList is a flag.Value collecting repeated string flags
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func main() {
 	var (
 		addr    = flag.String("addr", "127.0.0.1:8080", "HTTP server address")
 		showVer = flag.Bool("version", false, "Show version")
+		regPath = flag.String("registry", "", "Repository registry file (default: ~/.gitmgr/registry.json)")
+		creds   = flag.String("credentials", "", "Comma-separated credential sources for remote operations: env, netrc, helper")
+		gitPath = flag.String("git", "git", "Git binary to run")
+		isolate = flag.Bool("isolate", false, "Ignore the system and global git configuration")
+		maxProc = flag.Int("max-git-processes", executil.DefaultMaxProcesses, "Maximum number of git processes running at once")
+		polPath = flag.String("policy", "", "JSON policy file with raw command profiles and caller tokens (default: read-only for everyone)")
+		traceOn = flag.Bool("trace-commands", false, "Log every git command with its exit code, duration and output size")
+		logLvl  = flag.String("log-level", "info", "Minimum log level: trace, debug, info, warn or error")
+		logJSON = flag.Bool("log-json", false, "Write logs as JSON lines")
+		trace2  = flag.Bool("trace2", false, "Capture git's trace2 events for /v1/debug/commands (one temporary file per command)")
+		audPath = flag.String("audit-log", "", "Audit log of operations modifying repositories (default: ~/.gitmgr/audit.log)")
+		noAudit = flag.Bool("no-audit", false, "Do not record operations in the audit log")
+		audSize = flag.Int64("audit-max-size", audit.DefaultMaxSize, "Size in bytes after which the audit log is rotated")
+		audKeep = flag.Int("audit-max-files", audit.DefaultMaxFiles, "Number of rotated audit log files kept")
+		undoMax = flag.Int("undo-snapshots", execgit.DefaultSnapshotLimit, "Undo snapshots kept per repository before destructive operations (0 disables them)")
+		cacheOn = flag.Bool("cache", false, "Cache branches, remotes, status and history until the repository changes")
+		cacheAt = flag.String("cache-dir", "", "Cache directory, also holding the commit index searched at /v1/search/commits (default: $XDG_CACHE_HOME/gitmgr or ~/.gitmgr/cache)")
+		cacheFs = flag.String("cache-store", "file", "Cache storage: file (a file per entry) or log (a single append-only file)")
+		memKeys = flag.Int("cache-memory-entries", index.DefaultMemoryEntries, "Entries kept in memory in front of the cache storage")
+		memSize = flag.Int64("cache-memory-bytes", index.DefaultMemoryBytes, "Bytes kept in memory in front of the cache storage (0 for both disables the memory tier)")
+		maxSize = flag.Int64("cache-max-size", index.DefaultMaxSize, "Size in bytes the cache is pruned to, evicting least recently used entries (0 for no limit)")
+		pruneIv = flag.Duration("cache-prune-interval", index.DefaultPruneInterval, "How often expired cache entries and entries of deleted repositories are removed (0 disables pruning)")
+		roots   stringList
+		passEnv stringList
+		env     stringList
+		config  stringList
 	)
+	flag.Var(&roots, "root", "Workspace root that API paths are confined to (repeatable, default: current directory)")
+	flag.Var(&passEnv, "pass-env", "Environment variable passed through to git, trailing * matches a prefix (repeatable, added to the defaults)")
+	flag.Var(&env, "env", "Extra KEY=VALUE environment variable for git (repeatable)")
+	flag.Var(&config, "git-config", "Git config override key=value passed with -c to every command (repeatable)")
 	flag.Parse()
 
 	if *showVer {
@@ -27,7 +79,121 @@ func main() {
 		return
 	}
 
-	server := api.NewServer(*addr)
+	logger := logging.NewLogger(os.Stderr, *logJSON)
+	level, err := logging.ParseLevel(*logLvl)
+	if err != nil {
+		log.Fatalf("Invalid log level: %v", err)
+	}
+	logger.SetLevel(level)
+	slog.SetDefault(slog.New(logging.NewSlogHandler(logger)))
+
+	if len(roots) == 0 {
+		roots = stringList{"."}
+	}
+
+	workspace, err := api.NewWorkspace(roots)
+	if err != nil {
+		log.Fatalf("Invalid workspace: %v", err)
+	}
+
+	rawPolicy := policy.Default()
+	if *polPath != "" {
+		rawPolicy, err = policy.Load(*polPath)
+		if err != nil {
+			log.Fatalf("Invalid policy: %v", err)
+		}
+	}
+
+	opts := []api.Option{api.WithWorkspace(workspace), api.WithPolicy(rawPolicy), api.WithLogger(logger)}
+
+	execConfig := executil.DefaultExecutorConfig()
+	execConfig.GitPath = *gitPath
+	execConfig.PassEnv = append(execConfig.PassEnv, passEnv...)
+	execConfig.Env = env
+	execConfig.Isolated = *isolate
+	execConfig.Config = config
+	execConfig.MaxProcesses = *maxProc
+	execConfig.Trace2 = *trace2
+	if err := execConfig.Validate(); err != nil {
+		log.Fatalf("Invalid git configuration: %v", err)
+	}
+	commands := executil.NewRingTracer(executil.DefaultRingSize)
+	registry := metrics.NewRegistry()
+	opts = append(opts, api.WithCommandTrace(commands), api.WithMetrics(registry))
+	gitOpts := []execgit.Option{
+		execgit.WithExecutorConfig(execConfig),
+		execgit.WithPolicy(rawPolicy),
+		execgit.WithLogger(logger),
+		execgit.WithTracer(commands),
+		execgit.WithTracer(executil.NewMetricsTracer(registry)),
+		execgit.WithSnapshotLimit(*undoMax),
+	}
+	if *traceOn {
+		gitOpts = append(gitOpts, execgit.WithTracer(executil.NewLogTracer(logger)))
+	}
+
+	if *creds != "" {
+		chain, err := execgit.NewCredentialChain(strings.Split(*creds, ","))
+		if err != nil {
+			log.Fatalf("Invalid credentials: %v", err)
+		}
+		gitOpts = append(gitOpts, execgit.WithCredentialProvider(chain))
+	}
+	opts = append(opts, api.WithGit(execgit.New(gitOpts...)))
+	if *regPath != "" {
+		registry, err := index.OpenRegistry(*regPath)
+		if err != nil {
+			log.Fatalf("Failed to open registry: %v", err)
+		}
+		opts = append(opts, api.WithRegistry(registry))
+	}
+
+	if *cacheOn {
+		cacheOpts := []index.CacheOption{index.WithMemoryLimits(*memKeys, *memSize), index.WithMaxSize(*maxSize)}
+		switch *cacheFs {
+		case "file":
+		case "log":
+			cacheOpts = append(cacheOpts, index.WithLogStore())
+		default:
+			log.Fatalf("Invalid cache store %q: must be file or log", *cacheFs)
+		}
+		var cache *index.Cache
+		if *cacheAt != "" {
+			cache, err = index.OpenCache(*cacheAt, cacheOpts...)
+		} else {
+			cache, err = index.NewCache(cacheOpts...)
+		}
+		if err != nil {
+			log.Fatalf("Failed to open cache: %v", err)
+		}
+		opts = append(opts, api.WithCache(cache), api.WithCachePruneInterval(*pruneIv))
+	}
+	if *cacheAt != "" {
+		commits, err := index.OpenCommitIndex(filepath.Join(*cacheAt, "commits"))
+		if err != nil {
+			log.Fatalf("Failed to open commit index: %v", err)
+		}
+		opts = append(opts, api.WithCommitIndex(commits))
+	}
+
+	if !*noAudit {
+		auditOpts := []audit.Option{audit.WithMaxSize(*audSize), audit.WithMaxFiles(*audKeep)}
+		var auditLog *audit.Log
+		if *audPath != "" {
+			auditLog, err = audit.OpenLog(*audPath, auditOpts...)
+		} else {
+			auditLog, err = audit.NewLog(auditOpts...)
+		}
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		opts = append(opts, api.WithAuditLog(auditLog))
+	}
+
+	server, err := api.NewServer(*addr, opts...)
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
 
 	// Handle graceful shutdown
 	go func() {
@@ -45,7 +211,7 @@ func main() {
 		os.Exit(0)
 	}()
 
-	log.Printf("Starting gitmgr HTTP API server on %s", *addr)
+	log.Printf("Starting gitmgr HTTP API server on %s (workspace roots: %s)", *addr, strings.Join(workspace.Roots(), ", "))
 	if err := server.Start(); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
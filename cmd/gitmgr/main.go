@@ -2,13 +2,19 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/user"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/felipemacedo1/go-coregit-pe/pkg/audit"
 	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
 	"github.com/felipemacedo1/go-coregit-pe/pkg/core/execgit"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/index"
 )
 
 var version = "dev"
@@ -34,6 +40,12 @@ func main() {
 		handleLogCommand()
 	case "diff":
 		handleDiffCommand()
+	case "undo":
+		handleUndoCommand()
+	case "cache":
+		handleCacheCommand()
+	case "search":
+		handleSearchCommand()
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
 		printUsage()
@@ -41,6 +53,20 @@ func main() {
 	}
 }
 
+// exitWithError prints err, and an authentication hint if git provided one, then exits
+func exitWithError(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+
+	var gitErr *core.GitError
+	if errors.As(err, &gitErr) && gitErr.Hint != nil {
+		fmt.Fprintf(os.Stderr, "Hint: %s\n", gitErr.Hint.Message)
+		if gitErr.Hint.Helper != "" {
+			fmt.Fprintf(os.Stderr, "Credential helper: %s\n", gitErr.Hint.Helper)
+		}
+	}
+	os.Exit(1)
+}
+
 func printUsage() {
 	fmt.Printf(`gitmgr - Core Git Manager v%s
 
@@ -55,6 +81,12 @@ Commands:
   status [path]   Show repository status
   log [path]      Show commit history
   diff [path]     Show changes
+  undo list [path] List snapshots saved before destructive operations
+  undo restore <id> [path] Restore a snapshot
+  cache stats     Show the number and size of cached entries
+  cache prune     Remove expired entries and entries of deleted repositories
+  cache clear [path] Remove all cached entries, or those of a repository
+  search [options] [path] Search commits by author, message, file or date
 
 More commands coming soon...
 `, version)
@@ -79,8 +111,7 @@ func handleRepoCommand() {
 		repo, err := git.Open(ctx, path)
 		cancel()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
+			exitWithError(err)
 		}
 
 		fmt.Printf("Repository opened successfully:\n")
@@ -123,8 +154,12 @@ func handleCloneCommand() {
 		}
 	}
 
-	git := execgit.New()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	git := auditedGit(execgit.New(execgit.WithCredentialProvider(execgit.ChainCredentials{
+		execgit.NewEnvCredentials(),
+		execgit.NewNetrcCredentials(""),
+		execgit.NewGitCredentialHelper(),
+	})))
+	ctx, cancel := context.WithTimeout(cliContext(), 5*time.Minute)
 	fmt.Printf("Cloning %s to %s...\n", url, path)
 	repo, err := git.Clone(ctx, core.CloneOptions{
 		URL:      url,
@@ -133,13 +168,32 @@ func handleCloneCommand() {
 	})
 	cancel()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		exitWithError(err)
 	}
 
 	fmt.Printf("Repository cloned successfully to %s\n", repo.Path)
 }
 
+// auditedGit records the operations of git modifying repositories in
+// ~/.gitmgr/audit.log. If the log cannot be opened, operations run unrecorded.
+func auditedGit(git core.CoreGit) core.CoreGit {
+	log, err := audit.NewLog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: audit log disabled: %v\n", err)
+		return git
+	}
+	return audit.NewGit(git, log, audit.SourceCLI, nil)
+}
+
+// cliContext returns a context attributing operations to the OS user
+func cliContext() context.Context {
+	ctx := context.Background()
+	if u, err := user.Current(); err == nil {
+		ctx = core.WithCaller(ctx, u.Username)
+	}
+	return ctx
+}
+
 func handleStatusCommand() {
 	path := "."
 	if len(os.Args) > 2 {
@@ -151,14 +205,12 @@ func handleStatusCommand() {
 	repo, err := git.Open(ctx, path)
 	cancel()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		exitWithError(err)
 	}
 
 	status, err := git.GetStatus(ctx, repo)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		exitWithError(err)
 	}
 
 	fmt.Printf("On branch %s\n", status.Branch)
@@ -198,15 +250,13 @@ func handleLogCommand() {
 	repo, err := git.Open(ctx, path)
 	if err != nil {
 		cancel()
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		exitWithError(err)
 	}
 
 	commits, err := git.Log(ctx, repo, "", 10, false)
 	cancel()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		exitWithError(err)
 	}
 
 	for _, commit := range commits {
@@ -232,15 +282,13 @@ func handleDiffCommand() {
 	repo, err := git.Open(ctx, path)
 	if err != nil {
 		cancel()
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		exitWithError(err)
 	}
 
 	diff, err := git.Diff(ctx, repo, "", "", true)
 	cancel()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		exitWithError(err)
 	}
 
 	if diff == "" {
@@ -249,3 +297,232 @@ func handleDiffCommand() {
 		fmt.Print(diff)
 	}
 }
+
+func handleUndoCommand() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: gitmgr undo <subcommand>\n")
+		fmt.Fprintf(os.Stderr, "Subcommands: list, restore\n")
+		os.Exit(1)
+	}
+
+	switch os.Args[2] {
+	case "list":
+		path := "."
+		if len(os.Args) > 3 {
+			path = os.Args[3]
+		}
+
+		git := execgit.New()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		repo, err := git.Open(ctx, path)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		snapshots, err := git.ListSnapshots(ctx, repo)
+		if err != nil {
+			exitWithError(err)
+		}
+		if len(snapshots) == 0 {
+			fmt.Println("No snapshots")
+			return
+		}
+		for _, snap := range snapshots {
+			fmt.Printf("%s  %-14s %s\n", snap.ID, snap.Operation, snap.Time.Local().Format(time.RFC1123))
+			if snap.Head != "" {
+				fmt.Printf("    HEAD %s\n", snap.Head)
+			}
+			for ref, commit := range snap.Refs {
+				fmt.Printf("    %s %s\n", ref, commit)
+			}
+			if snap.Stash != "" {
+				fmt.Printf("    uncommitted changes %s\n", snap.Stash)
+			}
+		}
+	case "restore":
+		if len(os.Args) < 4 {
+			fmt.Fprintf(os.Stderr, "Usage: gitmgr undo restore <id> [path]\n")
+			os.Exit(1)
+		}
+		id := os.Args[3]
+		path := "."
+		if len(os.Args) > 4 {
+			path = os.Args[4]
+		}
+
+		git := auditedGit(execgit.New())
+		ctx, cancel := context.WithTimeout(cliContext(), 2*time.Minute)
+		defer cancel()
+		repo, err := git.Open(ctx, path)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if err := git.RestoreSnapshot(ctx, repo, id); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Snapshot %s restored\n", id)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown undo subcommand: %s\n", os.Args[2])
+		os.Exit(1)
+	}
+}
+
+// openCaches opens the caches in the default cache directory: the entry
+// files, and the log store if the server was run with -cache-store log
+func openCaches() (string, []*index.Cache) {
+	dir, err := index.DefaultCacheDir()
+	if err != nil {
+		exitWithError(err)
+	}
+	cache, err := index.OpenCache(dir, index.WithMemoryLimits(0, 0))
+	if err != nil {
+		exitWithError(err)
+	}
+	caches := []*index.Cache{cache}
+
+	if _, err := os.Stat(filepath.Join(dir, "cache.log")); err == nil {
+		cache, err := index.OpenCache(dir, index.WithLogStore(), index.WithMemoryLimits(0, 0))
+		if err != nil {
+			exitWithError(err)
+		}
+		caches = append(caches, cache)
+	}
+	return dir, caches
+}
+
+func handleCacheCommand() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: gitmgr cache <subcommand>\n")
+		fmt.Fprintf(os.Stderr, "Subcommands: stats, prune, clear\n")
+		os.Exit(1)
+	}
+
+	dir, caches := openCaches()
+	switch os.Args[2] {
+	case "stats":
+		var entries int
+		var bytes int64
+		for _, cache := range caches {
+			stats := cache.Stats()
+			entries += stats.Entries
+			bytes += stats.Bytes
+		}
+		fmt.Printf("Cache directory: %s\n", dir)
+		fmt.Printf("Entries: %d\n", entries)
+		fmt.Printf("Size: %d bytes\n", bytes)
+	case "prune":
+		removed := 0
+		for _, cache := range caches {
+			n, err := cache.Prune()
+			removed += n
+			if err != nil {
+				exitWithError(err)
+			}
+		}
+		fmt.Printf("Removed %d entries\n", removed)
+	case "clear":
+		if len(os.Args) < 4 {
+			for _, cache := range caches {
+				if err := cache.ClearAll(); err != nil {
+					exitWithError(err)
+				}
+			}
+			fmt.Println("Cache cleared")
+			return
+		}
+
+		// Entries are stored under the root of the repository, which an
+		// existing repository resolves to
+		path, err := filepath.Abs(os.Args[3])
+		if err != nil {
+			exitWithError(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if repo, err := execgit.New().Open(ctx, path); err == nil {
+			path = index.CachePath(repo)
+		}
+		cancel()
+		for _, cache := range caches {
+			if err := cache.Clear(path); err != nil {
+				exitWithError(err)
+			}
+		}
+		fmt.Printf("Cache of %s cleared\n", path)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown cache subcommand: %s\n", os.Args[2])
+		os.Exit(1)
+	}
+}
+
+func handleSearchCommand() {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gitmgr search [options] [path]\n")
+		fs.PrintDefaults()
+	}
+	author := fs.String("author", "", "Substring of the author name or email")
+	message := fs.String("message", "", "Substring of the commit message")
+	file := fs.String("file", "", "File the commit changed, or a directory containing it")
+	since := fs.String("since", "", "Oldest author date (YYYY-MM-DD or RFC 3339)")
+	until := fs.String("until", "", "Author date commits must precede (YYYY-MM-DD or RFC 3339)")
+	limit := fs.Int("n", 20, "Maximum number of commits (0 for all)")
+	_ = fs.Parse(os.Args[2:])
+
+	query := index.CommitQuery{Author: *author, Message: *message, Path: *file, Limit: *limit}
+	for name, value := range map[string]string{"since": *since, "until": *until} {
+		if value == "" {
+			continue
+		}
+		t, err := parseDate(value)
+		if err != nil {
+			exitWithError(fmt.Errorf("invalid -%s: %w", name, err))
+		}
+		if name == "since" {
+			query.Since = t
+		} else {
+			query.Until = t
+		}
+	}
+
+	path := "."
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	commits, err := index.NewCommitIndex()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	git := execgit.New()
+	// Indexing a large repository for the first time reads its whole history
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	repo, err := git.Open(ctx, path)
+	if err != nil {
+		cancel()
+		exitWithError(err)
+	}
+	_, err = commits.Update(ctx, git, repo)
+	cancel()
+	if err != nil {
+		exitWithError(err)
+	}
+
+	results, err := commits.Search(repo.Path, query)
+	if err != nil {
+		exitWithError(err)
+	}
+	for _, commit := range results {
+		fmt.Printf("%s %s %-20s %s\n", commit.ShortHash, commit.Date.Format("2006-01-02"), commit.Author, commit.Subject)
+	}
+}
+
+// parseDate parses a date given as YYYY-MM-DD in local time or as an RFC 3339 time
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
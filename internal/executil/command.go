@@ -0,0 +1,284 @@
+package executil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// Command builds the arguments of a git command as
+//
+//	git <subcommand> <options> <revisions> -- <operands> <paths>
+//
+// Revisions come before "--" so commands like checkout and log do not take
+// them for paths; everything after "--" can never be parsed as an option.
+// Values are validated as they are added and the first invalid one makes
+// Build fail, so nothing is ever silently dropped.
+type Command struct {
+	name       string
+	options    []string
+	revs       []string
+	operands   []string
+	paths      []string
+	noDashDash bool
+	err        error
+}
+
+// NewCommand starts a command for a git subcommand, e.g. "fetch" or "remote add"
+func NewCommand(subcommand string) *Command {
+	return &Command{name: subcommand}
+}
+
+// flagPattern matches option names such as "-v", "--prune" or "--no-ff"
+var flagPattern = regexp.MustCompile(`^--?[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+// Flag adds an option without a value, e.g. "--prune"
+func (c *Command) Flag(flag string) *Command {
+	if !flagPattern.MatchString(flag) {
+		c.fail("invalid option %q", flag)
+		return c
+	}
+	c.options = append(c.options, flag)
+	return c
+}
+
+// FlagIf adds flag when cond is true
+func (c *Command) FlagIf(cond bool, flag string) *Command {
+	if cond {
+		c.Flag(flag)
+	}
+	return c
+}
+
+// Option adds an option with a value. Long options are joined as
+// "--name=value" and short ones passed as two arguments, so the value is
+// never parsed as an option of its own.
+func (c *Command) Option(flag, value string) *Command {
+	if !flagPattern.MatchString(flag) {
+		c.fail("invalid option %q", flag)
+		return c
+	}
+	if err := checkText(value); err != nil {
+		c.fail("invalid value for %s: %v", flag, err)
+		return c
+	}
+	if strings.HasPrefix(flag, "--") {
+		c.options = append(c.options, flag+"="+value)
+	} else {
+		c.options = append(c.options, flag, value)
+	}
+	return c
+}
+
+// Arg adds an operand such as a remote name, config key or path to clone into.
+// Operands must not start with "-", even though they follow "--", so they
+// stay safe for commands that do not honor the separator.
+func (c *Command) Arg(arg string) *Command {
+	if err := checkOperand(arg); err != nil {
+		c.fail("invalid argument %q: %v", arg, err)
+		return c
+	}
+	c.operands = append(c.operands, arg)
+	return c
+}
+
+// Value adds a free-form operand such as a config value, which may start with "-"
+func (c *Command) Value(value string) *Command {
+	if err := checkText(value); err != nil {
+		c.fail("invalid value %q: %v", value, err)
+		return c
+	}
+	c.operands = append(c.operands, value)
+	return c
+}
+
+// Rev adds a revision such as "main", "HEAD~1" or "a..b"
+func (c *Command) Rev(rev string) *Command {
+	if err := checkOperand(rev); err != nil {
+		c.fail("invalid revision %q: %v", rev, err)
+		return c
+	}
+	c.revs = append(c.revs, rev)
+	return c
+}
+
+// Branch adds a branch name operand, validated like git check-ref-format --branch
+func (c *Command) Branch(name string) *Command {
+	if err := ValidateBranchName(name); err != nil {
+		c.err = firstError(c.err, err)
+		return c
+	}
+	c.operands = append(c.operands, name)
+	return c
+}
+
+// BranchOption adds an option whose value is a branch name, e.g. "-b"
+func (c *Command) BranchOption(flag, name string) *Command {
+	if err := ValidateBranchName(name); err != nil {
+		c.err = firstError(c.err, err)
+		return c
+	}
+	return c.Option(flag, name)
+}
+
+// URL adds a repository URL or remote name. Option-like URLs and transports
+// that run commands, such as ext::, are rejected.
+func (c *Command) URL(url string) *Command {
+	if err := ValidateURL(url); err != nil {
+		c.err = firstError(c.err, err)
+		return c
+	}
+	c.operands = append(c.operands, url)
+	return c
+}
+
+// Paths adds pathspecs, which may start with "-" as they follow "--"
+func (c *Command) Paths(paths ...string) *Command {
+	for _, path := range paths {
+		if err := checkText(path); err != nil || path == "" {
+			c.fail("invalid path %q", path)
+			return c
+		}
+	}
+	c.paths = append(c.paths, paths...)
+	return c
+}
+
+// NoDashDash omits the "--" separator for commands that print it, such as
+// rev-parse. Operands are still validated, so they cannot be taken for options.
+func (c *Command) NoDashDash() *Command {
+	c.noDashDash = true
+	return c
+}
+
+// Build returns the command line, or the first validation error
+func (c *Command) Build() ([]string, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if len(c.paths) > 0 && c.noDashDash {
+		return nil, invalid("paths require the -- separator")
+	}
+
+	args := strings.Fields(c.name)
+	args = append(args, c.options...)
+	args = append(args, c.revs...)
+	if !c.noDashDash {
+		args = append(args, "--")
+	}
+	args = append(args, c.operands...)
+	return append(args, c.paths...), nil
+}
+
+// fail records the first validation error
+func (c *Command) fail(format string, args ...interface{}) {
+	c.err = firstError(c.err, invalid(fmt.Sprintf(format, args...)))
+}
+
+// firstError keeps an already recorded error over err
+func firstError(existing, err error) error {
+	if existing != nil {
+		return existing
+	}
+	return err
+}
+
+// invalid returns an invalid argument error
+func invalid(message string) error {
+	return &core.GitError{Kind: core.ErrInvalidArgument, Message: message}
+}
+
+// checkText rejects values git cannot receive intact
+func checkText(s string) error {
+	if strings.ContainsRune(s, 0) {
+		return fmt.Errorf("contains a NUL byte")
+	}
+	return nil
+}
+
+// checkOperand rejects empty and option-like operands
+func checkOperand(s string) error {
+	if s == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	if strings.HasPrefix(s, "-") {
+		return fmt.Errorf("must not start with '-'")
+	}
+	if strings.ContainsAny(s, "\x00\n\r") {
+		return fmt.Errorf("contains control characters")
+	}
+	return nil
+}
+
+// ValidateURL checks that url is safe to pass to clone, fetch or remote add
+func ValidateURL(url string) error {
+	if err := checkOperand(url); err != nil {
+		return invalid(fmt.Sprintf("invalid URL %q: %v", url, err))
+	}
+	lower := strings.ToLower(url)
+	for _, prefix := range []string{"ext::", "fd::"} {
+		if strings.HasPrefix(lower, prefix) {
+			return invalid(fmt.Sprintf("invalid URL %q: %s transport is not allowed", url, strings.TrimSuffix(prefix, "::")))
+		}
+	}
+	return nil
+}
+
+// ValidateRefName checks a full reference name such as "refs/heads/main"
+// against the rules of git check-ref-format
+func ValidateRefName(name string) error {
+	if err := checkRefName(name); err != nil {
+		return invalid(fmt.Sprintf("invalid reference name %q: %v", name, err))
+	}
+	return nil
+}
+
+// ValidateBranchName checks a branch name like git check-ref-format --branch
+func ValidateBranchName(name string) error {
+	if strings.HasPrefix(name, "-") {
+		return invalid(fmt.Sprintf("invalid branch name %q: must not start with '-'", name))
+	}
+	if name == "HEAD" {
+		return invalid(fmt.Sprintf("invalid branch name %q: HEAD is reserved", name))
+	}
+	if err := checkRefName("refs/heads/" + name); err != nil {
+		return invalid(fmt.Sprintf("invalid branch name %q: %v", name, err))
+	}
+	return nil
+}
+
+// checkRefName implements the rules of git check-ref-format
+func checkRefName(name string) error {
+	switch {
+	case name == "" || name == "@":
+		return fmt.Errorf("must not be empty or '@'")
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/"):
+		return fmt.Errorf("must not start or end with '/'")
+	case strings.HasSuffix(name, "."):
+		return fmt.Errorf("must not end with '.'")
+	case strings.Contains(name, "//"):
+		return fmt.Errorf("must not contain consecutive slashes")
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("must not contain '..'")
+	case strings.Contains(name, "@{"):
+		return fmt.Errorf("must not contain '@{'")
+	}
+
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return fmt.Errorf("must not contain %q", r)
+		}
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") {
+			return fmt.Errorf("components must not start with '.'")
+		}
+		if strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("components must not end with '.lock'")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package executil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+func TestCommandBuild(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmd      *Command
+		expected []string
+	}{
+		{
+			name:     "options before separator",
+			cmd:      NewCommand("fetch").Flag("--prune").URL("origin"),
+			expected: []string{"fetch", "--prune", "--", "origin"},
+		},
+		{
+			name:     "long option value joined",
+			cmd:      NewCommand("clone").Option("--branch", "main").Option("--depth", "1").URL("https://example.com/r.git").Arg("/tmp/r"),
+			expected: []string{"clone", "--branch=main", "--depth=1", "--", "https://example.com/r.git", "/tmp/r"},
+		},
+		{
+			name:     "short option value separate",
+			cmd:      NewCommand("log").Option("-n", "5").Rev("HEAD~1"),
+			expected: []string{"log", "-n", "5", "HEAD~1", "--"},
+		},
+		{
+			name:     "shell metacharacters preserved",
+			cmd:      NewCommand("config").Arg("user.name").Value("a; b | c & $d"),
+			expected: []string{"config", "--", "user.name", "a; b | c & $d"},
+		},
+		{
+			name:     "value may start with dash",
+			cmd:      NewCommand("config").Arg("core.pager").Value("-R"),
+			expected: []string{"config", "--", "core.pager", "-R"},
+		},
+		{
+			name:     "paths after separator",
+			cmd:      NewCommand("sparse-checkout set").Paths("docs", "-odd"),
+			expected: []string{"sparse-checkout", "set", "--", "docs", "-odd"},
+		},
+		{
+			name:     "no separator",
+			cmd:      NewCommand("rev-parse").Flag("--verify").Rev("main^{commit}").NoDashDash(),
+			expected: []string{"rev-parse", "--verify", "main^{commit}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := tt.cmd.Build()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, args)
+			}
+		})
+	}
+}
+
+func TestCommandBuild_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *Command
+	}{
+		{"option injection in URL", NewCommand("clone").URL("--upload-pack=touch /tmp/pwned")},
+		{"ext transport", NewCommand("clone").URL("ext::sh -c touch% /tmp/pwned")},
+		{"fd transport", NewCommand("fetch").URL("FD::3")},
+		{"revision starting with dash", NewCommand("log").Rev("--output=/tmp/x")},
+		{"argument starting with dash", NewCommand("remote remove").Arg("-v")},
+		{"empty argument", NewCommand("remote remove").Arg("")},
+		{"invalid branch", NewCommand("branch").Branch("feature..x")},
+		{"branch option starting with dash", NewCommand("checkout").BranchOption("-b", "-f")},
+		{"malformed flag", NewCommand("status").Flag("porcelain")},
+		{"NUL in value", NewCommand("config").Arg("user.name").Value("a\x00b")},
+		{"paths without separator", NewCommand("rev-parse").Paths("a").NoDashDash()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := tt.cmd.Build()
+			if err == nil {
+				t.Fatalf("Expected error, got args %q", args)
+			}
+			if !errors.Is(err, core.ErrInvalidArgument) {
+				t.Errorf("Expected invalid argument error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateRefName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"refs/heads/main", true},
+		{"refs/heads/feature/x-1", true},
+		{"refs/tags/v1.0.0", true},
+		{"refs/heads/a..b", false},
+		{"refs/heads/.hidden", false},
+		{"refs/heads/x.lock", false},
+		{"refs/heads/x.", false},
+		{"refs/heads//x", false},
+		{"refs/heads/x/", false},
+		{"refs/heads/a b", false},
+		{"refs/heads/a~1", false},
+		{"refs/heads/a^", false},
+		{"refs/heads/a:b", false},
+		{"refs/heads/a?", false},
+		{"refs/heads/a*", false},
+		{"refs/heads/a[b", false},
+		{"refs/heads/a\\b", false},
+		{"refs/heads/a@{1}", false},
+		{"@", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRefName(tt.name)
+			if tt.valid && err != nil {
+				t.Errorf("Expected %q to be valid, got %v", tt.name, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Expected %q to be invalid", tt.name)
+			}
+		})
+	}
+}
+
+func TestValidateBranchName(t *testing.T) {
+	for _, name := range []string{"main", "feature/login", "release-1.2"} {
+		if err := ValidateBranchName(name); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"-f", "HEAD", "a..b", "topic.lock", ""} {
+		if err := ValidateBranchName(name); err == nil {
+			t.Errorf("Expected %q to be invalid", name)
+		}
+	}
+}
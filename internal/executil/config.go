@@ -0,0 +1,198 @@
+package executil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// ExecutorConfig configures how git processes are started
+type ExecutorConfig struct {
+	// GitPath is the git binary, either a path or a name looked up in PATH
+	GitPath string
+	// Path is the PATH of the git process; empty means a minimal system PATH
+	Path []string
+	// PassEnv names variables copied from the parent environment.
+	// A trailing "*" matches a prefix, e.g. "GIT_TRACE*".
+	PassEnv []string
+	// Env holds extra KEY=VALUE variables for the git process
+	Env []string
+	// Isolated ignores the system and global git configuration
+	Isolated bool
+	// Config holds key=value settings passed to every command with -c
+	Config []string
+	// Timeout bounds commands whose context has no deadline
+	Timeout time.Duration
+	// MaxProcesses limits how many git processes run at once; further
+	// commands wait for a slot
+	MaxProcesses int
+	// KillGrace is how long a cancelled git process group may take to exit
+	// after SIGTERM before it is killed
+	KillGrace time.Duration
+	// MaxOutput caps the bytes of stdout kept in memory; the rest is discarded
+	// and the result marked as truncated
+	MaxOutput int
+	// Trace2 captures git's GIT_TRACE2_EVENT output and hands it to tracers
+	// in CommandTrace.Trace2. It costs a temporary file per command.
+	Trace2 bool
+}
+
+// Defaults used when the corresponding ExecutorConfig fields are not set
+const (
+	DefaultMaxProcesses = 16
+	DefaultKillGrace    = 5 * time.Second
+	DefaultMaxOutput    = 64 << 20
+)
+
+// maxStderr caps the bytes of stderr kept in memory
+const maxStderr = 1 << 20
+
+// DefaultPassEnv lists the variables git needs for user configuration,
+// ssh-agent and proxies
+var DefaultPassEnv = []string{
+	"HOME",
+	"USER",
+	"XDG_CONFIG_HOME",
+	"GIT_CONFIG_GLOBAL",
+	"GIT_CONFIG_SYSTEM",
+	"GIT_CONFIG_NOSYSTEM",
+	"SSH_AUTH_SOCK",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"ALL_PROXY",
+	"http_proxy",
+	"https_proxy",
+	"no_proxy",
+	"all_proxy",
+	"SSL_CERT_FILE",
+	"SSL_CERT_DIR",
+}
+
+// DefaultExecutorConfig returns the configuration used by NewGitExecutor
+func DefaultExecutorConfig() ExecutorConfig {
+	return ExecutorConfig{
+		GitPath:      "git",
+		PassEnv:      append([]string(nil), DefaultPassEnv...),
+		Timeout:      2 * time.Minute,
+		MaxProcesses: DefaultMaxProcesses,
+		KillGrace:    DefaultKillGrace,
+		MaxOutput:    DefaultMaxOutput,
+	}
+}
+
+// Validate checks that the git binary exists and settings are well-formed
+func (c ExecutorConfig) Validate() error {
+	if c.GitPath != "" {
+		if _, err := exec.LookPath(c.GitPath); err != nil {
+			return fmt.Errorf("git binary not found: %w", err)
+		}
+	}
+	for _, kv := range c.Env {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			return fmt.Errorf("invalid environment variable %q: expected KEY=VALUE", kv)
+		}
+	}
+	for _, kv := range c.Config {
+		if err := validateConfigOverride(kv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateConfigOverride checks a key=value git configuration override
+func validateConfigOverride(kv string) error {
+	key, _, ok := strings.Cut(kv, "=")
+	if !ok || key == "" || strings.HasPrefix(key, "-") || !strings.Contains(key, ".") {
+		return fmt.Errorf("invalid git config override %q: expected section.key=value", kv)
+	}
+	return nil
+}
+
+// environment builds the environment of a git process, adding extra to the
+// configured variables. Settings the executor relies on come last so they
+// cannot be overridden.
+func (c ExecutorConfig) environment(extra ...string) []string {
+	path := getSecurePath()
+	if len(c.Path) > 0 {
+		path = strings.Join(c.Path, string(os.PathListSeparator))
+	}
+
+	var env []string
+	for _, name := range c.PassEnv {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			for _, kv := range os.Environ() {
+				if strings.HasPrefix(kv, prefix) {
+					env = append(env, kv)
+				}
+			}
+			continue
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+
+	if c.Isolated {
+		env = append(env, "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull)
+	}
+	env = append(env, c.Env...)
+	env = append(env, extra...)
+
+	return append(env,
+		"GIT_TERMINAL_PROMPT=0",
+		"LC_ALL=C",
+		"PATH="+path,
+	)
+}
+
+// isolationEnv returns the variables isolating git from the global
+// configuration that GIT_CONFIG_GLOBAL cannot: git before 2.32 ignores it, so
+// HOME and XDG_CONFIG_HOME point to an empty directory instead
+func (e *GitExecutor) isolationEnv(ctx context.Context) ([]string, error) {
+	if !e.config.Isolated || e.supports(ctx, core.FeatureConfigGlobalEnv) {
+		return nil, nil
+	}
+
+	e.homeMu.Lock()
+	defer e.homeMu.Unlock()
+	if e.emptyHome == "" {
+		home, err := os.MkdirTemp("", "gitmgr-home-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create isolated home directory: %w", err)
+		}
+		e.emptyHome = home
+	}
+	return []string{"HOME=" + e.emptyHome, "XDG_CONFIG_HOME=" + e.emptyHome}, nil
+}
+
+// configOverridesKey is the context key for WithConfigOverrides
+type configOverridesKey struct{}
+
+// WithConfigOverrides returns a context that makes Run pass the given
+// key=value settings to git with -c, in addition to the executor's Config
+func WithConfigOverrides(ctx context.Context, overrides ...string) context.Context {
+	existing, _ := ctx.Value(configOverridesKey{}).([]string)
+	merged := append(append([]string(nil), existing...), overrides...)
+	return context.WithValue(ctx, configOverridesKey{}, merged)
+}
+
+// configArgs returns the -c arguments for the executor and ctx overrides
+func (c ExecutorConfig) configArgs(ctx context.Context) ([]string, error) {
+	overrides, _ := ctx.Value(configOverridesKey{}).([]string)
+
+	var args []string
+	for _, kv := range append(append([]string(nil), c.Config...), overrides...) {
+		if err := validateConfigOverride(kv); err != nil {
+			return nil, err
+		}
+		args = append(args, "-c", kv)
+	}
+	return args, nil
+}
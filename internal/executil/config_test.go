@@ -0,0 +1,94 @@
+package executil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecutorConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ExecutorConfig
+		wantErr bool
+	}{
+		{"defaults", DefaultExecutorConfig(), false},
+		{"missing git", ExecutorConfig{GitPath: "/nonexistent/git"}, true},
+		{"valid overrides", ExecutorConfig{Config: []string{"core.autocrlf=false"}, Env: []string{"FOO=bar"}}, false},
+		{"override without value", ExecutorConfig{Config: []string{"core.autocrlf"}}, true},
+		{"override without section", ExecutorConfig{Config: []string{"autocrlf=false"}}, true},
+		{"option as override", ExecutorConfig{Config: []string{"--upload-pack=evil"}}, true},
+		{"env without value", ExecutorConfig{Env: []string{"FOO"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error: %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestExecutorConfigEnvironment(t *testing.T) {
+	t.Setenv("GITMGR_TEST_ONE", "1")
+	t.Setenv("GITMGR_TEST_TWO", "2")
+	t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+
+	config := DefaultExecutorConfig()
+	config.PassEnv = append(config.PassEnv, "GITMGR_TEST_*")
+	config.Env = []string{"EXTRA=yes", "LC_ALL=de_DE.UTF-8"}
+	config.Isolated = true
+
+	env := strings.Join(config.environment(), "\n") + "\n"
+	for _, expected := range []string{
+		"SSH_AUTH_SOCK=/tmp/agent.sock\n",
+		"GITMGR_TEST_ONE=1\n",
+		"GITMGR_TEST_TWO=2\n",
+		"EXTRA=yes\n",
+		"GIT_CONFIG_NOSYSTEM=1\n",
+		"GIT_CONFIG_GLOBAL=" + os.DevNull + "\n",
+	} {
+		if !strings.Contains(env, expected) {
+			t.Errorf("Expected %q in environment:\n%s", expected, env)
+		}
+	}
+
+	// Variables the executor relies on are appended last and win
+	if !strings.HasSuffix(env, "GIT_TERMINAL_PROMPT=0\nLC_ALL=C\nPATH="+getSecurePath()+"\n") {
+		t.Errorf("Expected executor settings last:\n%s", env)
+	}
+}
+
+func TestRunConfigOverridesAndIsolation(t *testing.T) {
+	home := t.TempDir()
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[gitmgr]\n\tglobal = yes\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("GIT_CONFIG_GLOBAL", "")
+	os.Unsetenv("GIT_CONFIG_GLOBAL")
+
+	config := DefaultExecutorConfig()
+	config.Config = []string{"gitmgr.executor=yes"}
+	executor := NewGitExecutorWithConfig(config)
+	ctx := WithConfigOverrides(context.Background(), "gitmgr.call=yes")
+
+	for _, key := range []string{"gitmgr.global", "gitmgr.executor", "gitmgr.call"} {
+		result, err := executor.Run(ctx, home, []string{"config", "--get", key})
+		if err != nil || result.ExitCode != 0 || strings.TrimSpace(result.Stdout) != "yes" {
+			t.Errorf("Expected %s=yes, got %+v, %v", key, result, err)
+		}
+	}
+
+	config.Isolated = true
+	isolated := NewGitExecutorWithConfig(config)
+	result, err := isolated.Run(ctx, home, []string{"config", "--get", "gitmgr.global"})
+	if err != nil || result.ExitCode == 0 {
+		t.Errorf("Expected global config to be ignored when isolated, got %+v, %v", result, err)
+	}
+}
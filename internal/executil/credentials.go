@@ -0,0 +1,66 @@
+package executil
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// Environment variables through which credentials reach the git process
+const (
+	credentialUsernameEnv = "GITMGR_CREDENTIAL_USERNAME"
+	credentialPasswordEnv = "GITMGR_CREDENTIAL_PASSWORD"
+)
+
+// credentialHelper is an inline credential helper that answers git's "get"
+// requests from the environment, so secrets never appear in arguments.
+// printf prints the values as they are, unlike echo.
+const credentialHelper = `!f() { test "$1" = get || exit 0; ` +
+	`test -n "$` + credentialUsernameEnv + `" && printf '%s\n' "username=$` + credentialUsernameEnv + `"; ` +
+	`printf '%s\n' "password=$` + credentialPasswordEnv + `"; }; f`
+
+// credentialArgs returns the git config arguments and environment that make
+// git authenticate with cred
+func credentialArgs(cred *core.Credential) (configArgs, env []string) {
+	// The helper only answers for the host of cred.URL, so the password does
+	// not reach submodule hosts, redirect targets or rewritten URLs
+	key, scoped := "credential.helper", true
+	if cred.URL != "" {
+		var scope string
+		scope, scoped = credentialScope(cred.URL)
+		key = "credential." + scope + ".helper"
+	}
+	if cred.Password != "" && scoped {
+		// An empty helper resets helpers from the git configuration
+		configArgs = append(configArgs,
+			"-c", "credential.helper=",
+			"-c", key+"="+credentialHelper,
+		)
+		env = append(env,
+			credentialUsernameEnv+"="+cred.Username,
+			credentialPasswordEnv+"="+cred.Password,
+		)
+	}
+
+	if cred.SSHKeyFile != "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -i "+shellQuote(cred.SSHKeyFile)+" -o IdentitiesOnly=yes -o BatchMode=yes")
+	}
+
+	return configArgs, env
+}
+
+// credentialScope returns the scheme://host[:port] of remoteURL that
+// credential.<url>.* settings match, and false if remoteURL has none
+func credentialScope(remoteURL string) (string, bool) {
+	u, err := url.Parse(remoteURL)
+	if err != nil || u.Scheme == "" || u.Host == "" || strings.ContainsAny(u.Host, "=\"\\ \t") {
+		return "", false
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), true
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,94 @@
+package executil
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+func TestCredentialArgs(t *testing.T) {
+	cred := &core.Credential{Username: "user", Password: "s3cret", SSHKeyFile: "/keys/it's"}
+	configArgs, env := credentialArgs(cred)
+
+	for _, arg := range configArgs {
+		if strings.Contains(arg, "s3cret") {
+			t.Errorf("Secret leaked into arguments: %q", arg)
+		}
+	}
+
+	expected := "GIT_SSH_COMMAND=ssh -i '/keys/it'\\''s' -o IdentitiesOnly=yes -o BatchMode=yes"
+	found := false
+	for _, v := range env {
+		found = found || v == expected
+	}
+	if !found {
+		t.Errorf("Expected %q in env, got %v", expected, env)
+	}
+}
+
+func TestCredentialHelperAnswersGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	// printf keeps values that echo would take for options or escapes
+	password := `-n s3cret\c`
+	configArgs, env := credentialArgs(&core.Credential{Username: "user", Password: password, URL: "https://example.com/repo.git"})
+
+	fill := func(request string) (string, error) {
+		args := append(append([]string{}, configArgs...), "credential", "fill")
+		cmd := exec.Command("git", args...)
+		cmd.Env = append([]string{"PATH=" + getSecurePath(), "GIT_TERMINAL_PROMPT=0"}, env...)
+		cmd.Stdin = strings.NewReader(request)
+		output, err := cmd.Output()
+		return string(output), err
+	}
+
+	output, err := fill("protocol=https\nhost=example.com\n\n")
+	if err != nil {
+		t.Fatalf("git credential fill failed: %v", err)
+	}
+	for _, line := range []string{"username=user", "password=" + password} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected %q in output, got %q", line, output)
+		}
+	}
+
+	// Other hosts and schemes, e.g. of submodules or redirects, get nothing
+	for _, request := range []string{
+		"protocol=https\nhost=evil.example.com\n\n",
+		"protocol=http\nhost=example.com\n\n",
+	} {
+		if output, _ := fill(request); strings.Contains(output, "s3cret") {
+			t.Errorf("Expected no password for %q, got %q", request, output)
+		}
+	}
+}
+
+func TestCredentialArgsScope(t *testing.T) {
+	tests := []struct {
+		url string
+		key string // Empty if the password is not passed
+	}{
+		{"", "credential.helper="},
+		{"https://GitHub.com/user/repo.git", "credential.https://github.com.helper="},
+		{"https://user@example.com:8443/repo.git", "credential.https://example.com:8443.helper="},
+		{"git@github.com:user/repo.git", ""},
+		{"/local/repo", ""},
+	}
+	for _, tt := range tests {
+		configArgs, env := credentialArgs(&core.Credential{Password: "s3cret", URL: tt.url})
+		key := ""
+		if len(configArgs) == 4 {
+			key, _, _ = strings.Cut(configArgs[3], "=")
+			key += "="
+		}
+		if key != tt.key {
+			t.Errorf("Expected helper key %q for %q, got %q", tt.key, tt.url, key)
+		}
+		if tt.key == "" && len(env) != 0 {
+			t.Errorf("Expected no credential environment for %q, got %v", tt.url, env)
+		}
+	}
+}
@@ -1,74 +1,232 @@
 package executil
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os/exec"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
 )
 
 // GitExecutor handles secure execution of git commands
 type GitExecutor struct {
 	timeout time.Duration
+	config  ExecutorConfig
+	capsMu  sync.Mutex
+	caps    *core.Capabilities
+	slots   chan struct{}
+
+	homeMu    sync.Mutex
+	emptyHome string
+
+	tracerMu sync.RWMutex
+	tracers  []Tracer
+	traceIDs atomic.Uint64
 }
 
 // NewGitExecutor creates a new GitExecutor with default timeout
 func NewGitExecutor() *GitExecutor {
+	return NewGitExecutorWithConfig(DefaultExecutorConfig())
+}
+
+// NewGitExecutorWithConfig creates a GitExecutor with the given configuration.
+// Call config.Validate first to report configuration errors early.
+func NewGitExecutorWithConfig(config ExecutorConfig) *GitExecutor {
+	if config.GitPath == "" {
+		config.GitPath = "git"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Minute
+	}
+	if config.MaxProcesses <= 0 {
+		config.MaxProcesses = DefaultMaxProcesses
+	}
+	if config.KillGrace <= 0 {
+		config.KillGrace = DefaultKillGrace
+	}
+	if config.MaxOutput <= 0 {
+		config.MaxOutput = DefaultMaxOutput
+	}
 	return &GitExecutor{
-		timeout: 2 * time.Minute,
+		timeout: config.Timeout,
+		config:  config,
+		slots:   make(chan struct{}, config.MaxProcesses),
 	}
 }
 
-// SetTimeout configures the default timeout for git commands
+// SetTimeout configures the timeout of git commands whose context has no deadline
 func (e *GitExecutor) SetTimeout(timeout time.Duration) {
 	e.timeout = timeout
 }
 
 // ExecResult contains the result of command execution
 type ExecResult struct {
-	ExitCode int
-	Stdout   string
-	Stderr   string
-	Duration time.Duration
+	ExitCode  int
+	Stdout    string
+	Stderr    string
+	Duration  time.Duration
+	CPUTime   time.Duration // User and system CPU time of the git process
+	MaxRSS    int64         // Peak resident set size in bytes, 0 if unknown
+	Truncated bool          // Output exceeded MaxOutput and was cut off
+}
+
+// envKey is the context key for WithEnv
+type envKey struct{}
+
+// WithEnv returns a context whose git commands get the KEY=VALUE variables
+// in env in addition to the configured environment, e.g. to limit
+// repository discovery for the paths of one caller
+func WithEnv(ctx context.Context, env ...string) context.Context {
+	existing, _ := ctx.Value(envKey{}).([]string)
+	return context.WithValue(ctx, envKey{}, append(append([]string(nil), existing...), env...))
+}
+
+// progressWriterKey is the context key for WithProgressWriter
+type progressWriterKey struct{}
+
+// WithProgressWriter returns a context that makes Run stream git's stderr to w.
+// Output is sanitized and delivered one line per Write call; git progress
+// updates terminated by carriage returns are delivered as separate lines.
+func WithProgressWriter(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, progressWriterKey{}, w)
 }
 
 // Run executes a git command with security measures
 func (e *GitExecutor) Run(ctx context.Context, repoPath string, args []string) (*ExecResult, error) {
-	start := time.Now()
+	return e.run(ctx, repoPath, args, nil, nil, nil)
+}
+
+// RunWithInput executes a git command that reads stdin, such as
+// git credential fill
+func (e *GitExecutor) RunWithInput(ctx context.Context, repoPath string, args []string, stdin io.Reader) (*ExecResult, error) {
+	return e.run(ctx, repoPath, args, nil, nil, stdin)
+}
+
+// RunWithCredential executes a git command that talks to a remote,
+// authenticating with cred. Secrets are passed to git through the
+// environment of the child process only, never on the command line.
+func (e *GitExecutor) RunWithCredential(ctx context.Context, repoPath string, args []string, cred *core.Credential) (*ExecResult, error) {
+	if cred == nil {
+		return e.Run(ctx, repoPath, args)
+	}
+	configArgs, env := credentialArgs(cred)
+	return e.run(ctx, repoPath, args, configArgs, env, nil)
+}
 
-	// Create context with timeout if none provided
+// run executes git with configArgs placed before the subcommand and env
+// appended to the secure environment, feeding it stdin if not nil.
+// configArgs and env are trusted.
+func (e *GitExecutor) run(ctx context.Context, repoPath string, args, configArgs, env []string, stdin io.Reader) (*ExecResult, error) {
+	// Bound commands whose context has no deadline by the default timeout
 	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(context.Background(), e.timeout)
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
 		defer cancel()
 	}
 
-	// Sanitize arguments to prevent injection
-	sanitizedArgs := sanitizeArgs(args)
+	// Arguments are passed to git without a shell; only NUL bytes cannot be
+	for _, arg := range args {
+		if err := checkText(arg); err != nil {
+			return nil, invalid(fmt.Sprintf("invalid argument %q: %v", arg, err))
+		}
+	}
+
+	overrides, err := e.config.configArgs(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	// Build command
 	cmdArgs := []string{"-C", repoPath}
-	cmdArgs = append(cmdArgs, sanitizedArgs...)
+	cmdArgs = append(cmdArgs, overrides...)
+	cmdArgs = append(cmdArgs, configArgs...)
+	cmdArgs = append(cmdArgs, args...)
 
-	cmd := exec.CommandContext(ctx, "git", cmdArgs...)
+	cmd := exec.CommandContext(ctx, e.config.GitPath, cmdArgs...)
+
+	// Cancel the whole process group, so helpers such as ssh don't outlive
+	// git, first gracefully and then forcibly
+	setProcessGroup(cmd)
+	var (
+		killMu sync.Mutex
+		kill   *time.Timer
+	)
+	cmd.Cancel = func() error {
+		timer, err := terminate(cmd, e.config.KillGrace)
+		killMu.Lock()
+		kill = timer
+		killMu.Unlock()
+		return err
+	}
+	defer func() {
+		killMu.Lock()
+		defer killMu.Unlock()
+		if kill != nil {
+			kill.Stop()
+		}
+	}()
+	cmd.WaitDelay = e.config.KillGrace + time.Second
 
 	// Set secure environment
-	cmd.Env = []string{
-		"GIT_TERMINAL_PROMPT=0",
-		"LC_ALL=C",
-		"PATH=" + getSecurePath(),
+	isolation, err := e.isolationEnv(ctx)
+	if err != nil {
+		return nil, err
 	}
+	contextEnv, _ := ctx.Value(envKey{}).([]string)
+	cmd.Env = append(e.config.environment(append(isolation, contextEnv...)...), env...)
+
+	stdout := &cappedBuffer{limit: e.config.MaxOutput}
+	stderr := &cappedBuffer{limit: maxStderr}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// Stream sanitized stderr lines to the caller, e.g. for progress reporting
+	if w, ok := ctx.Value(progressWriterKey{}).(io.Writer); ok && w != nil {
+		stream := &lineWriter{out: w}
+		cmd.Stderr = io.MultiWriter(stderr, stream)
+		defer stream.Flush()
+	}
+
+	// Git before 2.22 has no trace2. Checked before taking a slot, as
+	// detecting the capabilities runs git too.
+	trace2 := e.config.Trace2 && e.supports(ctx, core.FeatureTrace2)
 
-	// Execute command
-	stdout, err := cmd.Output()
-	stderr := ""
+	// Wait for a process slot
+	select {
+	case e.slots <- struct{}{}:
+		defer func() { <-e.slots }()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for a git process slot: %w", ctx.Err())
+	}
+	trace := e.beginTrace(ctx, cmd, repoPath, args, stdout, stderr, trace2)
+	result, err := e.wait(ctx, cmd, stdout, stderr)
+	trace.end(err)
+	return result, err
+}
+
+// wait runs cmd and collects its result
+func (e *GitExecutor) wait(ctx context.Context, cmd *exec.Cmd, stdout, stderr *cappedBuffer) (*ExecResult, error) {
+	start := time.Now()
+	err := cmd.Run()
 	exitCode := 0
 
 	if err != nil {
+		// A killed process exits with an error too; report why it was killed
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("git command interrupted: %w", ctxErr)
+		}
 		if exitError, ok := err.(*exec.ExitError); ok {
-			stderr = string(exitError.Stderr)
 			exitCode = exitError.ExitCode()
 		} else {
 			return nil, fmt.Errorf("failed to execute git command: %w", err)
@@ -76,48 +234,80 @@ func (e *GitExecutor) Run(ctx context.Context, repoPath string, args []string) (
 	}
 
 	result := &ExecResult{
-		ExitCode: exitCode,
-		Stdout:   string(stdout),
-		Stderr:   sanitizeOutput(stderr),
-		Duration: time.Since(start),
+		ExitCode:  exitCode,
+		Stdout:    stdout.String(),
+		Stderr:    sanitizeOutput(stderr.String()),
+		Duration:  time.Since(start),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+	if state := cmd.ProcessState; state != nil {
+		result.CPUTime = state.UserTime() + state.SystemTime()
+		result.MaxRSS = maxRSS(state)
 	}
 
 	return result, nil
 }
 
-// sanitizeArgs removes potentially dangerous arguments
-func sanitizeArgs(args []string) []string {
-	var sanitized []string
-	for _, arg := range args {
-		// Skip empty arguments
-		if arg == "" {
-			continue
+// cappedBuffer keeps the first limit bytes written to it and discards the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+	written   int64 // All bytes written, including discarded ones
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.written += int64(len(p))
+	if remaining := b.limit - b.buf.Len(); len(p) > remaining {
+		b.truncated = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
 		}
-		// Basic validation - no shell metacharacters in unexpected places
-		if strings.ContainsAny(arg, ";|&$`") && !isKnownSafeArg(arg) {
+		// Keep draining so git does not block on a full pipe
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
+
+// lineWriter splits output on newlines and carriage returns and forwards
+// each sanitized line to out
+type lineWriter struct {
+	out io.Writer
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' || b == '\r' {
+			w.emit()
 			continue
 		}
-		sanitized = append(sanitized, arg)
+		w.buf = append(w.buf, b)
 	}
-	return sanitized
+	return len(p), nil
 }
 
-// isKnownSafeArg checks if an argument with special characters is known to be safe
-func isKnownSafeArg(arg string) bool {
-	// Allow commit messages and other text that might contain special chars
-	safePatterns := []string{
-		`^-m$`,        // message flag
-		`^--message=`, // message with value
-		`^--format=`,  // format string
-		`^--pretty=`,  // pretty format
-	}
+// Flush forwards any buffered partial line
+func (w *lineWriter) Flush() {
+	w.emit()
+}
 
-	for _, pattern := range safePatterns {
-		if matched, _ := regexp.MatchString(pattern, arg); matched {
-			return true
-		}
+func (w *lineWriter) emit() {
+	if len(w.buf) == 0 {
+		return
 	}
-	return false
+	line := sanitizeOutput(string(w.buf))
+	w.buf = w.buf[:0]
+	_, _ = io.WriteString(w.out, line)
+}
+
+// Sanitize masks credentials, such as passwords in URLs and tokens, in s
+func Sanitize(s string) string {
+	return sanitizeOutput(s)
 }
 
 // sanitizeOutput removes sensitive information from command output
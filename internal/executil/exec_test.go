@@ -2,8 +2,11 @@ package executil
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
 )
 
 func TestNewGitExecutor(t *testing.T) {
@@ -25,47 +28,11 @@ func TestSetTimeout(t *testing.T) {
 	}
 }
 
-func TestSanitizeArgs(t *testing.T) {
-	tests := []struct {
-		name     string
-		input    []string
-		expected []string
-	}{
-		{
-			name:     "clean args",
-			input:    []string{"status", "--porcelain"},
-			expected: []string{"status", "--porcelain"},
-		},
-		{
-			name:     "empty args",
-			input:    []string{"", "status", ""},
-			expected: []string{"status"},
-		},
-		{
-			name:     "dangerous args",
-			input:    []string{"status", "; rm -rf /"},
-			expected: []string{"status"},
-		},
-		{
-			name:     "safe message",
-			input:    []string{"-m", "fix: update test"},
-			expected: []string{"-m", "fix: update test"},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := sanitizeArgs(tt.input)
-			if len(result) != len(tt.expected) {
-				t.Errorf("Expected %d args, got %d", len(tt.expected), len(result))
-				return
-			}
-			for i, arg := range result {
-				if arg != tt.expected[i] {
-					t.Errorf("Expected arg %d to be %q, got %q", i, tt.expected[i], arg)
-				}
-			}
-		})
+func TestRun_RejectsNUL(t *testing.T) {
+	executor := NewGitExecutor()
+	_, err := executor.Run(context.Background(), ".", []string{"log", "--grep=a\x00b"})
+	if !errors.Is(err, core.ErrInvalidArgument) {
+		t.Errorf("Expected invalid argument error, got %v", err)
 	}
 }
 
@@ -120,3 +87,20 @@ func TestRun_InvalidRepo(t *testing.T) {
 		t.Error("Expected non-zero exit code for nonexistent repository path")
 	}
 }
+
+func TestRun_WaitsForProcessSlot(t *testing.T) {
+	config := DefaultExecutorConfig()
+	config.MaxProcesses = 1
+	executor := NewGitExecutorWithConfig(config)
+
+	// Occupy the only slot
+	executor.slots <- struct{}{}
+	defer func() { <-executor.slots }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := executor.Run(ctx, ".", []string{"version"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded while waiting for a slot, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package executil
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/metrics"
+)
+
+// MetricsTracer counts git commands and their durations by subcommand and
+// exit code, and the git processes currently running
+type MetricsTracer struct {
+	commands *metrics.CounterVec
+	duration *metrics.HistogramVec
+	inFlight *metrics.GaugeVec
+}
+
+// NewMetricsTracer creates a tracer registering its metrics in registry
+func NewMetricsTracer(registry *metrics.Registry) *MetricsTracer {
+	return &MetricsTracer{
+		commands: registry.Counter("gitmgr_git_commands_total",
+			"Git commands run, by subcommand and exit code.", "subcommand", "exit_code"),
+		duration: registry.Histogram("gitmgr_git_command_duration_seconds",
+			"Duration of git commands, by subcommand and exit code.", metrics.DefaultBuckets, "subcommand", "exit_code"),
+		inFlight: registry.Gauge("gitmgr_git_processes_in_flight",
+			"Git processes currently running."),
+	}
+}
+
+// subcommandLabel matches subcommands used as label values as is; raw
+// commands could otherwise create arbitrary labels
+var subcommandLabel = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+
+// BeforeCommand implements Tracer
+func (t *MetricsTracer) BeforeCommand(ctx context.Context, trace *CommandTrace) {
+	t.inFlight.Add(1)
+}
+
+// AfterCommand implements Tracer
+func (t *MetricsTracer) AfterCommand(ctx context.Context, trace *CommandTrace) {
+	t.inFlight.Add(-1)
+
+	subcommand := "other"
+	if len(trace.Args) > 0 && subcommandLabel.MatchString(trace.Args[0]) {
+		subcommand = trace.Args[0]
+	}
+	exitCode := strconv.Itoa(trace.ExitCode)
+	t.commands.Inc(subcommand, exitCode)
+	t.duration.Observe(trace.Duration.Seconds(), subcommand, exitCode)
+}
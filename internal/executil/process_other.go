@@ -0,0 +1,23 @@
+//go:build !unix
+
+package executil
+
+import (
+	"os"
+	"os/exec"
+	"time"
+)
+
+// setProcessGroup is a no-op on platforms without process groups
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminate kills the process; helpers it spawned are not reached. There is
+// no timer to stop.
+func terminate(cmd *exec.Cmd, grace time.Duration) (*time.Timer, error) {
+	return nil, cmd.Process.Kill()
+}
+
+// maxRSS is not available on this platform
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
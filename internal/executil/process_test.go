@@ -0,0 +1,146 @@
+//go:build unix
+
+package executil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newScriptExecutor returns an executor whose "git" is the given shell script
+func newScriptExecutor(t *testing.T, script string) *GitExecutor {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "git")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	config := DefaultExecutorConfig()
+	config.GitPath = path
+	config.KillGrace = 200 * time.Millisecond
+	return NewGitExecutorWithConfig(config)
+}
+
+func TestRun_KillsProcessGroup(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "helper-survived")
+	// The helper, like git-remote-https, runs in the background of git
+	executor := newScriptExecutor(t, "(sleep 1; touch "+marker+") &\nwait\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := executor.Run(ctx, ".", []string{"fetch"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Helper process survived cancellation")
+	}
+}
+
+func TestRun_DefaultTimeoutWithContext(t *testing.T) {
+	executor := newScriptExecutor(t, "exec sleep 30\n")
+	executor.SetTimeout(100 * time.Millisecond)
+
+	start := time.Now()
+	_, err := executor.Run(context.Background(), ".", []string{"status"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected default timeout to apply, took %v", elapsed)
+	}
+}
+
+func TestRun_OutputCap(t *testing.T) {
+	executor := newScriptExecutor(t, "head -c 100000 /dev/zero\n")
+	executor.config.MaxOutput = 10
+
+	result, err := executor.Run(context.Background(), ".", []string{"cat-file"})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(result.Stdout) != 10 || !result.Truncated {
+		t.Errorf("Expected 10 bytes of truncated output, got %d bytes, truncated=%v", len(result.Stdout), result.Truncated)
+	}
+}
+
+func TestRun_ResourceUsage(t *testing.T) {
+	executor := NewGitExecutor()
+	result, err := executor.Run(context.Background(), ".", []string{"version"})
+	if err != nil {
+		t.Skipf("git not available: %v", err)
+	}
+	if result.MaxRSS <= 0 {
+		t.Errorf("Expected max RSS to be reported, got %d", result.MaxRSS)
+	}
+}
+
+func TestRun_OldGitFallbacks(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// Git 2.20 ignores GIT_CONFIG_GLOBAL and has no trace2
+	executor := newScriptExecutor(t, `case "$3" in
+version) echo "git version 2.20.1" ;;
+*) echo "HOME=$HOME"; echo "XDG_CONFIG_HOME=$XDG_CONFIG_HOME"; echo "GIT_TRACE2_EVENT=$GIT_TRACE2_EVENT" ;;
+esac
+`)
+	executor.config.Isolated = true
+	executor.config.Trace2 = true
+	commands := NewRingTracer(DefaultRingSize)
+	executor.AddTracer(commands)
+
+	result, err := executor.Run(context.Background(), t.TempDir(), []string{"status"})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	env := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(result.Stdout), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		env[key] = value
+	}
+
+	if env["HOME"] == "" || env["HOME"] == home {
+		t.Errorf("Expected an isolated HOME, got %q", env["HOME"])
+	} else if entries, err := os.ReadDir(env["HOME"]); err != nil || len(entries) != 0 {
+		t.Errorf("Expected an empty HOME, got %v, %v", entries, err)
+	}
+	if env["XDG_CONFIG_HOME"] != env["HOME"] {
+		t.Errorf("Expected XDG_CONFIG_HOME %q, got %q", env["HOME"], env["XDG_CONFIG_HOME"])
+	}
+	if env["GIT_TRACE2_EVENT"] != "" {
+		t.Errorf("Expected no trace2 file for git 2.20, got %q", env["GIT_TRACE2_EVENT"])
+	}
+}
+
+func TestTerminateKillTimer(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	kill, err := terminate(cmd, time.Minute)
+	if err != nil {
+		t.Fatalf("terminate failed: %v", err)
+	}
+	_ = cmd.Wait()
+	// The SIGKILL is still pending, and stopping it keeps it from reaching
+	// a process group that reuses the ID
+	if kill == nil || !kill.Stop() {
+		t.Error("Expected a pending kill timer")
+	}
+
+	if kill, err := terminate(cmd, time.Minute); !errors.Is(err, os.ErrProcessDone) || kill != nil {
+		t.Errorf("Expected ErrProcessDone and no timer for an exited process, got %v, %v", kill, err)
+	}
+}
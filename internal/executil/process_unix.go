@@ -0,0 +1,45 @@
+//go:build unix
+
+package executil
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup starts cmd in its own process group so that helpers it
+// spawns, such as git-remote-https or ssh, can be signalled with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminate sends SIGTERM to the process group of cmd and SIGKILL after
+// grace. Stop the returned timer once cmd was waited for, so the SIGKILL does
+// not reach a process group that reused the ID.
+func terminate(cmd *exec.Cmd, grace time.Duration) (*time.Timer, error) {
+	pgid := -cmd.Process.Pid
+	err := syscall.Kill(pgid, syscall.SIGTERM)
+	if err == syscall.ESRCH {
+		return nil, os.ErrProcessDone
+	}
+	kill := time.AfterFunc(grace, func() {
+		_ = syscall.Kill(pgid, syscall.SIGKILL)
+	})
+	return kill, err
+}
+
+// maxRSS returns the peak resident set size of the process in bytes
+func maxRSS(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	// Linux reports kilobytes, macOS bytes
+	if runtime.GOOS == "darwin" {
+		return int64(usage.Maxrss)
+	}
+	return int64(usage.Maxrss) * 1024
+}
@@ -0,0 +1,258 @@
+package executil
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/logging"
+)
+
+// CommandTrace describes a git command for tracers. Args are sanitized and
+// leave out the settings the executor adds, such as credential helpers.
+type CommandTrace struct {
+	ID          uint64                   `json:"id"`
+	RequestID   string                   `json:"requestId,omitempty"` // See logging.WithRequestID
+	Dir         string                   `json:"dir"`
+	Args        []string                 `json:"args"`
+	Start       time.Time                `json:"start"`
+	Duration    time.Duration            `json:"duration"`
+	ExitCode    int                      `json:"exitCode"` // -1 if git did not exit normally
+	StdoutBytes int64                    `json:"stdoutBytes"`
+	StderrBytes int64                    `json:"stderrBytes"`
+	Error       string                   `json:"error,omitempty"`  // Why the command could not run or was interrupted
+	Trace2      []map[string]interface{} `json:"trace2,omitempty"` // GIT_TRACE2_EVENT events when enabled
+}
+
+// Tracer observes the git commands run by a GitExecutor. Methods are called
+// on the goroutine running the command and should return quickly.
+type Tracer interface {
+	// BeforeCommand is called just before the git process starts
+	BeforeCommand(ctx context.Context, trace *CommandTrace)
+	// AfterCommand is called once the process has exited, with its outcome set
+	AfterCommand(ctx context.Context, trace *CommandTrace)
+}
+
+// maxTrace2Events caps the trace2 events kept per command
+const maxTrace2Events = 1000
+
+// AddTracer registers t to observe every command run by the executor
+func (e *GitExecutor) AddTracer(t Tracer) {
+	e.tracerMu.Lock()
+	defer e.tracerMu.Unlock()
+	e.tracers = append(e.tracers, t)
+}
+
+// activeTrace is a command being traced
+type activeTrace struct {
+	ctx        context.Context
+	tracers    []Tracer
+	trace      *CommandTrace
+	cmd        *exec.Cmd
+	stdout     *cappedBuffer
+	stderr     *cappedBuffer
+	trace2Path string
+}
+
+// beginTrace notifies tracers that cmd is about to run, capturing its
+// trace2 events if trace2 is set. It returns nil when there are no tracers.
+func (e *GitExecutor) beginTrace(ctx context.Context, cmd *exec.Cmd, repoPath string, args []string, stdout, stderr *cappedBuffer, trace2 bool) *activeTrace {
+	e.tracerMu.RLock()
+	tracers := e.tracers
+	e.tracerMu.RUnlock()
+	if len(tracers) == 0 {
+		return nil
+	}
+
+	sanitized := make([]string, len(args))
+	for i, arg := range args {
+		sanitized[i] = sanitizeOutput(arg)
+	}
+	t := &activeTrace{
+		ctx:     ctx,
+		tracers: tracers,
+		trace: &CommandTrace{
+			ID:        e.traceIDs.Add(1),
+			RequestID: logging.RequestIDFromContext(ctx),
+			Dir:       repoPath,
+			Args:      sanitized,
+			Start:     time.Now(),
+		},
+		cmd:    cmd,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	// Git and the git processes it starts append their events to the file
+	if trace2 {
+		if f, err := os.CreateTemp("", "gitmgr-trace2-*.json"); err == nil {
+			f.Close()
+			t.trace2Path = f.Name()
+			cmd.Env = append(cmd.Env, "GIT_TRACE2_EVENT="+t.trace2Path)
+		}
+	}
+
+	for _, tracer := range tracers {
+		tracer.BeforeCommand(ctx, t.trace)
+	}
+	return t
+}
+
+// end records the outcome of the command and notifies tracers
+func (t *activeTrace) end(err error) {
+	if t == nil {
+		return
+	}
+
+	t.trace.Duration = time.Since(t.trace.Start)
+	t.trace.ExitCode = -1
+	if state := t.cmd.ProcessState; state != nil {
+		t.trace.ExitCode = state.ExitCode()
+	}
+	t.trace.StdoutBytes = t.stdout.written
+	t.trace.StderrBytes = t.stderr.written
+	if err != nil {
+		t.trace.Error = err.Error()
+	}
+	if t.trace2Path != "" {
+		t.trace.Trace2 = readTrace2(t.trace2Path)
+		os.Remove(t.trace2Path)
+	}
+
+	for _, tracer := range t.tracers {
+		tracer.AfterCommand(t.ctx, t.trace)
+	}
+}
+
+// readTrace2 parses the JSON lines written to a GIT_TRACE2_EVENT file.
+// Like CommandTrace.Args, the events leave out the settings the executor
+// adds: command lines ("argv" of git and its children) and def_param
+// events with configuration values are dropped, and other strings are
+// sanitized.
+func readTrace2(path string) []map[string]interface{} {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() && len(events) < maxTrace2Events {
+		var event map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || event["event"] == "def_param" {
+			continue
+		}
+		delete(event, "argv")
+		events = append(events, sanitizeTrace2(event).(map[string]interface{}))
+	}
+	return events
+}
+
+// sanitizeTrace2 sanitizes the strings in a decoded trace2 value
+func sanitizeTrace2(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return sanitizeOutput(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = sanitizeTrace2(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = sanitizeTrace2(v[key])
+		}
+	}
+	return value
+}
+
+// LogTracer logs every finished git command
+type LogTracer struct {
+	Logger *logging.Logger
+}
+
+// NewLogTracer creates a tracer writing to logger
+func NewLogTracer(logger *logging.Logger) *LogTracer {
+	return &LogTracer{Logger: logger}
+}
+
+// BeforeCommand implements Tracer
+func (t *LogTracer) BeforeCommand(ctx context.Context, trace *CommandTrace) {}
+
+// AfterCommand implements Tracer. Commands that could not run or were
+// interrupted are logged as warnings.
+func (t *LogTracer) AfterCommand(ctx context.Context, trace *CommandTrace) {
+	fields := map[string]interface{}{
+		"id":          trace.ID,
+		"dir":         trace.Dir,
+		"args":        strings.Join(trace.Args, " "),
+		"exitCode":    trace.ExitCode,
+		"duration":    trace.Duration.String(),
+		"stdoutBytes": trace.StdoutBytes,
+		"stderrBytes": trace.StderrBytes,
+	}
+	if len(trace.Trace2) > 0 {
+		fields["trace2Events"] = len(trace.Trace2)
+	}
+	if trace.Error != "" {
+		fields["error"] = trace.Error
+		t.Logger.WithContext(ctx).Warn("Git command failed", fields)
+		return
+	}
+	t.Logger.WithContext(ctx).Info("Git command finished", fields)
+}
+
+// DefaultRingSize is the number of commands a RingTracer keeps by default
+const DefaultRingSize = 200
+
+// RingTracer keeps the most recently finished commands in memory
+type RingTracer struct {
+	mu      sync.Mutex
+	entries []CommandTrace
+	next    int
+	full    bool
+}
+
+// NewRingTracer creates a tracer keeping the last size commands
+func NewRingTracer(size int) *RingTracer {
+	if size <= 0 {
+		size = DefaultRingSize
+	}
+	return &RingTracer{entries: make([]CommandTrace, size)}
+}
+
+// BeforeCommand implements Tracer
+func (r *RingTracer) BeforeCommand(ctx context.Context, trace *CommandTrace) {}
+
+// AfterCommand implements Tracer
+func (r *RingTracer) AfterCommand(ctx context.Context, trace *CommandTrace) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = *trace
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Commands returns the recorded commands, most recent first
+func (r *RingTracer) Commands() []CommandTrace {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+	commands := make([]CommandTrace, 0, n)
+	for i := 1; i <= n; i++ {
+		commands = append(commands, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+	return commands
+}
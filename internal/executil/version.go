@@ -0,0 +1,124 @@
+package executil
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// Version is a parsed git version
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// String formats the version as major.minor.patch
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is major.minor or newer
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// versionPattern matches "git version 2.39.5", "git version 2.37.1 (Apple Git-137.1)"
+// and "git version 2.41.0.windows.1"
+var versionPattern = regexp.MustCompile(`git version (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion parses the output of git version
+func ParseVersion(output string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(output)
+	if match == nil {
+		return Version{}, fmt.Errorf("unrecognized git version output: %q", output)
+	}
+
+	var v Version
+	v.Major, _ = strconv.Atoi(match[1])
+	v.Minor, _ = strconv.Atoi(match[2])
+	if match[3] != "" {
+		v.Patch, _ = strconv.Atoi(match[3])
+	}
+	return v, nil
+}
+
+// featureVersions lists the first git release supporting each feature
+var featureVersions = []struct {
+	feature      string
+	major, minor int
+}{
+	{core.FeatureBranchShowCurrent, 2, 22},
+	{core.FeatureTrace2, 2, 22},
+	{core.FeatureSparseCheckout, 2, 25},
+	{core.FeatureCloneSparse, 2, 27},
+	{core.FeatureConfigGlobalEnv, 2, 32},
+}
+
+// featureProbes maps features to subcommands whose presence is probed when
+// the version cannot be parsed, e.g. for vendor builds
+var featureProbes = map[string]string{
+	core.FeatureSparseCheckout: "sparse-checkout",
+}
+
+// Capabilities detects the git version and supported features.
+// The result is cached per executor once detection succeeds.
+func (e *GitExecutor) Capabilities(ctx context.Context) (*core.Capabilities, error) {
+	e.capsMu.Lock()
+	defer e.capsMu.Unlock()
+
+	if e.caps != nil {
+		return e.caps, nil
+	}
+
+	ctx = context.WithValue(ctx, detectingKey{}, true)
+	result, err := e.Run(ctx, ".", []string{"version"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect git version: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to detect git version: %s", result.Stderr)
+	}
+
+	caps := &core.Capabilities{Features: make(map[string]bool)}
+	version, err := ParseVersion(result.Stdout)
+	if err == nil {
+		caps.Version = version.String()
+		for _, f := range featureVersions {
+			caps.Features[f.feature] = version.AtLeast(f.major, f.minor)
+		}
+	} else {
+		caps.Version = "unknown"
+		for _, f := range featureVersions {
+			caps.Features[f.feature] = false
+		}
+		for feature, subcommand := range featureProbes {
+			caps.Features[feature] = e.probe(ctx, subcommand)
+		}
+	}
+
+	e.caps = caps
+	return caps, nil
+}
+
+// detectingKey marks the context of the commands detecting capabilities,
+// which run before the features they use can be checked
+type detectingKey struct{}
+
+// supports reports whether git has feature. It reports false for the
+// commands detecting the capabilities and if detection fails.
+func (e *GitExecutor) supports(ctx context.Context, feature string) bool {
+	if ctx.Value(detectingKey{}) != nil {
+		return false
+	}
+	caps, err := e.Capabilities(ctx)
+	return err == nil && caps.Has(feature)
+}
+
+// probe reports whether git knows subcommand. "git <cmd> -h" exits with 129
+// after printing usage for known commands and 1 for unknown ones.
+func (e *GitExecutor) probe(ctx context.Context, subcommand string) bool {
+	result, err := e.Run(ctx, ".", []string{subcommand, "-h"})
+	return err == nil && result.ExitCode == 129
+}
@@ -0,0 +1,65 @@
+package executil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected Version
+		wantErr  bool
+	}{
+		{"git version 2.39.5\n", Version{2, 39, 5}, false},
+		{"git version 2.37.1 (Apple Git-137.1)", Version{2, 37, 1}, false},
+		{"git version 2.41.0.windows.1", Version{2, 41, 0}, false},
+		{"git version 2.45", Version{2, 45, 0}, false},
+		{"hub version 2.14.2", Version{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			v, err := ParseVersion(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error: %v, got %v", tt.wantErr, err)
+			}
+			if v != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, v)
+			}
+		})
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	v := Version{2, 25, 1}
+	if !v.AtLeast(2, 25) || !v.AtLeast(1, 99) {
+		t.Errorf("Expected %v to be at least 2.25 and 1.99", v)
+	}
+	if v.AtLeast(2, 26) || v.AtLeast(3, 0) {
+		t.Errorf("Expected %v to be older than 2.26 and 3.0", v)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	executor := NewGitExecutor()
+	ctx := context.Background()
+
+	caps, err := executor.Capabilities(ctx)
+	if err != nil {
+		t.Fatalf("Capabilities failed: %v", err)
+	}
+	if caps.Version == "" {
+		t.Error("Expected a git version")
+	}
+	if _, ok := caps.Features[core.FeatureBranchShowCurrent]; !ok {
+		t.Errorf("Expected %s to be reported, got %v", core.FeatureBranchShowCurrent, caps.Features)
+	}
+
+	again, err := executor.Capabilities(ctx)
+	if err != nil || again != caps {
+		t.Error("Expected capabilities to be cached")
+	}
+}
@@ -0,0 +1,27 @@
+// Package filelock provides advisory locks that coordinate processes
+// sharing files
+package filelock
+
+import (
+	"fmt"
+	"os"
+)
+
+// Lock blocks until it holds an exclusive lock on the file at path, creating
+// it if needed, and returns the function releasing it. The lock is advisory:
+// it only excludes other users of this package. On platforms without file
+// locks only the creation of the file is ensured.
+func Lock(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lock(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return func() {
+		_ = unlock(f)
+		f.Close()
+	}, nil
+}
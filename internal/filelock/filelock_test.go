@@ -0,0 +1,49 @@
+package filelock
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockExcludes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.lock")
+
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	// flock locks belong to open files, so a second open in the same
+	// process waits like another process would
+	var mu sync.Mutex
+	acquired := false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		release, err := Lock(path)
+		if err != nil {
+			t.Errorf("Lock failed: %v", err)
+			return
+		}
+		mu.Lock()
+		acquired = true
+		mu.Unlock()
+		release()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	if acquired {
+		t.Error("Expected the second lock to wait")
+	}
+	mu.Unlock()
+
+	unlock()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Second lock was not acquired after unlock")
+	}
+}
@@ -0,0 +1,79 @@
+package gitstate
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitDir returns the git directory of the repository at path: path/.git, the
+// directory a .git file of a linked worktree or submodule points to, or path
+// itself for bare repositories
+func GitDir(path string) string {
+	dotGit := filepath.Join(path, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return path
+	}
+	if info.IsDir() {
+		return dotGit
+	}
+
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return path
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return path
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(path, target)
+	}
+	return target
+}
+
+// commonDir returns the directory holding the refs and config shared by the
+// worktrees of the repository under gitDir
+func commonDir(gitDir string) string {
+	data, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if err != nil {
+		return gitDir
+	}
+	dir := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitDir, dir)
+	}
+	return dir
+}
+
+// Fingerprint summarizes HEAD, the loose and packed refs, the index and the
+// config of the repository under gitDir. It changes whenever git updates any
+// of them, but not when files in the worktree are edited.
+func Fingerprint(gitDir string) string {
+	state := Read(gitDir)
+	parts := []string{
+		state.Head,
+		state.HeadModTime.String(),
+		state.RefsModTime.String(),
+		fmt.Sprint(state.RefsCount),
+		state.PackedModTime.String(),
+		state.IndexModTime.String(),
+		fmt.Sprint(state.IndexSize),
+	}
+
+	// Linked worktrees keep branches and config in the main repository
+	common := commonDir(gitDir)
+	if common != gitDir {
+		shared := Read(common)
+		parts = append(parts, shared.RefsModTime.String(), fmt.Sprint(shared.RefsCount), shared.PackedModTime.String())
+	}
+	if info, err := os.Stat(filepath.Join(common, "config")); err == nil {
+		parts = append(parts, info.ModTime().String(), fmt.Sprint(info.Size()))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return fmt.Sprintf("%x", sum[:16])
+}
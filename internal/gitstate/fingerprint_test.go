@@ -0,0 +1,79 @@
+package gitstate
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFingerprint(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-C", root, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "initial")
+
+	gitDir := GitDir(root)
+	if gitDir != filepath.Join(root, ".git") {
+		t.Fatalf("Expected git dir %s, got %s", filepath.Join(root, ".git"), gitDir)
+	}
+
+	before := Fingerprint(gitDir)
+	if Fingerprint(gitDir) != before {
+		t.Error("Expected the fingerprint to be stable")
+	}
+
+	// Worktree edits are not part of the fingerprint
+	if err := os.WriteFile(filepath.Join(root, "file.txt"), []byte("content\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if Fingerprint(gitDir) != before {
+		t.Error("Expected worktree edits to keep the fingerprint")
+	}
+
+	// Make sure mtimes differ on filesystems with coarse timestamps
+	time.Sleep(10 * time.Millisecond)
+
+	steps := []struct {
+		name string
+		args []string
+	}{
+		{"stage", []string{"add", "file.txt"}},
+		{"commit", []string{"commit", "-q", "-m", "add file"}},
+		{"branch", []string{"branch", "feature"}},
+		{"pack refs", []string{"pack-refs", "--all"}},
+		{"config", []string{"config", "gitmgr.test", "true"}},
+	}
+	for _, step := range steps {
+		git(step.args...)
+		after := Fingerprint(gitDir)
+		if after == before {
+			t.Errorf("Expected %s to change the fingerprint", step.name)
+		}
+		before = after
+	}
+
+	// A linked worktree sees branches created in the main repository
+	worktree := filepath.Join(t.TempDir(), "wt")
+	git("worktree", "add", "-q", worktree, "feature")
+	wtGitDir := GitDir(worktree)
+	if wtGitDir == worktree {
+		t.Fatalf("Expected the .git file of %s to be followed", worktree)
+	}
+	wtBefore := Fingerprint(wtGitDir)
+	git("branch", "other")
+	if Fingerprint(wtGitDir) == wtBefore {
+		t.Error("Expected a new branch to change the worktree fingerprint")
+	}
+}
@@ -0,0 +1,65 @@
+package gitstate
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadRefs returns HEAD and every ref of the repository under gitDir mapped
+// to its value, read from loose ref files and packed-refs without running
+// git. Symbolic refs map to "ref: <target>". Worktrees read the refs of the
+// main repository and their own HEAD.
+func ReadRefs(gitDir string) map[string]string {
+	refs := make(map[string]string)
+	if gitDir == "" {
+		return refs
+	}
+
+	commonDir := gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+
+	if f, err := os.Open(filepath.Join(commonDir, "packed-refs")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			// Skip the header and peeled values of annotated tags
+			if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+				continue
+			}
+			if value, name, ok := strings.Cut(line, " "); ok {
+				refs[name] = value
+			}
+		}
+		f.Close()
+	}
+
+	// Loose refs take precedence over packed ones
+	_ = filepath.WalkDir(filepath.Join(commonDir, "refs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(commonDir, path)
+		if err != nil {
+			return nil
+		}
+		refs[filepath.ToSlash(rel)] = strings.TrimSpace(string(data))
+		return nil
+	})
+
+	if data, err := os.ReadFile(filepath.Join(gitDir, "HEAD")); err == nil {
+		refs["HEAD"] = strings.TrimSpace(string(data))
+	}
+	return refs
+}
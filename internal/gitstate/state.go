@@ -0,0 +1,128 @@
+package gitstate
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxWorktreeFiles bounds the worktree walk so huge checkouts stay cheap to poll
+const maxWorktreeFiles = 10000
+
+// State is a cheap, stat-based snapshot of a repository's on-disk state
+type State struct {
+	Head          string    `json:"head"`
+	HeadModTime   time.Time `json:"headModTime"`
+	RefsModTime   time.Time `json:"refsModTime"`
+	RefsCount     int       `json:"refsCount"`
+	PackedModTime time.Time `json:"packedModTime"`
+	IndexModTime  time.Time `json:"indexModTime"`
+	IndexSize     int64     `json:"indexSize"`
+}
+
+// Read takes a snapshot of the repository state under gitDir.
+// Missing files are treated as zero values so new repositories can be read.
+func Read(gitDir string) State {
+	var state State
+
+	headFile := filepath.Join(gitDir, "HEAD")
+	if data, err := os.ReadFile(headFile); err == nil {
+		state.Head = strings.TrimSpace(string(data))
+	}
+	if info, err := os.Stat(headFile); err == nil {
+		state.HeadModTime = info.ModTime()
+	}
+
+	if info, err := os.Stat(filepath.Join(gitDir, "packed-refs")); err == nil {
+		state.PackedModTime = info.ModTime()
+	}
+
+	// Loose refs: track the newest mtime and the number of entries so that
+	// both updates and deletions are noticed
+	_ = filepath.WalkDir(filepath.Join(gitDir, "refs"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().After(state.RefsModTime) {
+			state.RefsModTime = info.ModTime()
+		}
+		if !d.IsDir() {
+			state.RefsCount++
+		}
+		return nil
+	})
+
+	if info, err := os.Stat(filepath.Join(gitDir, "index")); err == nil {
+		state.IndexModTime = info.ModTime()
+		state.IndexSize = info.Size()
+	}
+
+	return state
+}
+
+// HeadChanged reports whether HEAD points somewhere else
+func (s State) HeadChanged(other State) bool {
+	return s.Head != other.Head || !s.HeadModTime.Equal(other.HeadModTime)
+}
+
+// RefsChanged reports whether any loose or packed ref changed
+func (s State) RefsChanged(other State) bool {
+	return !s.RefsModTime.Equal(other.RefsModTime) ||
+		s.RefsCount != other.RefsCount ||
+		!s.PackedModTime.Equal(other.PackedModTime)
+}
+
+// IndexChanged reports whether the index file changed
+func (s State) IndexChanged(other State) bool {
+	return !s.IndexModTime.Equal(other.IndexModTime) || s.IndexSize != other.IndexSize
+}
+
+// Worktree is a stat-based signature of the files in a working tree
+type Worktree struct {
+	Files   int
+	Size    int64
+	ModTime time.Time
+}
+
+// Changed reports whether any file in the working tree was added, removed or modified
+func (w Worktree) Changed(other Worktree) bool {
+	return w.Files != other.Files || w.Size != other.Size || !w.ModTime.Equal(other.ModTime)
+}
+
+// ReadWorktree walks workDir, skipping .git, and summarizes file sizes and mtimes.
+// The walk stops after maxWorktreeFiles files.
+func ReadWorktree(workDir string) Worktree {
+	var wt Worktree
+
+	_ = filepath.WalkDir(workDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if wt.Files >= maxWorktreeFiles {
+			return filepath.SkipAll
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			wt.Files++
+			wt.Size += info.Size()
+		}
+		if info.ModTime().After(wt.ModTime) {
+			wt.ModTime = info.ModTime()
+		}
+		return nil
+	})
+
+	return wt
+}
@@ -1,25 +1,35 @@
 package logging
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 // Level represents log levels
 type Level int
 
+// LevelInfo is the zero Level, so loggers log informational messages by default
 const (
-	LevelInfo Level = iota
+	LevelTrace Level = iota - 2
+	LevelDebug
+	LevelInfo
 	LevelWarn
 	LevelError
 )
 
 func (l Level) String() string {
 	switch l {
+	case LevelTrace:
+		return "TRACE"
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
 	case LevelWarn:
@@ -31,8 +41,25 @@ func (l Level) String() string {
 	}
 }
 
-// Logger provides structured logging
+// ParseLevel parses a level name such as "debug", ignoring case
+func ParseLevel(name string) (Level, error) {
+	for _, level := range []Level{LevelTrace, LevelDebug, LevelInfo, LevelWarn, LevelError} {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q: expected trace, debug, info, warn or error", name)
+}
+
+// Logger provides structured logging. It is safe for concurrent use.
 type Logger struct {
+	sink   *sink
+	fields map[string]interface{}
+}
+
+// sink is the destination and settings shared by a logger and its children
+type sink struct {
+	mu     sync.Mutex
 	output io.Writer
 	json   bool
 	level  Level
@@ -52,15 +79,60 @@ func NewLogger(output io.Writer, jsonFormat bool) *Logger {
 		output = os.Stderr
 	}
 	return &Logger{
-		output: output,
-		json:   jsonFormat,
-		level:  LevelInfo,
+		sink: &sink{
+			output: output,
+			json:   jsonFormat,
+			level:  LevelInfo,
+		},
 	}
 }
 
-// SetLevel sets the minimum log level
+// SetLevel sets the minimum log level of the logger and the loggers derived from it
 func (l *Logger) SetLevel(level Level) {
-	l.level = level
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	l.sink.level = level
+}
+
+// SetJSON enables/disables JSON formatting for the logger and the loggers derived from it
+func (l *Logger) SetJSON(enabled bool) {
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	l.sink.json = enabled
+}
+
+// Enabled reports whether messages at level are written
+func (l *Logger) Enabled(level Level) bool {
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	return level >= l.sink.level
+}
+
+// With returns a logger adding fields to every entry. Fields passed to a
+// log call take precedence.
+func (l *Logger) With(fields map[string]interface{}) *Logger {
+	if len(fields) == 0 {
+		return l
+	}
+	return &Logger{sink: l.sink, fields: mergeFields(l.fields, fields)}
+}
+
+// WithContext returns a logger adding the request ID carried by ctx, if any
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	if id := RequestIDFromContext(ctx); id != "" {
+		return l.With(map[string]interface{}{"requestId": id})
+	}
+	return l
+}
+
+// Trace logs a trace message
+func (l *Logger) Trace(message string, fields ...map[string]interface{}) {
+	l.log(LevelTrace, message, fields...)
+}
+
+// Debug logs a debug message
+func (l *Logger) Debug(message string, fields ...map[string]interface{}) {
+	l.log(LevelDebug, message, fields...)
 }
 
 // Info logs an info message
@@ -80,7 +152,7 @@ func (l *Logger) Error(message string, fields ...map[string]interface{}) {
 
 // log writes a log entry
 func (l *Logger) log(level Level, message string, fields ...map[string]interface{}) {
-	if level < l.level {
+	if !l.Enabled(level) {
 		return
 	}
 
@@ -88,46 +160,101 @@ func (l *Logger) log(level Level, message string, fields ...map[string]interface
 		Timestamp: time.Now().UTC().Format(time.RFC3339),
 		Level:     level.String(),
 		Message:   message,
+		Fields:    l.fields,
 	}
 
-	if len(fields) > 0 {
-		entry.Fields = fields[0]
+	if len(fields) > 0 && len(fields[0]) > 0 {
+		entry.Fields = mergeFields(l.fields, fields[0])
 	}
 
-	if l.json {
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	if l.sink.json {
 		l.writeJSON(entry)
 	} else {
 		l.writeText(entry)
 	}
 }
 
-// writeJSON writes log entry as JSON
+// mergeFields returns the union of base and fields, preferring fields
+func mergeFields(base, fields map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(fields))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return merged
+}
+
+// writeJSON writes log entry as JSON; l.sink.mu must be held
 func (l *Logger) writeJSON(entry LogEntry) {
 	data, err := json.Marshal(entry)
 	if err != nil {
-		log.Printf("Failed to marshal log entry: %v", err)
+		// Not through the log package: it may be redirected to this logger
+		l.writeText(entry)
 		return
 	}
-	fmt.Fprintln(l.output, string(data))
+	fmt.Fprintln(l.sink.output, string(data))
 }
 
-// writeText writes log entry as plain text
+// writeText writes log entry as plain text with fields sorted by name;
+// l.sink.mu must be held
 func (l *Logger) writeText(entry LogEntry) {
 	output := fmt.Sprintf("[%s] %s: %s", entry.Timestamp, entry.Level, entry.Message)
 
-	if entry.Fields != nil && len(entry.Fields) > 0 {
+	if len(entry.Fields) > 0 {
+		keys := make([]string, 0, len(entry.Fields))
+		for k := range entry.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
 		output += " |"
-		for k, v := range entry.Fields {
-			output += fmt.Sprintf(" %s=%v", k, v)
+		for _, k := range keys {
+			output += fmt.Sprintf(" %s=%v", k, entry.Fields[k])
 		}
 	}
 
-	fmt.Fprintln(l.output, output)
+	fmt.Fprintln(l.sink.output, output)
+}
+
+// requestIDKey is the context key for WithRequestID
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose log lines carry id, see Logger.WithContext
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID set with WithRequestID
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
 }
 
 // Default logger instance
 var defaultLogger = NewLogger(os.Stderr, false)
 
+// Default returns the logger used by the package-level functions
+func Default() *Logger {
+	return defaultLogger
+}
+
+// Trace logs a trace message using the default logger
+func Trace(message string, fields ...map[string]interface{}) {
+	defaultLogger.Trace(message, fields...)
+}
+
+// Debug logs a debug message using the default logger
+func Debug(message string, fields ...map[string]interface{}) {
+	defaultLogger.Debug(message, fields...)
+}
+
 // Info logs an info message using the default logger
 func Info(message string, fields ...map[string]interface{}) {
 	defaultLogger.Info(message, fields...)
@@ -145,7 +272,7 @@ func Error(message string, fields ...map[string]interface{}) {
 
 // SetJSONFormat enables/disables JSON formatting for the default logger
 func SetJSONFormat(enabled bool) {
-	defaultLogger.json = enabled
+	defaultLogger.SetJSON(enabled)
 }
 
 // SetLevel sets the log level for the default logger
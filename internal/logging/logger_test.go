@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// decode parses the JSON lines written by a logger
+func decode(t *testing.T, buf *bytes.Buffer) []LogEntry {
+	t.Helper()
+	var entries []LogEntry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, true)
+	logger.SetLevel(LevelDebug)
+
+	logger.Trace("trace")
+	logger.Debug("debug")
+	logger.Info("info")
+
+	entries := decode(t, &buf)
+	if len(entries) != 2 || entries[0].Level != "DEBUG" || entries[1].Level != "INFO" {
+		t.Errorf("Expected DEBUG and INFO entries, got %+v", entries)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("Trace"); err != nil || level != LevelTrace {
+		t.Errorf("Expected LevelTrace, got %v, %v", level, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+}
+
+func TestWithAndContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, true)
+	child := logger.With(map[string]interface{}{"component": "git", "attempt": 1})
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	child.WithContext(ctx).Info("retrying", map[string]interface{}{"attempt": 2})
+	logger.Info("plain")
+
+	entries := decode(t, &buf)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	fields := entries[0].Fields
+	if fields["component"] != "git" || fields["requestId"] != "req-1" || fields["attempt"] != float64(2) {
+		t.Errorf("Unexpected fields: %v", fields)
+	}
+	if entries[1].Fields != nil {
+		t.Errorf("Expected parent logger without fields, got %v", entries[1].Fields)
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				logger.With(map[string]interface{}{"j": j}).Info("message")
+				logger.SetJSON(j%2 == 0)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 400 {
+		t.Errorf("Expected 400 lines, got %d", lines)
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, true)
+	slogger := slog.New(NewSlogHandler(logger)).With("component", "index").WithGroup("repo")
+
+	ctx := WithRequestID(context.Background(), "req-2")
+	slogger.DebugContext(ctx, "hidden")
+	slogger.WarnContext(ctx, "slow", "path", "/tmp/repo", "error", errors.New("boom"))
+
+	entries := decode(t, &buf)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Level != "WARN" || entry.Message != "slow" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	expected := map[string]interface{}{
+		"component":  "index",
+		"repo.path":  "/tmp/repo",
+		"repo.error": "boom",
+		"requestId":  "req-2",
+	}
+	for k, v := range expected {
+		if entry.Fields[k] != v {
+			t.Errorf("Expected field %s=%v, got %v", k, v, entry.Fields[k])
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogHandler is a slog.Handler writing through a Logger, so libraries
+// using log/slog share its output, format and level
+type SlogHandler struct {
+	logger *Logger
+	attrs  map[string]interface{}
+	group  string
+}
+
+// NewSlogHandler creates a handler writing to logger
+func NewSlogHandler(logger *Logger) *SlogHandler {
+	return &SlogHandler{logger: logger}
+}
+
+// fromSlogLevel maps slog levels to logger levels; levels below
+// slog.LevelDebug are trace messages
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelDebug:
+		return LevelTrace
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+// Enabled implements slog.Handler
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.logger.Enabled(fromSlogLevel(level))
+}
+
+// Handle implements slog.Handler. Attributes in groups are named
+// "group.key"; the request ID in ctx is added like Logger.WithContext does.
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	fields := make(map[string]interface{}, len(h.attrs)+record.NumAttrs())
+	for k, v := range h.attrs {
+		fields[k] = v
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(fields, h.group, attr)
+		return true
+	})
+
+	h.logger.WithContext(ctx).log(fromSlogLevel(record.Level), record.Message, fields)
+	return nil
+}
+
+// WithAttrs implements slog.Handler
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make(map[string]interface{}, len(h.attrs)+len(attrs))
+	for k, v := range h.attrs {
+		fields[k] = v
+	}
+	for _, attr := range attrs {
+		addAttr(fields, h.group, attr)
+	}
+	return &SlogHandler{logger: h.logger, attrs: fields, group: h.group}
+}
+
+// WithGroup implements slog.Handler
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{logger: h.logger, attrs: h.attrs, group: h.group + name + "."}
+}
+
+// addAttr stores attr in fields under prefix, flattening groups
+func addAttr(fields map[string]interface{}, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+		}
+		for _, a := range value.Group() {
+			addAttr(fields, groupPrefix, a)
+		}
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+	if err, ok := value.Any().(error); ok {
+		// Errors have no exported fields and would be encoded as {}
+		fields[prefix+attr.Key] = err.Error()
+		return
+	}
+	fields[prefix+attr.Key] = value.Any()
+}
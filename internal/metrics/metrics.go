@@ -0,0 +1,339 @@
+// Package metrics implements counters, gauges and histograms exposed in the
+// Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are histogram upper bounds in seconds suited to request and
+// git command durations
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// Registry holds metric families and writes them in the text exposition format
+type Registry struct {
+	mu         sync.Mutex
+	families   map[string]family
+	collectors []func()
+}
+
+// family is a named metric with its samples
+type family interface {
+	write(w *bufio.Writer, name string)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// register adds a family, panicking on duplicate names like a duplicate
+// route would
+func (r *Registry) register(name string, f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.families[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.families[name] = f
+}
+
+// Counter registers a counter with the given label names
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(help, labels)}
+	r.register(name, c)
+	return c
+}
+
+// Gauge registers a gauge with the given label names
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(help, labels)}
+	r.register(name, g)
+	return g
+}
+
+// Histogram registers a histogram with the given upper bounds and label names
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	h := &HistogramVec{help: help, labels: labels, buckets: bounds, series: make(map[string]*histogram)}
+	r.register(name, h)
+	return h
+}
+
+// CounterFunc registers a counter whose value is read from fn when written
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcFamily{kind: "counter", help: help, fn: fn})
+}
+
+// GaugeFunc registers a gauge whose value is read from fn when written
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcFamily{kind: "gauge", help: help, fn: fn})
+}
+
+// OnCollect registers fn to run before the metrics are written, e.g. to
+// read a value several function metrics report once per scrape
+func (r *Registry) OnCollect(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, fn)
+}
+
+// WriteText writes all metrics sorted by name
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := r.collectors
+	r.mu.Unlock()
+	for _, collect := range collectors {
+		collect()
+	}
+
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make(map[string]family, len(r.families))
+	for name, f := range r.families {
+		families[name] = f
+	}
+	r.mu.Unlock()
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		families[name].write(bw, name)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP writes the metrics in the text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = r.WriteText(w)
+}
+
+// vec holds float samples keyed by label values
+type vec struct {
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+	keys   map[string][]string
+}
+
+func newVec(help string, labels []string) vec {
+	return vec{help: help, labels: labels, values: make(map[string]float64), keys: make(map[string][]string)}
+}
+
+// add adds delta to the sample with the given label values
+func (v *vec) add(delta float64, values []string) {
+	key := v.key(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.keys[key]; !ok {
+		v.keys[key] = append([]string(nil), values...)
+	}
+	v.values[key] += delta
+}
+
+// set sets the sample with the given label values
+func (v *vec) set(value float64, values []string) {
+	key := v.key(values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.keys[key]; !ok {
+		v.keys[key] = append([]string(nil), values...)
+	}
+	v.values[key] = value
+}
+
+// key identifies a combination of label values, which must match the label names
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(v.labels)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (v *vec) write(w *bufio.Writer, name, kind string) {
+	writeHeader(w, name, v.help, kind)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range sortedKeys(v.keys) {
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(v.labels, v.keys[key], ""), formatValue(v.values[key]))
+	}
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	vec
+}
+
+// Inc adds one to the counter with the given label values
+func (c *CounterVec) Inc(values ...string) {
+	c.add(1, values)
+}
+
+// Add adds delta, which must not be negative, to the counter with the given label values
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.add(delta, values)
+}
+
+func (c *CounterVec) write(w *bufio.Writer, name string) {
+	c.vec.write(w, name, "counter")
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	vec
+}
+
+// Set sets the gauge with the given label values
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.set(value, values)
+}
+
+// Add adds delta to the gauge with the given label values
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.add(delta, values)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer, name string) {
+	g.vec.write(w, name, "gauge")
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogram
+}
+
+// histogram holds the observations of one label combination
+type histogram struct {
+	values []string
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Observe records value in the histogram with the given label values
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	if len(values) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(h.labels)))
+	}
+	key := strings.Join(values, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) write(w *bufio.Writer, name string) {
+	writeHeader(w, name, h.help, "histogram")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(h.labels, s.values, formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(h.labels, s.values, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(h.labels, s.values, ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(h.labels, s.values, ""), s.count)
+	}
+}
+
+// funcFamily is an unlabeled metric read from a function
+type funcFamily struct {
+	kind string
+	help string
+	fn   func() float64
+}
+
+func (f *funcFamily) write(w *bufio.Writer, name string) {
+	writeHeader(w, name, f.help, f.kind)
+	fmt.Fprintf(w, "%s %s\n", name, formatValue(f.fn()))
+}
+
+// writeHeader writes the HELP and TYPE lines of a family
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelEscaper escapes label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats label pairs, adding le if it is set
+func formatLabels(names, values []string, le string) string {
+	if len(names) == 0 && le == "" {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatValue formats a sample value
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
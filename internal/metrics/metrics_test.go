@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("requests_total", "Requests served.", "route", "status")
+	requests.Inc("/a", "200")
+	requests.Inc("/a", "200")
+	requests.Add(3, `/b"`, "500")
+	inFlight := r.Gauge("in_flight", "Requests in flight.")
+	inFlight.Add(2)
+	inFlight.Add(-1)
+	duration := r.Histogram("duration_seconds", "Request duration.", []float64{1, 0.1}, "route")
+	duration.Observe(0.05, "/a")
+	duration.Observe(0.5, "/a")
+	duration.Observe(5, "/a")
+	r.GaugeFunc("jobs_active", "Active jobs.", func() float64 { return 4 })
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+
+	expected := `# HELP duration_seconds Request duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/a",le="0.1"} 1
+duration_seconds_bucket{route="/a",le="1"} 2
+duration_seconds_bucket{route="/a",le="+Inf"} 3
+duration_seconds_sum{route="/a"} 5.55
+duration_seconds_count{route="/a"} 3
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 1
+# HELP jobs_active Active jobs.
+# TYPE jobs_active gauge
+jobs_active 4
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="/a",status="200"} 2
+requests_total{route="/b\"",status="500"} 3
+`
+	if b.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+func TestDuplicateMetric(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("requests_total", "Requests served.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a metric twice to panic")
+		}
+	}()
+	r.Gauge("requests_total", "Requests served.")
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.CounterFunc("hits_total", "Cache hits.", func() float64 { return 7 })
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Expected content type %s, got %s", ContentType, got)
+	}
+	if !strings.Contains(rec.Body.String(), "hits_total 7\n") {
+		t.Errorf("Expected hits_total sample, got %s", rec.Body.String())
+	}
+}
+
+func TestOnCollect(t *testing.T) {
+	r := NewRegistry()
+	collected, value := 0, 0.0
+	r.OnCollect(func() {
+		collected++
+		value = float64(collected * 10)
+	})
+	r.GaugeFunc("a", "A.", func() float64 { return value })
+	r.GaugeFunc("b", "B.", func() float64 { return value + 1 })
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+	if collected != 1 || !strings.Contains(b.String(), "a 10\n") || !strings.Contains(b.String(), "b 11\n") {
+		t.Errorf("Expected one collection read by both metrics, got %d:\n%s", collected, b.String())
+	}
+}
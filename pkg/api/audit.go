@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/audit"
+)
+
+// defaultAuditLimit bounds the audit entries returned when no limit is given
+const defaultAuditLimit = 100
+
+// handleAudit lists audit entries, newest first, filtered by repository,
+// actor, operation and time range
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.audit == nil {
+		s.writeError(w, http.StatusNotFound, "Audit log is not enabled")
+		return
+	}
+
+	params := r.URL.Query()
+	query := audit.Query{
+		Repo:      params.Get("repo"),
+		Actor:     params.Get("actor"),
+		Operation: params.Get("operation"),
+		Limit:     defaultAuditLimit,
+	}
+
+	if id := params.Get("id"); id != "" {
+		record, ok := s.registry.Get(id)
+		if !ok {
+			s.writeFailure(w, "", ErrUnknownRepoID)
+			return
+		}
+		query.Repo = record.Repo.Path
+	}
+
+	for name, t := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := params.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, name+" must be an RFC 3339 time")
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			s.writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		query.Limit = limit
+	}
+
+	entries, err := s.audit.Query(query)
+	if err != nil {
+		s.writeFailure(w, "Failed to read audit log", err)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	s.writeSuccess(w, entries)
+}
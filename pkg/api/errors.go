@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/jobs"
+)
+
+// Error codes returned in the code field of error responses
+const (
+	CodeBadRequest        = "bad_request"
+	CodeInvalidArgument   = "invalid_argument"
+	CodeNotARepository    = "not_a_repository"
+	CodeAuthRequired      = "auth_required"
+	CodeForbidden         = "forbidden"
+	CodePolicyDenied      = "policy_denied"
+	CodeNotFound          = "not_found"
+	CodeRepoNotFound      = "repo_not_found"
+	CodeRefNotFound       = "ref_not_found"
+	CodeJobNotFound       = "job_not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeConflict          = "conflict"
+	CodeNonFastForward    = "non_fast_forward"
+	CodeDirtyWorktree     = "dirty_worktree"
+	CodeAlreadyExists     = "already_exists"
+	CodeNotFullyMerged    = "not_fully_merged"
+	CodeJobFinished       = "job_finished"
+	CodeLocked            = "locked"
+	CodeInternal          = "internal"
+	CodeNotImplemented    = "not_implemented"
+	CodeUnsupportedGit    = "unsupported_git_version"
+	CodeRemoteUnavailable = "remote_unavailable"
+	CodeTimeout           = "timeout"
+	CodeCanceled          = "canceled"
+)
+
+// errorMappings maps sentinel errors to HTTP statuses and error codes.
+// The first match wins.
+var errorMappings = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrOutsideWorkspace, http.StatusForbidden, CodeForbidden},
+	{ErrUnknownRepoID, http.StatusNotFound, CodeRepoNotFound},
+	{jobs.ErrNotFound, http.StatusNotFound, CodeJobNotFound},
+	{jobs.ErrFinished, http.StatusConflict, CodeJobFinished},
+	{core.ErrPolicyDenied, http.StatusForbidden, CodePolicyDenied},
+	{core.ErrInvalidArgument, http.StatusBadRequest, CodeInvalidArgument},
+	{core.ErrNotARepository, http.StatusBadRequest, CodeNotARepository},
+	{core.ErrAuthRequired, http.StatusUnauthorized, CodeAuthRequired},
+	{core.ErrRefNotFound, http.StatusNotFound, CodeRefNotFound},
+	{core.ErrConflict, http.StatusConflict, CodeConflict},
+	{core.ErrNonFastForward, http.StatusConflict, CodeNonFastForward},
+	{core.ErrDirtyWorktree, http.StatusConflict, CodeDirtyWorktree},
+	{core.ErrAlreadyExists, http.StatusConflict, CodeAlreadyExists},
+	{core.ErrNotFullyMerged, http.StatusConflict, CodeNotFullyMerged},
+	{core.ErrLocked, http.StatusLocked, CodeLocked},
+	{core.ErrRemoteUnreachable, http.StatusBadGateway, CodeRemoteUnavailable},
+	{core.ErrNotImplemented, http.StatusNotImplemented, CodeNotImplemented},
+	{core.ErrUnsupportedGitVersion, http.StatusNotImplemented, CodeUnsupportedGit},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, CodeTimeout},
+	{context.Canceled, http.StatusServiceUnavailable, CodeCanceled},
+}
+
+// errorStatus returns the HTTP status and error code describing err
+func errorStatus(err error) (int, string) {
+	for _, m := range errorMappings {
+		if errors.Is(err, m.err) {
+			return m.status, m.code
+		}
+	}
+	return http.StatusInternalServerError, CodeInternal
+}
+
+// statusCode returns the generic error code for an HTTP status
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeAuthRequired
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusLocked:
+		return CodeLocked
+	case http.StatusNotImplemented:
+		return CodeNotImplemented
+	case http.StatusBadGateway:
+		return CodeRemoteUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	default:
+		return CodeInternal
+	}
+}
+
+// writeFailure writes an error response whose status and code are derived from err.
+// prefix, if set, is prepended to the error message.
+func (s *Server) writeFailure(w http.ResponseWriter, prefix string, err error) {
+	status, code := errorStatus(err)
+	message := err.Error()
+	if prefix != "" {
+		message = fmt.Sprintf("%s: %v", prefix, err)
+	}
+
+	s.writeJSON(w, status, Response{
+		Success: false,
+		Error:   message,
+		Code:    code,
+		Hint:    authHint(err),
+	})
+}
+
+// authHint returns the authentication guidance attached to err, if any
+func authHint(err error) *core.AuthHint {
+	var gitErr *core.GitError
+	if errors.As(err, &gitErr) {
+		return gitErr.Hint
+	}
+	return nil
+}
+
+// invalidRequest reports a malformed request as an invalid argument
+func invalidRequest(message string) error {
+	return &core.GitError{Kind: core.ErrInvalidArgument, Message: message}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/index"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/jobs"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/policy"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"outside workspace", ErrOutsideWorkspace, http.StatusForbidden, CodeForbidden},
+		{"policy denied", &core.GitError{Op: "raw", Kind: core.ErrPolicyDenied}, http.StatusForbidden, CodePolicyDenied},
+		{"unknown repo", ErrUnknownRepoID, http.StatusNotFound, CodeRepoNotFound},
+		{"unknown job", jobs.ErrNotFound, http.StatusNotFound, CodeJobNotFound},
+		{"finished job", jobs.ErrFinished, http.StatusConflict, CodeJobFinished},
+		{"wrapped not a repository", fmt.Errorf("failed to open repository: %w", &core.GitError{Kind: core.ErrNotARepository}), http.StatusBadRequest, CodeNotARepository},
+		{"auth", &core.GitError{Op: "push", Kind: core.ErrAuthRequired}, http.StatusUnauthorized, CodeAuthRequired},
+		{"non-fast-forward", &core.GitError{Op: "push", Kind: core.ErrNonFastForward}, http.StatusConflict, CodeNonFastForward},
+		{"locked", &core.GitError{Kind: core.ErrLocked}, http.StatusLocked, CodeLocked},
+		{"remote unreachable", &core.GitError{Kind: core.ErrRemoteUnreachable}, http.StatusBadGateway, CodeRemoteUnavailable},
+		{"not implemented", core.ErrNotImplemented, http.StatusNotImplemented, CodeNotImplemented},
+		{"timeout", fmt.Errorf("git command interrupted: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, CodeTimeout},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := errorStatus(tt.err)
+			if status != tt.status || code != tt.code {
+				t.Errorf("Expected %d %s, got %d %s", tt.status, tt.code, status, code)
+			}
+		})
+	}
+}
+
+func TestErrorResponseCode(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/repos/unknown/status", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", rec.Code)
+	}
+
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if resp.Success || resp.Code != CodeRepoNotFound {
+		t.Errorf("Expected %s error, got %+v", CodeRepoNotFound, resp)
+	}
+}
+
+func TestRawPolicy(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	workspace, err := NewWorkspace([]string{root})
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+	registry, err := index.OpenRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatalf("OpenRegistry failed: %v", err)
+	}
+	commits, err := index.OpenCommitIndex(filepath.Join(t.TempDir(), "commits"))
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+	rawPolicy := &policy.Policy{
+		Default:  policy.ReadOnlyProfile,
+		Profiles: map[string]*policy.Profile{"admin": {Subcommands: []string{"*"}}},
+		Callers:  map[string]*policy.Caller{"admin": {Token: "secret", Profile: "admin"}},
+	}
+	s, err := NewServer("127.0.0.1:0", WithWorkspace(workspace), WithRegistry(registry), WithCommitIndex(commits), WithPolicy(rawPolicy))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(s.jobs.Close)
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		code   string
+	}{
+		{"unknown token", "wrong", http.StatusUnauthorized, CodeAuthRequired},
+		{"read-only default", "", http.StatusForbidden, CodePolicyDenied},
+		{"admin", "secret", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"path": %q, "args": ["config", "user.name", "Policy Test"]}`, root)
+			req := httptest.NewRequest(http.MethodPost, "/v1/raw", strings.NewReader(body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(rec, req)
+
+			var resp Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Invalid JSON: %v", err)
+			}
+			if rec.Code != tt.status || resp.Code != tt.code {
+				t.Errorf("Expected %d %s, got %d %s: %s", tt.status, tt.code, rec.Code, resp.Code, resp.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/events"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/jobs"
+)
+
+const (
+	// defaultWatchInterval is how often watched repositories are polled
+	defaultWatchInterval = time.Second
+	// eventHeartbeat keeps idle streams alive through proxies
+	eventHeartbeat = 15 * time.Second
+)
+
+// watchTargets returns the registered repositories for the watcher
+func (s *Server) watchTargets() []events.Target {
+	records := s.registry.List()
+	targets := make([]events.Target, 0, len(records))
+	for _, record := range records {
+		targets = append(targets, events.Target{
+			RepoID:  record.ID,
+			GitDir:  record.Repo.GitDir,
+			WorkDir: record.Repo.WorkDir,
+			IsBare:  record.Repo.IsBare,
+		})
+	}
+	return targets
+}
+
+// publishJob forwards job state changes to the event bus
+func (s *Server) publishJob(job jobs.Job) {
+	eventType := events.TypeJobStarted
+	if job.State.Done() {
+		eventType = events.TypeJobFinished
+	}
+
+	s.events.Publish(events.Event{
+		Type:   eventType,
+		RepoID: job.RepoID,
+		Data: map[string]interface{}{
+			"jobId": job.ID,
+			"kind":  job.Kind,
+			"state": job.State,
+			"error": job.Error,
+		},
+	})
+}
+
+// eventFilter selects the events a stream client asked for
+type eventFilter struct {
+	repoID string
+	types  map[string]bool
+}
+
+// newEventFilter builds a filter from the id and types query parameters
+func newEventFilter(r *http.Request) eventFilter {
+	filter := eventFilter{repoID: r.URL.Query().Get("id")}
+	if types := r.URL.Query().Get("types"); types != "" {
+		filter.types = make(map[string]bool)
+		for _, t := range strings.Split(types, ",") {
+			filter.types[strings.TrimSpace(t)] = true
+		}
+	}
+	return filter
+}
+
+// Match reports whether event passes the filter
+func (f eventFilter) Match(event events.Event) bool {
+	if f.repoID != "" && event.RepoID != f.repoID {
+		return false
+	}
+	if f.types != nil && !f.types[event.Type] {
+		return false
+	}
+	return true
+}
+
+// lastEventID returns the ID a reconnecting client has already seen
+func lastEventID(r *http.Request) uint64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	id, _ := strconv.ParseUint(value, 10, 64)
+	return id
+}
+
+// handleEvents streams repository and job events as Server-Sent Events
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The server's write timeout doesn't apply to long-lived streams
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	filter := newEventFilter(r)
+	stream, unsubscribe := s.events.Subscribe(lastEventID(r))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+			if !filter.Match(event) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// handleEventsWebSocket streams repository and job events over a WebSocket
+func (s *Server) handleEventsWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !isWebSocketUpgrade(r) {
+		s.writeError(w, http.StatusBadRequest, "WebSocket upgrade required")
+		return
+	}
+
+	filter := newEventFilter(r)
+	lastID := lastEventID(r)
+
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	stream, unsubscribe := s.events.Subscribe(lastID)
+	defer unsubscribe()
+
+	// Read client frames to answer pings and notice close requests
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := conn.ReadFrame()
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsOpPing:
+				_ = conn.WriteFrame(wsOpPong, payload)
+			case wsOpClose:
+				_ = conn.WriteFrame(wsOpClose, payload)
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteFrame(wsOpPing, nil); err != nil {
+				return
+			}
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+			if !filter.Match(event) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := conn.WriteFrame(wsOpText, data); err != nil {
+				return
+			}
+		}
+	}
+}
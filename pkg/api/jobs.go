@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/internal/logging"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/jobs"
+)
+
+const (
+	// defaultJobRetention is how long finished jobs remain queryable
+	defaultJobRetention = time.Hour
+	// cloneJobTimeout bounds clone jobs
+	cloneJobTimeout = 30 * time.Minute
+	// syncJobTimeout bounds fetch, pull and push jobs
+	syncJobTimeout = 10 * time.Minute
+	// gcJobTimeout bounds garbage collection jobs
+	gcJobTimeout = 30 * time.Minute
+)
+
+// submitJob runs fn asynchronously and responds with 202 Accepted.
+// Git stderr produced while the job runs is streamed into the job's
+// progress and logs, and the job's log lines carry the ID of request r.
+// The job runs on behalf of the caller of r.
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request, kind, repoID string, timeout time.Duration, fn jobs.Func) {
+	requestID := logging.RequestIDFromContext(r.Context())
+	caller := core.CallerFromContext(r.Context())
+	job := s.jobs.Submit(kind, repoID, timeout, func(ctx context.Context, task *jobs.Task) (interface{}, error) {
+		ctx = core.WithCaller(logging.WithRequestID(ctx, requestID), caller)
+		ctx = s.workspaceContext(ctx)
+		result, err := fn(executil.WithProgressWriter(ctx, task), task)
+		if err != nil {
+			_, code := errorStatus(err)
+			task.SetErrorCode(code)
+			if hint := authHint(err); hint != nil {
+				task.SetErrorHint(hint)
+			}
+		}
+		return result, err
+	})
+
+	s.logger.WithContext(r.Context()).Info("Job submitted", map[string]interface{}{
+		"id":     job.ID,
+		"kind":   kind,
+		"repoId": repoID,
+	})
+
+	w.Header().Set("Location", "/v1/jobs/"+job.ID)
+	s.writeJSON(w, http.StatusAccepted, Response{
+		Success: true,
+		Data:    job,
+	})
+}
+
+// handleJobs handles job listing requests
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	s.writeSuccess(w, s.jobs.List())
+}
+
+// handleJob handles job status and cancellation requests
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		job, err := s.jobs.Get(id)
+		if err != nil {
+			s.writeFailure(w, "", err)
+			return
+		}
+		s.writeSuccess(w, job)
+	case http.MethodDelete:
+		job, err := s.jobs.Cancel(id)
+		if err != nil {
+			s.writeFailure(w, "", err)
+			return
+		}
+		s.writeJSON(w, http.StatusAccepted, Response{
+			Success: true,
+			Data:    job,
+		})
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// GCRequest represents a garbage collection request
+type GCRequest struct {
+	Path       string `json:"path,omitempty"`
+	ID         string `json:"id,omitempty"`
+	Aggressive bool   `json:"aggressive,omitempty"`
+	Prune      bool   `json:"prune,omitempty"`
+}
+
+// handleGC handles garbage collection requests
+func (s *Server) handleGC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req GCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON request")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	repoID := repoIDParam(r, req.ID)
+	repo, err := s.openRepo(ctx, req.Path, repoID)
+	if err != nil {
+		s.writeFailure(w, "", err)
+		return
+	}
+
+	s.submitJob(w, r, "gc", repoID, gcJobTimeout, func(ctx context.Context, task *jobs.Task) (interface{}, error) {
+		if err := s.git.GC(ctx, repo, req.Aggressive, req.Prune); err != nil {
+			return nil, fmt.Errorf("gc failed: %w", err)
+		}
+		return map[string]string{"message": "Garbage collection completed successfully"}, nil
+	})
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/metrics"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/index"
+)
+
+// httpMetrics count requests and their latency by route, method and status
+type httpMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+// registerMetrics registers the HTTP, job and cache metrics of the server
+func (s *Server) registerMetrics() {
+	s.http = &httpMetrics{
+		requests: s.metrics.Counter("gitmgr_http_requests_total",
+			"HTTP requests served, by route, method and status.", "route", "method", "status"),
+		duration: s.metrics.Histogram("gitmgr_http_request_duration_seconds",
+			"HTTP request latency, by route, method and status.", metrics.DefaultBuckets, "route", "method", "status"),
+	}
+
+	s.metrics.GaugeFunc("gitmgr_jobs_active", "Queued and running jobs.", func() float64 {
+		return float64(s.jobs.Active())
+	})
+
+	if s.audit != nil {
+		s.metrics.CounterFunc("gitmgr_audit_failures_total", "Audit entries that could not be written.", func() float64 {
+			return float64(s.audit.Stats().Failures)
+		})
+		s.metrics.CounterFunc("gitmgr_audit_chain_breaks_total", "Invalid entries removed from the end of the audit log.", func() float64 {
+			return float64(s.audit.Stats().ChainBreaks)
+		})
+	}
+
+	if s.cache != nil {
+		// Listing the entries walks the store, so it is done once per scrape
+		var stats atomic.Pointer[index.CacheStats]
+		stats.Store(&index.CacheStats{})
+		s.metrics.OnCollect(func() {
+			current := s.cache.Stats()
+			stats.Store(&current)
+		})
+		s.metrics.CounterFunc("gitmgr_cache_hits_total", "Repository metadata cache hits.", func() float64 {
+			return float64(stats.Load().Hits)
+		})
+		s.metrics.CounterFunc("gitmgr_cache_misses_total", "Repository metadata cache misses.", func() float64 {
+			return float64(stats.Load().Misses)
+		})
+		s.metrics.CounterFunc("gitmgr_cache_evictions_total", "Repository metadata cache entries removed by pruning.", func() float64 {
+			return float64(stats.Load().Evictions)
+		})
+		s.metrics.GaugeFunc("gitmgr_cache_entries", "Repository metadata cache entries.", func() float64 {
+			return float64(stats.Load().Entries)
+		})
+		s.metrics.GaugeFunc("gitmgr_cache_bytes", "Size of the repository metadata cache entries in bytes.", func() float64 {
+			return float64(stats.Load().Bytes)
+		})
+	}
+}
+
+// standardMethods are the request methods counted by name. Others are
+// counted as "other", so clients cannot add label series without bound.
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// methodLabel returns the method label of a request
+func methodLabel(method string) string {
+	if standardMethods[method] {
+		return method
+	}
+	return "other"
+}
+
+// instrument records the requests handled for route
+func (s *Server) instrument(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		handler(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		duration := time.Since(start)
+		labels := []string{route, methodLabel(r.Method), strconv.Itoa(status)}
+		s.http.requests.Inc(labels...)
+		s.http.duration.Observe(duration.Seconds(), labels...)
+
+		s.logger.WithContext(r.Context()).Debug("Request served", map[string]interface{}{
+			"method":   r.Method,
+			"path":     r.URL.Path,
+			"status":   status,
+			"duration": duration.String(),
+		})
+	}
+}
+
+// handleMetrics serves the metrics in the Prometheus text exposition format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	s.metrics.ServeHTTP(w, r)
+}
+
+// statusRecorder remembers the status written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Hijack records the switch to the WebSocket protocol
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil && r.status == 0 {
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
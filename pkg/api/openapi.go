@@ -0,0 +1,495 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/audit"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/index"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/jobs"
+)
+
+// paramSpec describes a query or path parameter
+type paramSpec struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+// responseSpec describes one response of an operation.
+// Data is a sample of the type carried in Response.Data; nil means no data.
+type responseSpec struct {
+	Status      int
+	Description string
+	Data        interface{}
+	ContentType string
+}
+
+// operationSpec describes a single method on a route
+type operationSpec struct {
+	Method    string
+	Summary   string
+	Params    []paramSpec
+	Request   interface{}
+	Responses []responseSpec
+}
+
+var (
+	pathQuery = paramSpec{Name: "path", In: "query", Type: "string", Description: "Repository path (required unless id is given)"}
+	idQuery   = paramSpec{Name: "id", In: "query", Type: "string", Description: "Registered repository ID"}
+	idPath    = paramSpec{Name: "id", In: "path", Type: "string", Required: true, Description: "Registered repository ID"}
+	jobIDPath = paramSpec{Name: "id", In: "path", Type: "string", Required: true, Description: "Job ID"}
+
+	okMessage   = responseSpec{Status: http.StatusOK, Description: "Success", Data: map[string]string{}}
+	jobAccepted = responseSpec{Status: http.StatusAccepted, Description: "Job submitted", Data: jobs.Job{}}
+)
+
+// repoOperations describes the operations available both under /v1/<op>
+// (addressed by path or id) and under /v1/repos/{id}/<op>
+var repoOperations = map[string][]operationSpec{
+	"status": {{
+		Method:    http.MethodGet,
+		Summary:   "Get repository status",
+		Params:    []paramSpec{pathQuery, idQuery},
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Repository status", Data: core.RepoStatus{}}},
+	}},
+	"log": {{
+		Method:    http.MethodGet,
+		Summary:   "Get commit history",
+		Params:    []paramSpec{pathQuery, idQuery, {Name: "max", In: "query", Type: "integer", Description: "Maximum number of commits (default 10)"}},
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Commits, newest first", Data: []core.CommitInfo{}}},
+	}},
+	"diff": {{
+		Method:  http.MethodGet,
+		Summary: "Get diff between commits or the working directory",
+		Params: []paramSpec{
+			pathQuery, idQuery,
+			{Name: "base", In: "query", Type: "string", Description: "Base commit or branch"},
+			{Name: "head", In: "query", Type: "string", Description: "Head commit or branch"},
+			{Name: "stat", In: "query", Type: "boolean", Description: "Only show statistics"},
+		},
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Diff output", Data: map[string]string{}}},
+	}},
+	"fetch": {{Method: http.MethodPost, Summary: "Fetch from a remote", Request: SyncRequest{}, Responses: []responseSpec{jobAccepted}}},
+	"pull":  {{Method: http.MethodPost, Summary: "Pull from a remote", Request: SyncRequest{}, Responses: []responseSpec{jobAccepted}}},
+	"push":  {{Method: http.MethodPost, Summary: "Push to a remote", Request: SyncRequest{}, Responses: []responseSpec{jobAccepted}}},
+	"gc":    {{Method: http.MethodPost, Summary: "Run garbage collection", Request: GCRequest{}, Responses: []responseSpec{jobAccepted}}},
+	"undo": {
+		{
+			Method:    http.MethodGet,
+			Summary:   "List undo snapshots saved before destructive operations, newest first",
+			Params:    []paramSpec{pathQuery, idQuery},
+			Responses: []responseSpec{{Status: http.StatusOK, Description: "Snapshots", Data: []core.Snapshot{}}},
+		},
+		{
+			Method:    http.MethodPost,
+			Summary:   "Restore the refs, HEAD and uncommitted changes saved in a snapshot",
+			Request:   UndoRequest{},
+			Responses: []responseSpec{okMessage},
+		},
+	},
+	"search/commits": {{
+		Method:  http.MethodGet,
+		Summary: "Search the commits of a repository, indexing those added since the last search",
+		Params: []paramSpec{
+			pathQuery, idQuery,
+			{Name: "author", In: "query", Type: "string", Description: "Substring of the author name or email, ignoring case"},
+			{Name: "message", In: "query", Type: "string", Description: "Substring of the commit message, ignoring case"},
+			{Name: "file", In: "query", Type: "string", Description: "File the commit changed, or a directory containing it"},
+			{Name: "since", In: "query", Type: "string", Description: "RFC 3339 time of the oldest author date"},
+			{Name: "until", In: "query", Type: "string", Description: "RFC 3339 time author dates must precede"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of commits (default 100, 0 for all)"},
+		},
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Commits with the files they changed, newest first", Data: []core.CommitInfo{}}},
+	}},
+	"raw": {{
+		Method:    http.MethodPost,
+		Summary:   "Execute a raw git command allowed by the caller's policy profile",
+		Params:    []paramSpec{{Name: "Authorization", In: "header", Type: "string", Description: "Bearer token of a policy caller; anonymous requests get the default profile"}},
+		Request:   RawRequest{},
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Command result", Data: core.ExecResult{}}},
+	}},
+}
+
+// apiRoutes describes every route that is not repository scoped
+var apiRoutes = map[string][]operationSpec{
+	"/health": {{
+		Method:    http.MethodGet,
+		Summary:   "Health check",
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Server health and git capabilities", Data: HealthResponse{}}},
+	}},
+	"/v1/openapi.json": {{
+		Method:    http.MethodGet,
+		Summary:   "This OpenAPI document",
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "OpenAPI 3 document", ContentType: "application/json"}},
+	}},
+	"/v1/repo": {{
+		Method:    http.MethodGet,
+		Summary:   "Get repository information",
+		Params:    []paramSpec{pathQuery, idQuery},
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Repository", Data: RepoResponse{}}},
+	}},
+	"/v1/clone": {{
+		Method:    http.MethodPost,
+		Summary:   "Clone and register a repository",
+		Request:   CloneRequest{},
+		Responses: []responseSpec{jobAccepted},
+	}},
+	"/v1/repos": {
+		{
+			Method:    http.MethodGet,
+			Summary:   "List registered repositories",
+			Responses: []responseSpec{{Status: http.StatusOK, Description: "Registered repositories", Data: []index.RepoRecord{}}},
+		},
+		{
+			Method:  http.MethodPost,
+			Summary: "Register an existing repository, or clone one when url is set",
+			Request: RegisterRequest{},
+			Responses: []responseSpec{
+				{Status: http.StatusCreated, Description: "Repository registered", Data: index.RepoRecord{}},
+				{Status: http.StatusAccepted, Description: "Clone job submitted", Data: jobs.Job{}},
+			},
+		},
+	},
+	"/v1/repos/{id}": {
+		{
+			Method:    http.MethodGet,
+			Summary:   "Get a registered repository and refresh its metadata",
+			Params:    []paramSpec{idPath},
+			Responses: []responseSpec{{Status: http.StatusOK, Description: "Registered repository", Data: index.RepoRecord{}}},
+		},
+		{
+			Method:    http.MethodDelete,
+			Summary:   "Unregister a repository",
+			Params:    []paramSpec{idPath},
+			Responses: []responseSpec{okMessage},
+		},
+	},
+	"/metrics": {{
+		Method:    http.MethodGet,
+		Summary:   "Server metrics",
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Prometheus text exposition format", ContentType: "text/plain"}},
+	}},
+	"/v1/debug/commands": {{
+		Method:    http.MethodGet,
+		Summary:   "Recently run git commands with sanitized arguments, most recent first",
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Commands", Data: []executil.CommandTrace{}}},
+	}},
+	"/v1/audit": {{
+		Method:  http.MethodGet,
+		Summary: "Recorded operations that modify repositories, newest first",
+		Params: []paramSpec{
+			{Name: "repo", In: "query", Type: "string", Description: "Absolute repository path"},
+			idQuery,
+			{Name: "actor", In: "query", Type: "string", Description: "Caller that ran the operation, or anonymous"},
+			{Name: "operation", In: "query", Type: "string", Description: "Operation, e.g. push or raw"},
+			{Name: "since", In: "query", Type: "string", Description: "RFC 3339 time of the oldest entry"},
+			{Name: "until", In: "query", Type: "string", Description: "RFC 3339 time entries must precede"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Maximum number of entries (default 100, 0 for all)"},
+		},
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Audit entries", Data: []audit.Entry{}}},
+	}},
+	"/v1/jobs": {{
+		Method:    http.MethodGet,
+		Summary:   "List jobs without logs, newest first",
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Jobs", Data: []jobs.Job{}}},
+	}},
+	"/v1/jobs/{id}": {
+		{
+			Method:    http.MethodGet,
+			Summary:   "Get job state, progress, result and logs",
+			Params:    []paramSpec{jobIDPath},
+			Responses: []responseSpec{{Status: http.StatusOK, Description: "Job", Data: jobs.Job{}}},
+		},
+		{
+			Method:    http.MethodDelete,
+			Summary:   "Cancel a queued or running job",
+			Params:    []paramSpec{jobIDPath},
+			Responses: []responseSpec{{Status: http.StatusAccepted, Description: "Cancellation requested", Data: jobs.Job{}}},
+		},
+	},
+	"/v1/events": {{
+		Method:  http.MethodGet,
+		Summary: "Server-Sent Events stream of repository and job changes",
+		Params: []paramSpec{
+			{Name: "id", In: "query", Type: "string", Description: "Only events for this repository ID"},
+			{Name: "types", In: "query", Type: "string", Description: "Comma separated event types"},
+		},
+		Responses: []responseSpec{{Status: http.StatusOK, Description: "Event stream", ContentType: "text/event-stream"}},
+	}},
+	"/v1/events/ws": {{
+		Method:  http.MethodGet,
+		Summary: "WebSocket stream of repository and job changes",
+		Params: []paramSpec{
+			{Name: "id", In: "query", Type: "string", Description: "Only events for this repository ID"},
+			{Name: "types", In: "query", Type: "string", Description: "Comma separated event types"},
+		},
+		Responses: []responseSpec{{Status: http.StatusSwitchingProtocols, Description: "WebSocket upgrade"}},
+	}},
+}
+
+// specRoutes returns the operations for every documented route
+func specRoutes() map[string][]operationSpec {
+	routes := make(map[string][]operationSpec, len(apiRoutes)+2*len(repoOperations))
+	for pattern, ops := range apiRoutes {
+		routes[pattern] = ops
+	}
+
+	for name, ops := range repoOperations {
+		routes["/v1/"+name] = ops
+
+		// Repository scoped variants take the ID from the path instead
+		scoped := make([]operationSpec, 0, len(ops))
+		for _, op := range ops {
+			op.Params = scopedParams(op.Params)
+			scoped = append(scoped, op)
+		}
+		routes["/v1/repos/{id}/"+name] = scoped
+	}
+
+	return routes
+}
+
+// scopedParams replaces the path and id query parameters with the id path parameter
+func scopedParams(params []paramSpec) []paramSpec {
+	scoped := []paramSpec{idPath}
+	for _, p := range params {
+		if p.In == "query" && (p.Name == "path" || p.Name == "id") {
+			continue
+		}
+		scoped = append(scoped, p)
+	}
+	return scoped
+}
+
+// schemaBuilder converts Go types to OpenAPI schemas, collecting named
+// structs as reusable components
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// schemaFor returns the schema for t, registering named structs as components
+func (b *schemaBuilder) schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "Duration in nanoseconds"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		name := componentName(t)
+		if _, ok := b.components[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			b.components[name] = nil
+			b.components[name] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema builds an object schema from exported fields and their json tags
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	b.addFields(t, properties, &required)
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the fields of t, flattening embedded structs like encoding/json does
+func (b *schemaBuilder) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				b.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = b.schemaFor(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// componentName derives a schema component name from a Go type
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	switch pkg {
+	case "api", "":
+		return t.Name()
+	default:
+		return strings.ToUpper(pkg[:1]) + pkg[1:] + t.Name()
+	}
+}
+
+// buildOpenAPI generates the OpenAPI 3 document for all documented routes
+func buildOpenAPI() map[string]interface{} {
+	b := &schemaBuilder{components: map[string]interface{}{}}
+	responseRef := b.schemaFor(reflect.TypeOf(Response{}))
+
+	paths := map[string]interface{}{}
+	for pattern, ops := range specRoutes() {
+		item := map[string]interface{}{}
+		for _, op := range ops {
+			item[strings.ToLower(op.Method)] = b.operation(op, responseRef)
+		}
+		paths[pattern] = item
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "gitmgr HTTP API",
+			"version":     "1.0.0",
+			"description": "RESTful endpoints for Git operations. Every JSON response uses the Response envelope.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.components,
+		},
+	}
+}
+
+// operation builds an OpenAPI operation object
+func (b *schemaBuilder) operation(op operationSpec, responseRef map[string]interface{}) map[string]interface{} {
+	operation := map[string]interface{}{"summary": op.Summary}
+
+	if len(op.Params) > 0 {
+		params := make([]interface{}, 0, len(op.Params))
+		for _, p := range op.Params {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          p.In,
+				"required":    p.Required,
+				"description": p.Description,
+				"schema":      map[string]interface{}{"type": p.Type},
+			})
+		}
+		operation["parameters"] = params
+	}
+
+	if op.Request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": b.schemaFor(reflect.TypeOf(op.Request)),
+				},
+			},
+		}
+	}
+
+	responses := map[string]interface{}{
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": responseRef},
+			},
+		},
+	}
+	for _, resp := range op.Responses {
+		response := map[string]interface{}{"description": resp.Description}
+
+		switch {
+		case resp.ContentType != "":
+			response["content"] = map[string]interface{}{
+				resp.ContentType: map[string]interface{}{"schema": map[string]interface{}{}},
+			}
+		case resp.Data != nil:
+			// The Response envelope with data narrowed to the concrete type
+			response["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{
+						"allOf": []interface{}{
+							responseRef,
+							map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"data": b.schemaFor(reflect.TypeOf(resp.Data)),
+								},
+							},
+						},
+					},
+				},
+			}
+		}
+
+		responses[strconv.Itoa(resp.Status)] = response
+	}
+	operation["responses"] = responses
+
+	return operation
+}
+
+// handleOpenAPI serves the generated OpenAPI document
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, buildOpenAPI())
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/index"
+)
+
+// newTestServer creates a server confined to a temporary workspace
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	workspace, err := NewWorkspace([]string{t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+	registry, err := index.OpenRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatalf("OpenRegistry failed: %v", err)
+	}
+
+	commits, err := index.OpenCommitIndex(filepath.Join(t.TempDir(), "commits"))
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+
+	s, err := NewServer("127.0.0.1:0", WithWorkspace(workspace), WithRegistry(registry), WithCommitIndex(commits))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(s.jobs.Close)
+	return s
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	s := newTestServer(t)
+	routes := specRoutes()
+
+	registered := make(map[string]bool)
+	for _, pattern := range s.routes {
+		registered[pattern] = true
+		if _, ok := routes[pattern]; !ok {
+			t.Errorf("Route %s is registered in setupRoutes but missing from the OpenAPI spec", pattern)
+		}
+	}
+
+	for pattern := range routes {
+		if !registered[pattern] {
+			t.Errorf("Route %s is in the OpenAPI spec but not registered in setupRoutes", pattern)
+		}
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var doc struct {
+		OpenAPI    string                            `json:"openapi"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("Expected openapi 3.0.3, got %q", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/v1/repos/{id}/status"]["get"]; !ok {
+		t.Error("Expected GET /v1/repos/{id}/status to be documented")
+	}
+
+	clone, ok := doc.Components.Schemas["CloneRequest"]
+	if !ok {
+		t.Fatal("Expected CloneRequest schema")
+	}
+	for _, field := range []string{"url", "path", "sparse"} {
+		if _, ok := clone.Properties[field]; !ok {
+			t.Errorf("Expected CloneRequest.%s in schema", field)
+		}
+	}
+
+	// Embedded structs are flattened like encoding/json does
+	repo, ok := doc.Components.Schemas["RepoResponse"]
+	if !ok {
+		t.Fatal("Expected RepoResponse schema")
+	}
+	for _, field := range []string{"id", "path", "gitDir"} {
+		if _, ok := repo.Properties[field]; !ok {
+			t.Errorf("Expected RepoResponse.%s in schema", field)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/index"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/jobs"
+)
+
+// RegisterRequest represents a repository registration request.
+// When URL is set the repository is cloned into Path by an asynchronous job.
+type RegisterRequest struct {
+	Path      string   `json:"path"`
+	Name      string   `json:"name,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Branch    string   `json:"branch,omitempty"`
+	Depth     int      `json:"depth,omitempty"`
+	Sparse    []string `json:"sparse,omitempty"`
+	Recursive bool     `json:"recursive,omitempty"`
+}
+
+// registerRepo stores repo in the registry together with fresh metadata
+func (s *Server) registerRepo(ctx context.Context, repo *core.Repo, name string) (index.RepoRecord, error) {
+	record := index.RepoRecord{
+		Name: name,
+		Repo: *repo,
+	}
+	record.Branch, record.Head = s.describeRepo(ctx, repo)
+
+	return s.registry.Add(record)
+}
+
+// describeRepo returns the current branch and HEAD commit, best effort
+func (s *Server) describeRepo(ctx context.Context, repo *core.Repo) (string, string) {
+	branch := ""
+	if !repo.IsBare {
+		if status, err := s.git.GetStatus(ctx, repo); err == nil {
+			branch = status.Branch
+		}
+	}
+
+	// Empty repositories have no HEAD commit yet
+	head, _ := s.git.RevParse(ctx, repo, "HEAD")
+
+	return branch, head
+}
+
+// handleRepos handles listing and registering repositories
+func (s *Server) handleRepos(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeSuccess(w, s.registry.List())
+	case http.MethodPost:
+		s.handleRegisterRepo(w, r)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleRegisterRepo registers an existing repository or clones a new one
+func (s *Server) handleRegisterRepo(w http.ResponseWriter, r *http.Request) {
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON request")
+		return
+	}
+
+	target, err := s.resolveRepoPath(req.Path)
+	if err != nil {
+		s.writeFailure(w, "", err)
+		return
+	}
+
+	if req.URL != "" {
+		if err := s.checkCloneSource(req.URL, target); err != nil {
+			s.writeFailure(w, "", err)
+			return
+		}
+		opts := core.CloneOptions{
+			URL:       req.URL,
+			Path:      target,
+			Branch:    req.Branch,
+			Depth:     req.Depth,
+			Sparse:    req.Sparse,
+			Recursive: req.Recursive,
+			Progress:  true,
+		}
+
+		// Cloning can take minutes, so it runs as a job whose result is the record
+		s.submitJob(w, r, "clone", "", cloneJobTimeout, func(ctx context.Context, task *jobs.Task) (interface{}, error) {
+			repo, err := s.git.Clone(ctx, opts)
+			if err != nil {
+				return nil, fmt.Errorf("clone failed: %w", err)
+			}
+			return s.registerRepo(ctx, repo, req.Name)
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	repo, err := s.openConfined(ctx, target)
+	if err != nil {
+		s.writeFailure(w, "Failed to open repository", err)
+		return
+	}
+
+	record, err := s.registerRepo(ctx, repo, req.Name)
+	if err != nil {
+		s.writeFailure(w, "Failed to register repository", err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Data:    record,
+	})
+}
+
+// handleRepoByID handles fetching and unregistering a single repository
+func (s *Server) handleRepoByID(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+
+		repo, err := s.openRepo(ctx, "", id)
+		if err != nil {
+			s.writeFailure(w, "", err)
+			return
+		}
+
+		// Refresh cached metadata on direct lookups
+		branch, head := s.describeRepo(ctx, repo)
+		record, err := s.registry.Update(id, func(record *index.RepoRecord) {
+			record.Branch = branch
+			record.Head = head
+		})
+		if err != nil {
+			s.writeFailure(w, "Failed to update repository", err)
+			return
+		}
+
+		s.writeSuccess(w, record)
+	case http.MethodDelete:
+		removed, err := s.registry.Remove(id)
+		if err != nil {
+			s.writeFailure(w, "Failed to unregister repository", err)
+			return
+		}
+		if !removed {
+			s.writeFailure(w, "", ErrUnknownRepoID)
+			return
+		}
+
+		s.writeSuccess(w, map[string]string{"message": "Repository unregistered"})
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/index"
+)
+
+// defaultSearchLimit bounds the commits returned when no limit is given
+const defaultSearchLimit = 100
+
+// handleSearchCommits brings the commit index of a repository up to date
+// and lists the indexed commits, newest first, filtered by author, message,
+// changed file and time range
+func (s *Server) handleSearchCommits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+	query := index.CommitQuery{
+		Author:  params.Get("author"),
+		Message: params.Get("message"),
+		Path:    params.Get("file"),
+		Limit:   defaultSearchLimit,
+	}
+
+	for name, t := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := params.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, name+" must be an RFC 3339 time")
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			s.writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		query.Limit = limit
+	}
+
+	// Indexing a large repository for the first time reads its whole history
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	defer cancel()
+
+	repo, err := s.openRepo(ctx, params.Get("path"), repoIDParam(r, params.Get("id")))
+	if err != nil {
+		s.writeFailure(w, "", err)
+		return
+	}
+
+	if _, err := s.commits.Update(ctx, s.git, repo); err != nil {
+		s.writeFailure(w, "Failed to index commits", err)
+		return
+	}
+	commits, err := s.commits.Search(repo.Path, query)
+	if err != nil {
+		s.writeFailure(w, "Failed to search commits", err)
+		return
+	}
+	s.writeSuccess(w, commits)
+}
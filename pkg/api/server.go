@@ -2,33 +2,234 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
 	"github.com/felipemacedo1/go-coregit-pe/internal/logging"
+	"github.com/felipemacedo1/go-coregit-pe/internal/metrics"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/audit"
 	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
 	"github.com/felipemacedo1/go-coregit-pe/pkg/core/execgit"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/events"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/index"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/jobs"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/policy"
 )
 
 // Server provides HTTP API for Git operations
 type Server struct {
-	git    core.CoreGit
-	logger *logging.Logger
-	server *http.Server
+	git       core.CoreGit
+	policy    *policy.Policy
+	commands  *executil.RingTracer
+	metrics   *metrics.Registry
+	http      *httpMetrics
+	cache     *index.Cache
+	prune     time.Duration
+	audit     *audit.Log
+	logger    *logging.Logger
+	server    *http.Server
+	workspace *Workspace
+	registry  *index.Registry
+	commits   *index.CommitIndex
+	jobs      *jobs.Manager
+	events    *events.Bus
+	watcher   *events.Watcher
+	interval  time.Duration
+	stopWatch context.CancelFunc
+	routes    []string
 }
 
-// NewServer creates a new API server
-func NewServer(addr string) *Server {
-	git := execgit.New()
-	logger := logging.NewLogger(nil, false)
+// Option configures a Server
+type Option func(*Server)
 
+// WithGit sets the Git implementation used to serve requests.
+// It is responsible for enforcing the raw command policy, e.g. with
+// execgit.WithPolicy.
+func WithGit(git core.CoreGit) Option {
+	return func(s *Server) {
+		s.git = git
+	}
+}
+
+// WithLogger sets the logger of the server. Entries about a request carry
+// its request ID.
+func WithLogger(logger *logging.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithPolicy sets the policy whose callers may authenticate to /v1/raw
+// with a bearer token
+func WithPolicy(p *policy.Policy) Option {
+	return func(s *Server) {
+		s.policy = p
+	}
+}
+
+// WithCommandTrace serves the commands recorded by ring at
+// /v1/debug/commands. The Git implementation must report to ring, e.g. with
+// execgit.WithTracer.
+func WithCommandTrace(ring *executil.RingTracer) Option {
+	return func(s *Server) {
+		s.commands = ring
+	}
+}
+
+// WithMetrics serves the metrics in registry at /metrics and adds the
+// server's own. The Git implementation must report its commands to it, e.g.
+// with execgit.WithTracer(executil.NewMetricsTracer(registry)).
+func WithMetrics(registry *metrics.Registry) Option {
+	return func(s *Server) {
+		s.metrics = registry
+	}
+}
+
+// WithCache serves branches, remotes, status and history from cache,
+// prunes it while the server runs and reports its statistics at /metrics
+func WithCache(cache *index.Cache) Option {
+	return func(s *Server) {
+		s.cache = cache
+	}
+}
+
+// WithCachePruneInterval sets how often the cache is pruned, 0 disables it
+func WithCachePruneInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.prune = interval
+	}
+}
+
+// WithAuditLog records the operations modifying repositories in log and
+// serves it at /v1/audit
+func WithAuditLog(log *audit.Log) Option {
+	return func(s *Server) {
+		s.audit = log
+	}
+}
+
+// WithWorkspace confines all repository paths to the given workspace
+func WithWorkspace(workspace *Workspace) Option {
+	return func(s *Server) {
+		s.workspace = workspace
+	}
+}
+
+// WithRegistry sets the repository registry used to resolve repository IDs
+func WithRegistry(registry *index.Registry) Option {
+	return func(s *Server) {
+		s.registry = registry
+	}
+}
+
+// WithCommitIndex sets the commit index serving /v1/search/commits
+func WithCommitIndex(commits *index.CommitIndex) Option {
+	return func(s *Server) {
+		s.commits = commits
+	}
+}
+
+// WithJobRetention sets how long finished jobs remain queryable
+func WithJobRetention(retention time.Duration) Option {
+	return func(s *Server) {
+		s.jobs = jobs.NewManager(retention)
+	}
+}
+
+// WithWatchInterval sets how often registered repositories are polled for changes
+func WithWatchInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.interval = interval
+	}
+}
+
+// NewServer creates a new API server.
+// Without WithWorkspace, paths are confined to the current working directory.
+// Without WithRegistry, the registry in ~/.gitmgr/registry.json is used.
+// Without WithCommitIndex, the commit index in the default cache directory
+// is used.
+// Without WithPolicy, raw commands are limited to the read-only profile.
+// Without WithGit, the commands it runs are recorded for /v1/debug/commands
+// and /metrics.
+func NewServer(addr string, opts ...Option) (*Server, error) {
 	s := &Server{
-		git:    git,
-		logger: logger,
+		logger: logging.NewLogger(nil, false),
+		prune:  index.DefaultPruneInterval,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.policy == nil {
+		s.policy = policy.Default()
+	}
+	if s.metrics == nil {
+		s.metrics = metrics.NewRegistry()
+	}
+	if s.git == nil {
+		if s.commands == nil {
+			s.commands = executil.NewRingTracer(executil.DefaultRingSize)
+		}
+		s.git = execgit.New(
+			execgit.WithPolicy(s.policy),
+			execgit.WithLogger(s.logger),
+			execgit.WithTracer(s.commands),
+			execgit.WithTracer(executil.NewMetricsTracer(s.metrics)),
+		)
+	}
+	if s.cache != nil {
+		s.git = index.NewCachedGit(s.git, s.cache)
+	}
+	if s.audit != nil {
+		s.git = audit.NewGit(s.git, s.audit, audit.SourceAPI, s.logger)
+	}
+
+	if s.workspace == nil {
+		workspace, err := NewWorkspace([]string{"."})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create default workspace: %w", err)
+		}
+		s.workspace = workspace
+	}
+
+	if s.registry == nil {
+		registry, err := index.NewRegistry()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open repository registry: %w", err)
+		}
+		s.registry = registry
+	}
+
+	if s.commits == nil {
+		commits, err := index.NewCommitIndex()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open commit index: %w", err)
+		}
+		s.commits = commits
+	}
+
+	if s.jobs == nil {
+		s.jobs = jobs.NewManager(defaultJobRetention)
+	}
+
+	if s.interval <= 0 {
+		s.interval = defaultWatchInterval
 	}
+	s.events = events.NewBus()
+	s.watcher = events.NewWatcher(s.events, s.interval, s.watchTargets)
+	s.jobs.Observe(s.publishJob)
+	s.registerMetrics()
 
 	mux := http.NewServeMux()
 	s.setupRoutes(mux)
@@ -40,28 +241,128 @@ func NewServer(addr string) *Server {
 		WriteTimeout: 30 * time.Second,
 	}
 
-	return s
+	return s, nil
+}
+
+// handle registers a route, records its pattern for the OpenAPI coverage
+// check, assigns request IDs, identifies callers and counts its requests
+func (s *Server) handle(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	s.routes = append(s.routes, pattern)
+	mux.HandleFunc(pattern, withRequestID(s.instrument(pattern, s.withCaller(s.withWorkspaceEnv(handler)))))
+}
+
+// withWorkspaceEnv runs the git commands of handler with the discovery
+// limits of the workspace
+func (s *Server) withWorkspaceEnv(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(s.workspaceContext(r.Context())))
+	}
+}
+
+// workspaceContext returns ctx with the discovery limits and the git
+// configuration of the workspace
+func (s *Server) workspaceContext(ctx context.Context) context.Context {
+	ctx = executil.WithEnv(ctx, s.workspace.GitEnv()...)
+	return executil.WithConfigOverrides(ctx, s.workspace.GitConfig()...)
+}
+
+// withCaller passes the caller authenticated by the bearer token of a
+// request to handler, so the operations it runs are attributed to them.
+// Unknown tokens are only rejected by the routes requiring a caller.
+func (s *Server) withCaller(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if caller, ok := s.caller(r); ok && caller != "" {
+			r = r.WithContext(core.WithCaller(r.Context(), caller))
+		}
+		handler(w, r)
+	}
+}
+
+// requestIDPattern matches request IDs accepted from clients
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestID passes the request ID to handler in the request context,
+// from which it reaches log lines and git commands. Clients may set it with
+// the X-Request-ID header; otherwise one is generated. It is echoed in the
+// response.
+func withRequestID(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		handler(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	}
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b[:])
 }
 
 // setupRoutes configures HTTP routes
 func (s *Server) setupRoutes(mux *http.ServeMux) {
 	// Repository operations
-	mux.HandleFunc("/v1/repo", s.handleRepo)
-	mux.HandleFunc("/v1/clone", s.handleClone)
-	mux.HandleFunc("/v1/status", s.handleStatus)
-	mux.HandleFunc("/v1/log", s.handleLog)
-	mux.HandleFunc("/v1/diff", s.handleDiff)
+	s.handle(mux, "/v1/repo", s.handleRepo)
+	s.handle(mux, "/v1/clone", s.handleClone)
+	s.handle(mux, "/v1/status", s.handleStatus)
+	s.handle(mux, "/v1/log", s.handleLog)
+	s.handle(mux, "/v1/diff", s.handleDiff)
 
 	// Sync operations
-	mux.HandleFunc("/v1/fetch", s.handleFetch)
-	mux.HandleFunc("/v1/pull", s.handlePull)
-	mux.HandleFunc("/v1/push", s.handlePush)
+	s.handle(mux, "/v1/fetch", s.handleFetch)
+	s.handle(mux, "/v1/pull", s.handlePull)
+	s.handle(mux, "/v1/push", s.handlePush)
+	s.handle(mux, "/v1/gc", s.handleGC)
 
 	// Raw command execution
-	mux.HandleFunc("/v1/raw", s.handleRaw)
+	s.handle(mux, "/v1/raw", s.handleRaw)
+
+	// Undo snapshots
+	s.handle(mux, "/v1/undo", s.handleUndo)
+
+	// Commit search
+	s.handle(mux, "/v1/search/commits", s.handleSearchCommits)
+
+	// Registered repositories
+	s.handle(mux, "/v1/repos", s.handleRepos)
+	s.handle(mux, "/v1/repos/{id}", s.handleRepoByID)
+	s.handle(mux, "/v1/repos/{id}/status", s.handleStatus)
+	s.handle(mux, "/v1/repos/{id}/log", s.handleLog)
+	s.handle(mux, "/v1/repos/{id}/diff", s.handleDiff)
+	s.handle(mux, "/v1/repos/{id}/fetch", s.handleFetch)
+	s.handle(mux, "/v1/repos/{id}/pull", s.handlePull)
+	s.handle(mux, "/v1/repos/{id}/push", s.handlePush)
+	s.handle(mux, "/v1/repos/{id}/gc", s.handleGC)
+	s.handle(mux, "/v1/repos/{id}/raw", s.handleRaw)
+	s.handle(mux, "/v1/repos/{id}/undo", s.handleUndo)
+	s.handle(mux, "/v1/repos/{id}/search/commits", s.handleSearchCommits)
+
+	// Asynchronous jobs
+	s.handle(mux, "/v1/jobs", s.handleJobs)
+	s.handle(mux, "/v1/jobs/{id}", s.handleJob)
+
+	// Change notifications
+	s.handle(mux, "/v1/events", s.handleEvents)
+	s.handle(mux, "/v1/events/ws", s.handleEventsWebSocket)
+
+	// API description
+	s.handle(mux, "/v1/openapi.json", s.handleOpenAPI)
+
+	// Audit trail
+	s.handle(mux, "/v1/audit", s.handleAudit)
+
+	// Diagnostics
+	s.handle(mux, "/v1/debug/commands", s.handleDebugCommands)
+	s.handle(mux, "/metrics", s.handleMetrics)
 
 	// Health check
-	mux.HandleFunc("/health", s.handleHealth)
+	s.handle(mux, "/health", s.handleHealth)
 }
 
 // Start starts the HTTP server
@@ -69,20 +370,51 @@ func (s *Server) Start() error {
 	s.logger.Info("Starting API server", map[string]interface{}{
 		"addr": s.server.Addr,
 	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopWatch = cancel
+	go s.watcher.Run(ctx)
+	if s.cache != nil && s.prune > 0 {
+		go s.cache.RunJanitor(ctx, s.prune, s.reportPrune)
+	}
+
 	return s.server.ListenAndServe()
 }
 
+// reportPrune logs the outcome of a cache janitor run
+func (s *Server) reportPrune(removed int, err error) {
+	if err != nil {
+		s.logger.Warn("Failed to prune cache", map[string]interface{}{
+			"removed": removed,
+			"error":   err.Error(),
+		})
+		return
+	}
+	s.logger.Debug("Cache pruned", map[string]interface{}{
+		"removed": removed,
+	})
+}
+
 // Stop stops the HTTP server
 func (s *Server) Stop(ctx context.Context) error {
 	s.logger.Info("Stopping API server")
-	return s.server.Shutdown(ctx)
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	// End event streams so Shutdown doesn't wait for them
+	s.events.Close()
+	err := s.server.Shutdown(ctx)
+	s.jobs.Close()
+	return err
 }
 
 // Response represents a standard API response
 type Response struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success bool           `json:"success"`
+	Data    interface{}    `json:"data,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Code    string         `json:"code,omitempty"`
+	Hint    *core.AuthHint `json:"hint,omitempty"`
 }
 
 // writeJSON writes a JSON response
@@ -97,6 +429,7 @@ func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
 	s.writeJSON(w, status, Response{
 		Success: false,
 		Error:   message,
+		Code:    statusCode(status),
 	})
 }
 
@@ -108,6 +441,118 @@ func (s *Server) writeSuccess(w http.ResponseWriter, data interface{}) {
 	})
 }
 
+// RepoResponse describes an opened repository together with its ID
+type RepoResponse struct {
+	ID string `json:"id,omitempty"`
+	*core.Repo
+}
+
+// ErrUnknownRepoID is returned when a repository ID has not been registered
+var ErrUnknownRepoID = errors.New("unknown repository id")
+
+// repoIDParam returns the repository ID from the route, falling back to fallback
+func repoIDParam(r *http.Request, fallback string) string {
+	if id := r.PathValue("id"); id != "" {
+		return id
+	}
+	return fallback
+}
+
+// resolveRepoPath maps a client supplied path to a confined path
+func (s *Server) resolveRepoPath(path string) (string, error) {
+	if path == "" {
+		return "", invalidRequest("path or id is required")
+	}
+
+	resolved, err := s.workspace.Resolve(path)
+	switch {
+	case errors.Is(err, ErrOutsideWorkspace):
+		return "", err
+	case err != nil:
+		return "", invalidRequest(err.Error())
+	}
+
+	return resolved, nil
+}
+
+// openRepo resolves the repository referenced by path or id.
+// Registered repositories are served from the registry without re-opening them.
+func (s *Server) openRepo(ctx context.Context, path, id string) (*core.Repo, error) {
+	if id != "" {
+		record, ok := s.registry.Get(id)
+		if !ok {
+			return nil, ErrUnknownRepoID
+		}
+		// Re-check confinement in case roots or symlinks changed since registration
+		if _, err := s.resolveRepoPath(record.Repo.Path); err != nil {
+			return nil, err
+		}
+		repo := record.Repo
+		if err := s.workspace.CheckRepo(&repo); err != nil {
+			return nil, err
+		}
+		return &repo, nil
+	}
+
+	resolved, err := s.resolveRepoPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := s.openConfined(ctx, resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	return repo, nil
+}
+
+// checkCloneSource rejects local clone sources outside the workspace.
+// Clones run in the parent directory of target.
+func (s *Server) checkCloneSource(url, target string) error {
+	err := s.workspace.CheckSource(url, filepath.Dir(target))
+	if err != nil && !errors.Is(err, ErrOutsideWorkspace) {
+		return invalidRequest(err.Error())
+	}
+	return err
+}
+
+// openConfined opens the repository at a resolved path, failing if git
+// finds its git directory or worktree outside the workspace
+func (s *Server) openConfined(ctx context.Context, resolved string) (*core.Repo, error) {
+	repo, err := s.git.Open(ctx, resolved)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.workspace.CheckRepo(repo); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// HealthResponse reports server health and the git binary in use
+type HealthResponse struct {
+	Status     string             `json:"status"`
+	Time       string             `json:"time"`
+	Git        *core.Capabilities `json:"git,omitempty"`
+	GitError   string             `json:"gitError,omitempty"`
+	AuditError string             `json:"auditError,omitempty"`
+}
+
+// handleDebugCommands lists the most recently run git commands
+func (s *Server) handleDebugCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.commands == nil {
+		s.writeError(w, http.StatusNotFound, "Command tracing is not enabled")
+		return
+	}
+
+	s.writeSuccess(w, s.commands.Commands())
+}
+
 // handleHealth handles health check requests
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -115,10 +560,27 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.writeSuccess(w, map[string]string{
-		"status": "healthy",
-		"time":   time.Now().UTC().Format(time.RFC3339),
-	})
+	health := HealthResponse{
+		Status: "healthy",
+		Time:   time.Now().UTC().Format(time.RFC3339),
+	}
+
+	caps, err := s.git.Capabilities(r.Context())
+	if err != nil {
+		health.Status = "degraded"
+		health.GitError = err.Error()
+	}
+	health.Git = caps
+
+	// Operations are not recorded while the audit log cannot be written
+	if s.audit != nil {
+		if stats := s.audit.Stats(); stats.LastError != "" {
+			health.Status = "degraded"
+			health.AuditError = stats.LastError
+		}
+	}
+
+	s.writeSuccess(w, health)
 }
 
 // handleRepo handles repository info requests
@@ -128,22 +590,21 @@ func (s *Server) handleRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	path := r.URL.Query().Get("path")
-	if path == "" {
-		s.writeError(w, http.StatusBadRequest, "path parameter is required")
-		return
-	}
-
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	repo, err := s.git.Open(ctx, path)
+	repo, err := s.openRepo(ctx, r.URL.Query().Get("path"), repoIDParam(r, r.URL.Query().Get("id")))
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to open repository: %v", err))
+		s.writeFailure(w, "", err)
 		return
 	}
 
-	s.writeSuccess(w, repo)
+	response := RepoResponse{Repo: repo}
+	if record, ok := s.registry.Get(index.RepoID(repo.Path)); ok {
+		response.ID = record.ID
+	}
+
+	s.writeSuccess(w, response)
 }
 
 // CloneRequest represents a clone request
@@ -174,12 +635,19 @@ func (s *Server) handleClone(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
-	defer cancel()
+	target, err := s.resolveRepoPath(req.Path)
+	if err != nil {
+		s.writeFailure(w, "", err)
+		return
+	}
+	if err := s.checkCloneSource(req.URL, target); err != nil {
+		s.writeFailure(w, "", err)
+		return
+	}
 
 	opts := core.CloneOptions{
 		URL:       req.URL,
-		Path:      req.Path,
+		Path:      target,
 		Branch:    req.Branch,
 		Depth:     req.Depth,
 		Sparse:    req.Sparse,
@@ -187,13 +655,19 @@ func (s *Server) handleClone(w http.ResponseWriter, r *http.Request) {
 		Progress:  true,
 	}
 
-	repo, err := s.git.Clone(ctx, opts)
-	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Clone failed: %v", err))
-		return
-	}
+	s.submitJob(w, r, "clone", "", cloneJobTimeout, func(ctx context.Context, task *jobs.Task) (interface{}, error) {
+		repo, err := s.git.Clone(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("clone failed: %w", err)
+		}
 
-	s.writeSuccess(w, repo)
+		record, err := s.registerRepo(ctx, repo, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to register repository: %w", err)
+		}
+
+		return RepoResponse{ID: record.ID, Repo: repo}, nil
+	})
 }
 
 // handleStatus handles repository status requests
@@ -203,28 +677,22 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	path := r.URL.Query().Get("path")
-	if path == "" {
-		s.writeError(w, http.StatusBadRequest, "path parameter is required")
-		return
-	}
-
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	repo, err := s.git.Open(ctx, path)
+	repo, err := s.openRepo(ctx, r.URL.Query().Get("path"), repoIDParam(r, r.URL.Query().Get("id")))
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to open repository: %v", err))
+		s.writeFailure(w, "", err)
 		return
 	}
 
-	status, err := s.git.GetStatus(ctx, repo)
+	repoStatus, err := s.git.GetStatus(ctx, repo)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get status: %v", err))
+		s.writeFailure(w, "Failed to get status", err)
 		return
 	}
 
-	s.writeSuccess(w, status)
+	s.writeSuccess(w, repoStatus)
 }
 
 // handleLog handles log requests
@@ -234,12 +702,6 @@ func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	path := r.URL.Query().Get("path")
-	if path == "" {
-		s.writeError(w, http.StatusBadRequest, "path parameter is required")
-		return
-	}
-
 	maxStr := r.URL.Query().Get("max")
 	max := 10 // default
 	if maxStr != "" {
@@ -251,15 +713,15 @@ func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	repo, err := s.git.Open(ctx, path)
+	repo, err := s.openRepo(ctx, r.URL.Query().Get("path"), repoIDParam(r, r.URL.Query().Get("id")))
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to open repository: %v", err))
+		s.writeFailure(w, "", err)
 		return
 	}
 
 	commits, err := s.git.Log(ctx, repo, "", max, false)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get log: %v", err))
+		s.writeFailure(w, "Failed to get log", err)
 		return
 	}
 
@@ -273,12 +735,6 @@ func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	path := r.URL.Query().Get("path")
-	if path == "" {
-		s.writeError(w, http.StatusBadRequest, "path parameter is required")
-		return
-	}
-
 	base := r.URL.Query().Get("base")
 	head := r.URL.Query().Get("head")
 	stat := r.URL.Query().Get("stat") == "true"
@@ -286,15 +742,15 @@ func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	repo, err := s.git.Open(ctx, path)
+	repo, err := s.openRepo(ctx, r.URL.Query().Get("path"), repoIDParam(r, r.URL.Query().Get("id")))
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to open repository: %v", err))
+		s.writeFailure(w, "", err)
 		return
 	}
 
 	diff, err := s.git.Diff(ctx, repo, base, head, stat)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get diff: %v", err))
+		s.writeFailure(w, "Failed to get diff", err)
 		return
 	}
 
@@ -303,7 +759,8 @@ func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 
 // SyncRequest represents a sync operation request
 type SyncRequest struct {
-	Path   string `json:"path"`
+	Path   string `json:"path,omitempty"`
+	ID     string `json:"id,omitempty"`
 	Remote string `json:"remote,omitempty"`
 	Branch string `json:"branch,omitempty"`
 	Force  bool   `json:"force,omitempty"`
@@ -325,27 +782,22 @@ func (s *Server) handleFetch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Path == "" {
-		s.writeError(w, http.StatusBadRequest, "path is required")
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	repo, err := s.git.Open(ctx, req.Path)
+	repoID := repoIDParam(r, req.ID)
+	repo, err := s.openRepo(ctx, req.Path, repoID)
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to open repository: %v", err))
+		s.writeFailure(w, "", err)
 		return
 	}
 
-	err = s.git.Fetch(ctx, repo, req.Remote, req.Prune, req.Tags)
-	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Fetch failed: %v", err))
-		return
-	}
-
-	s.writeSuccess(w, map[string]string{"message": "Fetch completed successfully"})
+	s.submitJob(w, r, "fetch", repoID, syncJobTimeout, func(ctx context.Context, task *jobs.Task) (interface{}, error) {
+		if err := s.git.Fetch(ctx, repo, req.Remote, req.Prune, req.Tags); err != nil {
+			return nil, fmt.Errorf("fetch failed: %w", err)
+		}
+		return map[string]string{"message": "Fetch completed successfully"}, nil
+	})
 }
 
 // handlePull handles pull requests
@@ -361,27 +813,22 @@ func (s *Server) handlePull(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Path == "" {
-		s.writeError(w, http.StatusBadRequest, "path is required")
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	repo, err := s.git.Open(ctx, req.Path)
+	repoID := repoIDParam(r, req.ID)
+	repo, err := s.openRepo(ctx, req.Path, repoID)
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to open repository: %v", err))
+		s.writeFailure(w, "", err)
 		return
 	}
 
-	err = s.git.Pull(ctx, repo, req.Remote, req.Branch, req.Rebase)
-	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Pull failed: %v", err))
-		return
-	}
-
-	s.writeSuccess(w, map[string]string{"message": "Pull completed successfully"})
+	s.submitJob(w, r, "pull", repoID, syncJobTimeout, func(ctx context.Context, task *jobs.Task) (interface{}, error) {
+		if err := s.git.Pull(ctx, repo, req.Remote, req.Branch, req.Rebase); err != nil {
+			return nil, fmt.Errorf("pull failed: %w", err)
+		}
+		return map[string]string{"message": "Pull completed successfully"}, nil
+	})
 }
 
 // handlePush handles push requests
@@ -397,32 +844,28 @@ func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Path == "" {
-		s.writeError(w, http.StatusBadRequest, "path is required")
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
-	repo, err := s.git.Open(ctx, req.Path)
-	if err != nil {
-		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to open repository: %v", err))
-		return
-	}
-
-	err = s.git.Push(ctx, repo, req.Remote, req.Branch, req.Force, req.Tags)
+	repoID := repoIDParam(r, req.ID)
+	repo, err := s.openRepo(ctx, req.Path, repoID)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Push failed: %v", err))
+		s.writeFailure(w, "", err)
 		return
 	}
 
-	s.writeSuccess(w, map[string]string{"message": "Push completed successfully"})
+	s.submitJob(w, r, "push", repoID, syncJobTimeout, func(ctx context.Context, task *jobs.Task) (interface{}, error) {
+		if err := s.git.Push(ctx, repo, req.Remote, req.Branch, req.Force, req.Tags); err != nil {
+			return nil, fmt.Errorf("push failed: %w", err)
+		}
+		return map[string]string{"message": "Push completed successfully"}, nil
+	})
 }
 
 // RawRequest represents a raw command request
 type RawRequest struct {
-	Path string   `json:"path"`
+	Path string   `json:"path,omitempty"`
+	ID   string   `json:"id,omitempty"`
 	Args []string `json:"args"`
 }
 
@@ -439,25 +882,46 @@ func (s *Server) handleRaw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Path == "" || len(req.Args) == 0 {
-		s.writeError(w, http.StatusBadRequest, "path and args are required")
+	if len(req.Args) == 0 {
+		s.writeError(w, http.StatusBadRequest, "args are required")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+	caller, ok := s.caller(r)
+	if !ok {
+		s.writeError(w, http.StatusUnauthorized, "Unknown API token")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(core.WithCaller(r.Context(), caller), 2*time.Minute)
 	defer cancel()
 
-	repo, err := s.git.Open(ctx, req.Path)
+	repo, err := s.openRepo(ctx, req.Path, repoIDParam(r, req.ID))
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Failed to open repository: %v", err))
+		s.writeFailure(w, "", err)
 		return
 	}
 
 	result, err := s.git.RunRaw(ctx, repo, req.Args)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Command failed: %v", err))
+		s.writeFailure(w, "Command failed", err)
 		return
 	}
 
 	s.writeSuccess(w, result)
 }
+
+// caller identifies the policy caller of a request from its bearer token.
+// Requests without a token are anonymous; ok is false for unknown tokens.
+func (s *Server) caller(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", true
+	}
+
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found {
+		return "", false
+	}
+	return s.policy.Authenticate(strings.TrimSpace(token))
+}
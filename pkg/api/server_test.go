@@ -0,0 +1,540 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/internal/logging"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/audit"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/index"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/policy"
+)
+
+func TestDebugCommands(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	s := newTestServer(t)
+
+	// The health check asks git for its version
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/debug/commands", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var resp struct {
+		Success bool                    `json:"success"`
+		Data    []executil.CommandTrace `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(resp.Data) == 0 || resp.Data[0].Args[0] != "version" {
+		t.Errorf("Expected the version command to be recorded, got %+v", resp.Data)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	s := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, sample := range []string{
+		`gitmgr_http_requests_total{route="/health",method="GET",status="200"} 1`,
+		`gitmgr_git_commands_total{subcommand="version",exit_code="0"} 1`,
+		`gitmgr_git_processes_in_flight 0`,
+		`gitmgr_jobs_active 0`,
+	} {
+		if !strings.Contains(body, sample+"\n") {
+			t.Errorf("Expected sample %s in:\n%s", sample, body)
+		}
+	}
+}
+
+// entriesCountingStore counts how often the entries of a store are listed
+type entriesCountingStore struct {
+	index.Store
+	listed int
+}
+
+func (s *entriesCountingStore) Entries() ([]index.StoreEntry, error) {
+	s.listed++
+	return s.Store.Entries()
+}
+
+func TestMetricsBounded(t *testing.T) {
+	files, err := index.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	store := &entriesCountingStore{Store: files}
+	cache, err := index.OpenCache(t.TempDir(), index.WithStore(store))
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	workspace, err := NewWorkspace([]string{t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+	s, err := NewServer("127.0.0.1:0", WithWorkspace(workspace), WithCache(cache))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(s.jobs.Close)
+
+	// Made-up methods share one label value
+	for _, method := range []string{"FOO1", "FOO2"} {
+		s.server.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/health", nil))
+	}
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, `gitmgr_http_requests_total{route="/health",method="other",status="405"} 2`+"\n") || strings.Contains(body, "FOO") {
+		t.Errorf("Expected unknown methods counted as other in:\n%s", body)
+	}
+	if store.listed != 1 {
+		t.Errorf("Expected the cache entries to be listed once per scrape, got %d", store.listed)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	workspace, err := NewWorkspace([]string{root})
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+	registry, err := index.OpenRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatalf("OpenRegistry failed: %v", err)
+	}
+	commits, err := index.OpenCommitIndex(filepath.Join(t.TempDir(), "commits"))
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+	var logs bytes.Buffer
+	logger := logging.NewLogger(&logs, true)
+	s, err := NewServer("127.0.0.1:0", WithWorkspace(workspace), WithRegistry(registry), WithCommitIndex(commits), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(s.jobs.Close)
+
+	body := fmt.Sprintf(`{"path": %q, "args": ["config", "user.name", "Request ID"]}`, root)
+	req := httptest.NewRequest(http.MethodPost, "/v1/raw", strings.NewReader(body))
+	req.Header.Set("X-Request-ID", "req-42")
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-ID"); got != "req-42" {
+		t.Errorf("Expected request ID req-42 to be echoed, got %q", got)
+	}
+	// The denied raw command is audited by execgit with the request ID
+	if !strings.Contains(logs.String(), `"requestId":"req-42"`) {
+		t.Errorf("Expected execgit log lines with the request ID, got:\n%s", logs.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("X-Request-ID"); got == "" || got == "bad id\n" {
+		t.Errorf("Expected a generated request ID, got %q", got)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	workspace, err := NewWorkspace([]string{root})
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+	registry, err := index.OpenRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatalf("OpenRegistry failed: %v", err)
+	}
+	commits, err := index.OpenCommitIndex(filepath.Join(t.TempDir(), "commits"))
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+	auditLog, err := audit.OpenLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	rawPolicy := &policy.Policy{
+		Default:  policy.ReadOnlyProfile,
+		Profiles: map[string]*policy.Profile{"admin": {Subcommands: []string{"*"}}},
+		Callers:  map[string]*policy.Caller{"admin": {Token: "secret", Profile: "admin"}},
+	}
+	s, err := NewServer("127.0.0.1:0", WithWorkspace(workspace), WithRegistry(registry), WithCommitIndex(commits), WithPolicy(rawPolicy), WithAuditLog(auditLog))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(s.jobs.Close)
+
+	for _, token := range []string{"secret", ""} {
+		body := fmt.Sprintf(`{"path": %q, "args": ["config", "user.name", "Audit Test"]}`, root)
+		req := httptest.NewRequest(http.MethodPost, "/v1/raw", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		s.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		actors []string
+	}{
+		{"", http.StatusOK, []string{"anonymous", "admin"}},
+		{"?actor=admin", http.StatusOK, []string{"admin"}},
+		{"?operation=push", http.StatusOK, nil},
+		{"?since=2000-01-01T00:00:00Z&limit=1", http.StatusOK, []string{"anonymous"}},
+		{"?until=2000-01-01T00:00:00Z", http.StatusOK, nil},
+		{"?since=yesterday", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/audit"+tt.query, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data []audit.Entry `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Invalid JSON: %v", err)
+			}
+			var actors []string
+			for _, entry := range resp.Data {
+				actors = append(actors, entry.Actor)
+			}
+			if strings.Join(actors, ",") != strings.Join(tt.actors, ",") {
+				t.Errorf("Expected actors %v, got %v", tt.actors, actors)
+			}
+		})
+	}
+
+	// Operations that cannot be audited degrade the health and are counted
+	lockPath := auditLog.Path() + ".lock"
+	if err := os.Remove(lockPath); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := os.Mkdir(lockPath, 0700); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	body := fmt.Sprintf(`{"path": %q, "args": ["config", "user.name", "Unaudited"]}`, root)
+	req := httptest.NewRequest(http.MethodPost, "/v1/raw", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	s.server.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health struct {
+		Data HealthResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if health.Data.Status != "degraded" || health.Data.AuditError == "" {
+		t.Errorf("Expected a degraded health with an audit error, got %+v", health.Data)
+	}
+
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "gitmgr_audit_failures_total 1\n") {
+		t.Errorf("Expected one audit failure in:\n%s", rec.Body.String())
+	}
+}
+
+func TestUndo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", root},
+		{"-C", root, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+		{"-C", root, "branch", "feature"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	workspace, err := NewWorkspace([]string{root})
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+	registry, err := index.OpenRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatalf("OpenRegistry failed: %v", err)
+	}
+	commits, err := index.OpenCommitIndex(filepath.Join(t.TempDir(), "commits"))
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+	s, err := NewServer("127.0.0.1:0", WithWorkspace(workspace), WithRegistry(registry), WithCommitIndex(commits))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	t.Cleanup(s.jobs.Close)
+
+	ctx := context.Background()
+	repo, err := s.git.Open(ctx, root)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := s.git.DeleteBranch(ctx, repo, "feature", true); err != nil {
+		t.Fatalf("DeleteBranch failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/undo?path="+root, nil))
+	var list struct {
+		Data []core.Snapshot `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(list.Data) != 1 || list.Data[0].Operation != "delete-branch" {
+		t.Fatalf("Expected one delete-branch snapshot, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		snapshot string
+		status   int
+	}{
+		{list.Data[0].ID, http.StatusOK},
+		{"missing", http.StatusNotFound},
+		{"", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		body := fmt.Sprintf(`{"path": %q, "snapshot": %q}`, root, tt.snapshot)
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/undo", strings.NewReader(body)))
+		if rec.Code != tt.status {
+			t.Errorf("Expected %d restoring %q, got %d: %s", tt.status, tt.snapshot, rec.Code, rec.Body.String())
+		}
+	}
+
+	if _, err := s.git.RevParse(ctx, repo, "feature"); err != nil {
+		t.Errorf("Expected feature to be restored, got %v", err)
+	}
+}
+
+func TestSearchCommits(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	gitCmd := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-C", root, "-c", "user.email=test@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	commit := func(author, message, file string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(root, file)), 0755); err != nil {
+			t.Fatalf("MkdirAll failed: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(root, file), []byte(message), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		gitCmd("add", file)
+		gitCmd("-c", "user.name="+author, "commit", "-q", "-m", message)
+	}
+	gitCmd("init", "-q")
+	commit("Alice", "initial", "README.md")
+	commit("Bob", "add parser", "pkg/parser/parser.go")
+
+	s := newTestServer(t)
+	s.workspace, _ = NewWorkspace([]string{root})
+
+	search := func(query string) []core.CommitInfo {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/search/commits?path="+root+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %q, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Data []core.CommitInfo `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		return resp.Data
+	}
+
+	if commits := search("&author=bob"); len(commits) != 1 || commits[0].Subject != "add parser" ||
+		len(commits[0].Paths) != 1 || commits[0].Paths[0] != "pkg/parser/parser.go" {
+		t.Errorf("Expected the commit of Bob with its path, got %+v", commits)
+	}
+
+	// Commits made after the first search are indexed by the next one
+	commit("Alice", "fix parser", "pkg/parser/parser.go")
+	if commits := search("&file=pkg/parser"); len(commits) != 2 || commits[0].Subject != "fix parser" {
+		t.Errorf("Expected both parser commits, newest first, got %+v", commits)
+	}
+	if commits := search("&message=PARSER&limit=1"); len(commits) != 1 {
+		t.Errorf("Expected the limit to apply, got %d commits", len(commits))
+	}
+
+	for _, query := range []string{"&since=yesterday", "&limit=-1"} {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/search/commits?path="+root+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestRepos(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	repoPath := filepath.Join(root, "demo")
+	if out, err := exec.Command("git", "init", "-q", repoPath).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	if err := os.Mkdir(filepath.Join(root, "plain"), 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	registryPath := filepath.Join(t.TempDir(), "registry.json")
+	registry, err := index.OpenRegistry(registryPath)
+	if err != nil {
+		t.Fatalf("OpenRegistry failed: %v", err)
+	}
+	s := newTestServer(t)
+	s.workspace, _ = NewWorkspace([]string{root})
+	s.registry = registry
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/v1/repos", `{"path":"`+repoPath+`","name":"demo"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created struct {
+		Data index.RepoRecord `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	id := created.Data.ID
+	if id == "" || created.Data.Name != "demo" || created.Data.Repo.Path != repoPath {
+		t.Fatalf("Unexpected record: %+v", created.Data)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"list", http.MethodGet, "/v1/repos", "", http.StatusOK},
+		{"get", http.MethodGet, "/v1/repos/" + id, "", http.StatusOK},
+		{"status by id", http.MethodGet, "/v1/repos/" + id + "/status", "", http.StatusOK},
+		{"invalid JSON", http.MethodPost, "/v1/repos", "{", http.StatusBadRequest},
+		{"not a repository", http.MethodPost, "/v1/repos", `{"path":"` + filepath.Join(root, "plain") + `"}`, http.StatusBadRequest},
+		{"outside the workspace", http.MethodPost, "/v1/repos", `{"path":"` + t.TempDir() + `"}`, http.StatusForbidden},
+		{"unknown id", http.MethodGet, "/v1/repos/unknown", "", http.StatusNotFound},
+		{"method not allowed", http.MethodPut, "/v1/repos", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := do(tt.method, tt.target, tt.body); rec.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// A registry that cannot be saved fails the request and keeps the record
+	if err := os.Remove(registryPath); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := os.Mkdir(registryPath, 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	if rec := do(http.MethodDelete, "/v1/repos/"+id, ""); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 when the registry cannot be saved, got %d", rec.Code)
+	}
+	if _, ok := registry.Get(id); !ok {
+		t.Error("Expected the record to survive a failed removal")
+	}
+	if err := os.Remove(registryPath); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	if rec := do(http.MethodDelete, "/v1/repos/"+id, ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, "/v1/repos/"+id, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a removed repository, got %d", rec.Code)
+	}
+	if records := registry.List(); len(records) != 0 {
+		t.Errorf("Expected an empty registry, got %+v", records)
+	}
+}
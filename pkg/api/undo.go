@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// UndoRequest restores an undo snapshot of a repository
+type UndoRequest struct {
+	Path     string `json:"path,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Snapshot string `json:"snapshot"`
+}
+
+// handleUndo lists the undo snapshots of a repository and restores them
+func (s *Server) handleUndo(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+
+		repo, err := s.openRepo(ctx, r.URL.Query().Get("path"), repoIDParam(r, r.URL.Query().Get("id")))
+		if err != nil {
+			s.writeFailure(w, "", err)
+			return
+		}
+
+		snapshots, err := s.git.ListSnapshots(ctx, repo)
+		if err != nil {
+			s.writeFailure(w, "Failed to list snapshots", err)
+			return
+		}
+		s.writeSuccess(w, snapshots)
+	case http.MethodPost:
+		var req UndoRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON request")
+			return
+		}
+		if req.Snapshot == "" {
+			s.writeError(w, http.StatusBadRequest, "snapshot is required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Minute)
+		defer cancel()
+
+		repo, err := s.openRepo(ctx, req.Path, repoIDParam(r, req.ID))
+		if err != nil {
+			s.writeFailure(w, "", err)
+			return
+		}
+
+		if err := s.git.RestoreSnapshot(ctx, repo, req.Snapshot); err != nil {
+			s.writeFailure(w, "Undo failed", err)
+			return
+		}
+		s.writeSuccess(w, map[string]string{"message": "Snapshot " + req.Snapshot + " restored"})
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
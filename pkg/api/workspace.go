@@ -0,0 +1,190 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// ErrOutsideWorkspace is returned when a path resolves outside every workspace root
+var ErrOutsideWorkspace = errors.New("path is outside the configured workspace roots")
+
+// Workspace confines client supplied paths to a set of root directories
+type Workspace struct {
+	roots []string
+}
+
+// NewWorkspace creates a workspace confined to the given roots.
+// Roots must exist; they are resolved to absolute paths with symlinks evaluated.
+func NewWorkspace(roots []string) (*Workspace, error) {
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("at least one workspace root is required")
+	}
+
+	resolved := make([]string, 0, len(roots))
+	for _, root := range roots {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("invalid workspace root %s: %w", root, err)
+		}
+		realRoot, err := filepath.EvalSymlinks(absRoot)
+		if err != nil {
+			return nil, fmt.Errorf("invalid workspace root %s: %w", root, err)
+		}
+		resolved = append(resolved, realRoot)
+	}
+
+	return &Workspace{roots: resolved}, nil
+}
+
+// Roots returns the resolved workspace roots
+func (w *Workspace) Roots() []string {
+	return append([]string(nil), w.roots...)
+}
+
+// Resolve returns the real path for path if it lies within a workspace root.
+// The path does not need to exist, so clone targets can be validated too.
+func (w *Workspace) Resolve(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+
+	realPath, err := evalSymlinksAllowMissing(absPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+
+	for _, root := range w.roots {
+		if isWithin(root, realPath) {
+			return realPath, nil
+		}
+	}
+
+	return "", ErrOutsideWorkspace
+}
+
+// CheckRepo returns ErrOutsideWorkspace unless the git directory and the
+// worktree of repo lie within a root. Resolving the requested path is not
+// enough: git discovers repositories in parent directories and follows
+// .git files pointing to other git directories.
+func (w *Workspace) CheckRepo(repo *core.Repo) error {
+	paths := []string{repo.GitDir}
+	if !repo.IsBare {
+		paths = append(paths, repo.WorkDir)
+	}
+	for _, path := range paths {
+		if _, err := w.Resolve(path); err != nil {
+			if errors.Is(err, ErrOutsideWorkspace) {
+				return err
+			}
+			return fmt.Errorf("invalid repository path: %w", err)
+		}
+	}
+	return nil
+}
+
+// GitEnv returns the environment variables that stop git from discovering
+// repositories above the roots or on other file systems
+func (w *Workspace) GitEnv() []string {
+	ceilings := make([]string, 0, len(w.roots))
+	for _, root := range w.roots {
+		ceilings = append(ceilings, filepath.Dir(root))
+	}
+	return []string{
+		"GIT_CEILING_DIRECTORIES=" + strings.Join(ceilings, string(os.PathListSeparator)),
+		"GIT_DISCOVERY_ACROSS_FILESYSTEM=0",
+	}
+}
+
+// GitConfig returns the git configuration overrides that stop git from
+// reading local repositories on its own, such as file:// submodules of a
+// recursive clone. Sources given by the caller are checked by CheckSource.
+func (w *Workspace) GitConfig() []string {
+	return []string{"protocol.file.allow=user"}
+}
+
+// CheckSource returns ErrOutsideWorkspace if url is a local path or a
+// file:// URL outside every root, so cloning cannot copy repositories of
+// the host. Relative paths are resolved against dir, where git runs.
+// Other URLs are left to git.
+func (w *Workspace) CheckSource(url, dir string) error {
+	path, ok, err := localSource(url)
+	if err != nil || !ok {
+		return err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if _, err := w.Resolve(path); err != nil {
+		if errors.Is(err, ErrOutsideWorkspace) {
+			return err
+		}
+		return fmt.Errorf("invalid source path: %w", err)
+	}
+	return nil
+}
+
+// localSource returns the path git reads for url if url is a local path or
+// a file:// URL. Like git, it takes URLs without "://" whose first colon
+// precedes any slash for scp-like ssh addresses.
+func localSource(url string) (string, bool, error) {
+	if len(url) >= len("file://") && strings.EqualFold(url[:len("file://")], "file://") {
+		path, err := neturl.PathUnescape(url[len("file://"):])
+		if err != nil || !strings.HasPrefix(path, "/") {
+			return "", false, fmt.Errorf("invalid file URL %q", url)
+		}
+		return path, true, nil
+	}
+	if strings.Contains(url, "://") || strings.Contains(url, "::") {
+		return "", false, nil
+	}
+	if i := strings.Index(url, ":"); i >= 0 && !strings.Contains(url[:i], "/") {
+		return "", false, nil
+	}
+	return url, true, nil
+}
+
+// evalSymlinksAllowMissing resolves symlinks in the longest existing prefix of path
+func evalSymlinksAllowMissing(path string) (string, error) {
+	var missing []string
+	current := path
+
+	for {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, missing[i])
+			}
+			return resolved, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", err
+		}
+		missing = append(missing, filepath.Base(current))
+		current = parent
+	}
+}
+
+// isWithin reports whether path equals root or is nested below it
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewWorkspace_RequiresRoots(t *testing.T) {
+	if _, err := NewWorkspace(nil); err == nil {
+		t.Error("Expected error for empty roots")
+	}
+	if _, err := NewWorkspace([]string{"/nonexistent/root"}); err == nil {
+		t.Error("Expected error for nonexistent root")
+	}
+}
+
+func TestWorkspaceResolve(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.Mkdir(filepath.Join(root, "repo"), 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	workspace, err := NewWorkspace([]string{root})
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		allowed bool
+	}{
+		{name: "root itself", path: root, allowed: true},
+		{name: "existing child", path: filepath.Join(root, "repo"), allowed: true},
+		{name: "missing child", path: filepath.Join(root, "new", "clone"), allowed: true},
+		{name: "dot dot escape", path: filepath.Join(root, "..", filepath.Base(outside)), allowed: false},
+		{name: "symlink escape", path: filepath.Join(root, "escape"), allowed: false},
+		{name: "missing below symlink escape", path: filepath.Join(root, "escape", "clone"), allowed: false},
+		{name: "unrelated path", path: outside, allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := workspace.Resolve(tt.path)
+			if tt.allowed && err != nil {
+				t.Errorf("Expected %s to be allowed, got %v", tt.path, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrOutsideWorkspace) {
+				t.Errorf("Expected ErrOutsideWorkspace for %s, got %v", tt.path, err)
+			}
+		})
+	}
+}
+
+func TestWorkspaceCheckSource(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "source"), 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	workspace, err := NewWorkspace([]string{root})
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want error // nil, ErrOutsideWorkspace or errInvalid for any other error
+	}{
+		{"https", "https://github.com/user/repo.git", nil},
+		{"ssh", "ssh://git@github.com/user/repo.git", nil},
+		{"scp-like", "git@github.com:user/repo.git", nil},
+		{"path inside", filepath.Join(root, "source"), nil},
+		{"relative inside", "source", nil},
+		{"file URL inside", "file://" + filepath.Join(root, "source"), nil},
+		{"path outside", outside, ErrOutsideWorkspace},
+		{"relative escape", filepath.Join("..", "..", outside), ErrOutsideWorkspace},
+		{"file URL outside", "file://" + outside, ErrOutsideWorkspace},
+		{"file URL upper case", "FILE://" + outside, ErrOutsideWorkspace},
+		{"file URL escaped", "file://" + strings.ReplaceAll(outside, "/", "%2f"), ErrOutsideWorkspace},
+		{"file URL with host", "file://host/etc", errInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := workspace.CheckSource(tt.url, root)
+			switch {
+			case tt.want == errInvalid:
+				if err == nil || errors.Is(err, ErrOutsideWorkspace) {
+					t.Errorf("Expected an invalid source error for %s, got %v", tt.url, err)
+				}
+			case !errors.Is(err, tt.want) || (tt.want == nil && err != nil):
+				t.Errorf("Expected %v for %s, got %v", tt.want, tt.url, err)
+			}
+		})
+	}
+
+	// Clones from local repositories outside the roots are rejected before
+	// a job is started
+	s := newTestServer(t)
+	s.workspace = workspace
+	body := fmt.Sprintf(`{"url":%q,"path":%q}`, "file://"+outside, filepath.Join(root, "clone"))
+	for _, route := range []string{"/v1/clone", "/v1/repos"} {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, route, strings.NewReader(body)))
+		if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), ErrOutsideWorkspace.Error()) {
+			t.Errorf("Expected 403 for a source outside the roots from %s, got %d: %s", route, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// errInvalid marks expected errors other than ErrOutsideWorkspace
+var errInvalid = errors.New("invalid")
+
+func TestOpenRepoConfinement(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	gitInit := func(dir string) {
+		t.Helper()
+		if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+			t.Fatalf("git init failed: %v: %s", err, out)
+		}
+	}
+
+	// A repository above the root, with a plain directory inside the root
+	outer := t.TempDir()
+	gitInit(outer)
+	root := filepath.Join(outer, "workspace")
+	if err := os.MkdirAll(filepath.Join(root, "plain"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	gitInit(filepath.Join(root, "inside"))
+
+	// A .git file pointing to a repository outside the root
+	elsewhere := t.TempDir()
+	gitInit(elsewhere)
+	linked := filepath.Join(root, "linked")
+	if err := os.MkdirAll(linked, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	gitFile := "gitdir: " + filepath.Join(elsewhere, ".git") + "\n"
+	if err := os.WriteFile(filepath.Join(linked, ".git"), []byte(gitFile), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	s := newTestServer(t)
+	workspace, err := NewWorkspace([]string{root})
+	if err != nil {
+		t.Fatalf("NewWorkspace failed: %v", err)
+	}
+	s.workspace = workspace
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"inside", http.StatusOK},
+		{"plain", http.StatusBadRequest},
+		{"linked", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/status?path="+filepath.Join(root, tt.path), nil))
+		if rec.Code != tt.status {
+			t.Errorf("Expected %d for %s, got %d: %s", tt.status, tt.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Without the discovery limits git finds the repository above the root,
+	// which the check after opening still rejects
+	if _, err := s.openConfined(context.Background(), filepath.Join(root, "plain")); !errors.Is(err, ErrOutsideWorkspace) {
+		t.Errorf("Expected ErrOutsideWorkspace for a repository above the root, got %v", err)
+	}
+}
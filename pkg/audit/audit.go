@@ -0,0 +1,571 @@
+// Package audit keeps a tamper-evident, append-only log of the operations
+// that modify repositories
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/filelock"
+)
+
+// Results of an audited operation
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Sources of audited operations
+const (
+	SourceAPI   = "api"
+	SourceCLI   = "cli"
+	SourceAudit = "audit" // Entries the log writes about itself
+)
+
+// OperationChainBreak is the operation of the entry recording invalid
+// entries removed from the end of the log
+const OperationChainBreak = "chain-break"
+
+// Defaults used when no rotation options are given
+const (
+	DefaultMaxSize  = 10 << 20
+	DefaultMaxFiles = 10
+)
+
+// maxEntrySize bounds the length of a single entry line when reading
+const maxEntrySize = 16 << 20
+
+// ErrBrokenChain is returned by Verify when an entry was modified, removed
+// or inserted
+var ErrBrokenChain = errors.New("audit log hash chain is broken")
+
+// Entry records one operation. Hash is the SHA-256 of the entry's JSON
+// encoding with an empty Hash, and PrevHash is the Hash of the entry before
+// it, so changing, removing or inserting an entry breaks the chain.
+type Entry struct {
+	Seq       uint64                 `json:"seq"`
+	Time      time.Time              `json:"time"`
+	Source    string                 `json:"source"`
+	Actor     string                 `json:"actor"`
+	RequestID string                 `json:"requestId,omitempty"`
+	Repo      string                 `json:"repo"`
+	Operation string                 `json:"operation"`
+	Args      map[string]interface{} `json:"args,omitempty"` // Sanitized arguments
+	Refs      []RefChange            `json:"refs,omitempty"` // Refs the operation changed
+	Result    string                 `json:"result"`
+	Error     string                 `json:"error,omitempty"`
+	PrevHash  string                 `json:"prevHash"`
+	Hash      string                 `json:"hash"`
+}
+
+// RefChange is the value of a ref before and after an operation
+type RefChange struct {
+	Name   string `json:"name"`
+	Before string `json:"before,omitempty"` // Empty if the ref was created
+	After  string `json:"after,omitempty"`  // Empty if the ref was deleted
+}
+
+// Log is an audit log stored as JSON lines. When the file grows beyond the
+// maximum size it is rotated to path.1, path.1 to path.2 and so on; the
+// chain continues across files. Processes sharing the file coordinate with
+// an advisory lock on path.lock.
+type Log struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	mu       sync.Mutex
+
+	statsMu sync.Mutex
+	stats   Stats
+}
+
+// Stats counts problems writing the log since it was opened
+type Stats struct {
+	Failures    uint64 `json:"failures"`            // Appends that failed
+	ChainBreaks uint64 `json:"chainBreaks"`         // Invalid entries removed from the end of the log
+	LastError   string `json:"lastError,omitempty"` // Error of the last append, empty if it succeeded
+}
+
+// Option configures a Log
+type Option func(*Log)
+
+// WithMaxSize sets the size in bytes after which the log is rotated
+func WithMaxSize(size int64) Option {
+	return func(l *Log) {
+		l.maxSize = size
+	}
+}
+
+// WithMaxFiles sets how many rotated files are kept; older ones are removed
+func WithMaxFiles(n int) Option {
+	return func(l *Log) {
+		l.maxFiles = n
+	}
+}
+
+// NewLog opens the audit log in ~/.gitmgr/audit.log
+func NewLog(opts ...Option) (*Log, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return OpenLog(filepath.Join(homeDir, ".gitmgr", "audit.log"), opts...)
+}
+
+// OpenLog opens the audit log at path, creating it if needed
+func OpenLog(path string, opts ...Option) (*Log, error) {
+	l := &Log{
+		path:     path,
+		maxSize:  DefaultMaxSize,
+		maxFiles: DefaultMaxFiles,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.maxFiles < 1 {
+		l.maxFiles = 1
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	f.Close()
+	return l, nil
+}
+
+// Path returns the path of the current log file
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Stats returns the problems writing the log since it was opened
+func (l *Log) Stats() Stats {
+	l.statsMu.Lock()
+	defer l.statsMu.Unlock()
+	return l.stats
+}
+
+// Append assigns entry its sequence number and hashes, writes it and returns
+// the stored entry. If the last entry is invalid, e.g. because a crash
+// interrupted its write, it is moved to path.corrupt and a chain-break entry
+// recording that is written first.
+func (l *Log) Append(entry Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stored, breaks, err := l.append(entry)
+
+	l.statsMu.Lock()
+	l.stats.ChainBreaks += breaks
+	l.stats.LastError = ""
+	if err != nil {
+		l.stats.Failures++
+		l.stats.LastError = err.Error()
+	}
+	l.statsMu.Unlock()
+	return stored, err
+}
+
+// append implements Append, returning how many chain breaks it recorded
+func (l *Log) append(entry Entry) (Entry, uint64, error) {
+	unlock, err := filelock.Lock(l.path + ".lock")
+	if err != nil {
+		return entry, 0, fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	defer unlock()
+
+	var pending []Entry
+	last, err := l.last()
+	if errors.Is(err, ErrBrokenChain) {
+		var chainBreak *Entry
+		last, chainBreak, err = l.sealTail()
+		if chainBreak != nil {
+			pending = append(pending, *chainBreak)
+		}
+	}
+	if err != nil {
+		return entry, 0, err
+	}
+	if info, err := os.Stat(l.path); err == nil && info.Size() >= l.maxSize {
+		if err := l.rotate(); err != nil {
+			return entry, 0, err
+		}
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC()
+	pending = append(pending, entry)
+
+	var data []byte
+	for i := range pending {
+		pending[i].Seq = 1
+		pending[i].PrevHash = ""
+		if last != nil {
+			pending[i].Seq = last.Seq + 1
+			pending[i].PrevHash = last.Hash
+		}
+		line, err := seal(&pending[i])
+		if err != nil {
+			return entry, 0, err
+		}
+		data = append(append(data, line...), '\n')
+		last = &pending[i]
+	}
+	entry = *last
+	breaks := uint64(len(pending) - 1)
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return entry, breaks, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return entry, breaks, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return entry, breaks, fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return entry, breaks, nil
+}
+
+// sealTail moves the invalid lines ending the newest non-empty log file to
+// path.corrupt and truncates them. It returns the last valid entry, if any,
+// and the chain-break entry to write next. The caller holds the locks.
+func (l *Log) sealTail() (*Entry, *Entry, error) {
+	for _, path := range []string{l.path, l.rotated(1)} {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		// Drop lines from the end until one is a valid entry
+		var last *Entry
+		end := len(data)
+		for end > 0 {
+			trimmed := bytes.TrimRight(data[:end], "\n")
+			start := bytes.LastIndexByte(trimmed, '\n') + 1
+			var entry Entry
+			if len(trimmed) > 0 && json.Unmarshal(trimmed[start:], &entry) == nil {
+				last = &entry
+				break
+			}
+			end = start
+		}
+		if end == len(data) {
+			if last != nil {
+				return last, nil, nil
+			}
+			continue
+		}
+
+		corrupt := l.path + ".corrupt"
+		removed := data[end:]
+		if err := appendFile(corrupt, removed); err != nil {
+			return nil, nil, fmt.Errorf("failed to save invalid audit entries: %w", err)
+		}
+		if err := truncateFile(path, int64(end)); err != nil {
+			return nil, nil, fmt.Errorf("failed to remove invalid audit entries: %w", err)
+		}
+		chainBreak := &Entry{
+			Time:      time.Now().UTC(),
+			Source:    SourceAudit,
+			Actor:     SourceAudit,
+			Operation: OperationChainBreak,
+			Args: map[string]interface{}{
+				"file":    filepath.Base(path),
+				"bytes":   len(removed),
+				"savedTo": filepath.Base(corrupt),
+			},
+			Result: ResultFailure,
+			Error:  fmt.Sprintf("removed %d bytes of invalid entries from the end of %s", len(removed), filepath.Base(path)),
+		}
+		if last == nil && path == l.path {
+			// The current file held no valid entry; continue the chain of
+			// the rotated one
+			previous, err := l.last()
+			if err != nil {
+				return nil, nil, err
+			}
+			last = previous
+		}
+		return last, chainBreak, nil
+	}
+	return nil, nil, nil
+}
+
+// appendFile appends data to the file at path and syncs it
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// truncateFile cuts the file at path to size bytes and syncs it
+func truncateFile(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// seal sets the hash of entry and returns its JSON encoding
+func seal(entry *Entry) ([]byte, error) {
+	hash, err := hashEntry(*entry)
+	if err != nil {
+		return nil, err
+	}
+	entry.Hash = hash
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	return data, nil
+}
+
+// hashEntry returns the hash of entry with its Hash left out
+func hashEntry(entry Entry) (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// last returns the newest entry, looking into the last rotated file if the
+// current one is empty
+func (l *Log) last() (*Entry, error) {
+	for _, path := range []string{l.path, l.rotated(1)} {
+		line, err := lastLine(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		if line == nil {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("%w: last entry of %s is not valid JSON", ErrBrokenChain, path)
+		}
+		return &entry, nil
+	}
+	return nil, nil
+}
+
+// lastLine returns the last non-empty line of the file at path, reading it
+// backwards, or nil if the file is empty
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	const chunk = 4096
+	var tail []byte
+	for offset := info.Size(); offset > 0; {
+		n := int64(chunk)
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		tail = append(buf, tail...)
+
+		trimmed := bytes.TrimRight(tail, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], nil
+		}
+		if offset == 0 && len(trimmed) > 0 {
+			return trimmed, nil
+		}
+	}
+	return nil, nil
+}
+
+// rotated returns the path of the n-th rotated file
+func (l *Log) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
+
+// rotate shifts the rotated files, dropping the oldest, and moves the
+// current file to path.1
+func (l *Log) rotate() error {
+	if err := os.Remove(l.rotated(l.maxFiles)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	for n := l.maxFiles - 1; n >= 1; n-- {
+		if err := os.Rename(l.rotated(n), l.rotated(n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	}
+	if err := os.Rename(l.path, l.rotated(1)); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return nil
+}
+
+// files returns the existing log files, oldest first
+func (l *Log) files() []string {
+	var files []string
+	for n := l.maxFiles; n >= 1; n-- {
+		if _, err := os.Stat(l.rotated(n)); err == nil {
+			files = append(files, l.rotated(n))
+		}
+	}
+	return append(files, l.path)
+}
+
+// each calls fn with every entry, oldest first
+func (l *Log) each(fn func(entry Entry) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, path := range l.files() {
+		f, err := os.Open(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+		for scanner.Scan() {
+			raw := scanner.Bytes()
+			if len(raw) == 0 {
+				continue
+			}
+			var entry Entry
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				f.Close()
+				return fmt.Errorf("%w: invalid entry in %s: %v", ErrBrokenChain, path, err)
+			}
+			if err := fn(entry); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read audit log: %w", err)
+		}
+	}
+	return nil
+}
+
+// Query selects entries; zero fields match everything
+type Query struct {
+	Repo      string
+	Actor     string
+	Operation string
+	Since     time.Time // Inclusive
+	Until     time.Time // Exclusive
+	Limit     int       // Maximum number of entries, 0 for all
+}
+
+// matches reports whether entry is selected by q
+func (q Query) matches(entry Entry) bool {
+	switch {
+	case q.Repo != "" && entry.Repo != q.Repo:
+		return false
+	case q.Actor != "" && entry.Actor != q.Actor:
+		return false
+	case q.Operation != "" && entry.Operation != q.Operation:
+		return false
+	case !q.Since.IsZero() && entry.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !entry.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// Query returns the entries selected by q, newest first
+func (l *Log) Query(q Query) ([]Entry, error) {
+	var entries []Entry
+	err := l.each(func(entry Entry) error {
+		if q.matches(entry) {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Seq > entries[j].Seq
+	})
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+	return entries, nil
+}
+
+// Verify checks the hash chain of all retained entries and returns an
+// ErrBrokenChain error naming the first entry that does not fit. The first
+// retained entry may follow entries removed by rotation.
+func (l *Log) Verify() error {
+	var prev *Entry
+	return l.each(func(entry Entry) error {
+		hash, err := hashEntry(entry)
+		if err != nil {
+			return err
+		}
+		if hash != entry.Hash {
+			return fmt.Errorf("%w: entry %d was modified", ErrBrokenChain, entry.Seq)
+		}
+		if prev != nil && (entry.PrevHash != prev.Hash || entry.Seq != prev.Seq+1) {
+			return fmt.Errorf("%w: entry %d does not follow entry %d", ErrBrokenChain, entry.Seq, prev.Seq)
+		}
+		prev = &entry
+		return nil
+	})
+}
@@ -0,0 +1,224 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendChain(t *testing.T) {
+	log, err := OpenLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+
+	first, err := log.Append(Entry{Actor: "alice", Repo: "/repo", Operation: "push", Result: ResultSuccess})
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	second, err := log.Append(Entry{Actor: "bob", Repo: "/repo", Operation: "fetch", Result: ResultSuccess})
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	if first.Seq != 1 || second.Seq != 2 {
+		t.Errorf("Expected sequence numbers 1 and 2, got %d and %d", first.Seq, second.Seq)
+	}
+	if first.PrevHash != "" || second.PrevHash != first.Hash {
+		t.Errorf("Expected second entry to chain to %q, got %q", first.Hash, second.PrevHash)
+	}
+	if err := log.Verify(); err != nil {
+		t.Errorf("Expected valid chain, got %v", err)
+	}
+
+	// Reopening continues the chain
+	reopened, err := OpenLog(log.Path())
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	third, err := reopened.Append(Entry{Actor: "alice", Repo: "/repo", Operation: "gc", Result: ResultSuccess})
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if third.Seq != 3 || third.PrevHash != second.Hash {
+		t.Errorf("Expected entry 3 chained to entry 2, got %d chained to %q", third.Seq, third.PrevHash)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(lines []string) []string
+	}{
+		{"modified", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"actor":"bob"`, `"actor":"eve"`, 1)
+			return lines
+		}},
+		{"removed", func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}},
+		{"reordered", func(lines []string) []string {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := OpenLog(filepath.Join(t.TempDir(), "audit.log"))
+			if err != nil {
+				t.Fatalf("OpenLog failed: %v", err)
+			}
+			for _, actor := range []string{"alice", "bob", "carol"} {
+				if _, err := log.Append(Entry{Actor: actor, Operation: "push", Result: ResultSuccess}); err != nil {
+					t.Fatalf("Append failed: %v", err)
+				}
+			}
+
+			data, err := os.ReadFile(log.Path())
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			lines := tt.tamper(strings.Split(strings.TrimSpace(string(data)), "\n"))
+			if err := os.WriteFile(log.Path(), []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+
+			if err := log.Verify(); !errors.Is(err, ErrBrokenChain) {
+				t.Errorf("Expected ErrBrokenChain, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	log, err := OpenLog(filepath.Join(t.TempDir(), "audit.log"), WithMaxSize(1), WithMaxFiles(2))
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := log.Append(Entry{Actor: "alice", Operation: "push", Result: ResultSuccess}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	// Every append rotates, so only the last three entries remain
+	if _, err := os.Stat(log.Path() + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected the oldest file to be removed, got %v", err)
+	}
+	entries, err := log.Query(Query{})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Seq != 4 || entries[2].Seq != 2 {
+		t.Errorf("Expected entries 4 to 2, got %+v", entries)
+	}
+	if err := log.Verify(); err != nil {
+		t.Errorf("Expected the chain to continue across files, got %v", err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	log, err := OpenLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := []Entry{
+		{Time: base, Actor: "alice", Repo: "/a", Operation: "push"},
+		{Time: base.Add(time.Hour), Actor: "bob", Repo: "/a", Operation: "fetch"},
+		{Time: base.Add(2 * time.Hour), Actor: "alice", Repo: "/b", Operation: "push"},
+	}
+	for _, entry := range records {
+		entry.Result = ResultSuccess
+		if _, err := log.Append(entry); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []uint64
+	}{
+		{"all", Query{}, []uint64{3, 2, 1}},
+		{"repo", Query{Repo: "/a"}, []uint64{2, 1}},
+		{"actor", Query{Actor: "alice"}, []uint64{3, 1}},
+		{"operation", Query{Operation: "fetch"}, []uint64{2}},
+		{"time range", Query{Since: base.Add(time.Hour), Until: base.Add(2 * time.Hour)}, []uint64{2}},
+		{"limit", Query{Limit: 1}, []uint64{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := log.Query(tt.query)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			var got []uint64
+			for _, entry := range entries {
+				got = append(got, entry.Seq)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAppendSealsInvalidTail(t *testing.T) {
+	log, err := OpenLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("OpenLog failed: %v", err)
+	}
+	first, err := log.Append(Entry{Actor: "alice", Operation: "push", Result: ResultSuccess})
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	// A crash interrupted the write of the next entry
+	torn := `{"seq":2,"actor":"bob","oper`
+	f, err := os.OpenFile(log.Path(), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if _, err := f.WriteString(torn); err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+	f.Close()
+
+	entry, err := log.Append(Entry{Actor: "carol", Operation: "fetch", Result: ResultSuccess})
+	if err != nil {
+		t.Fatalf("Expected Append to seal the invalid entry, got %v", err)
+	}
+	if entry.Seq != 3 || entry.Actor != "carol" {
+		t.Errorf("Expected carol's entry 3 after the chain break, got %+v", entry)
+	}
+	if err := log.Verify(); err != nil {
+		t.Errorf("Expected a valid chain, got %v", err)
+	}
+
+	entries, err := log.Query(Query{Operation: OperationChainBreak})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Seq != 2 || entries[0].PrevHash != first.Hash || entries[0].Result != ResultFailure {
+		t.Errorf("Expected chain-break entry 2 following entry 1, got %+v", entries)
+	}
+	if saved, err := os.ReadFile(log.Path() + ".corrupt"); err != nil || string(saved) != torn {
+		t.Errorf("Expected the invalid entry to be saved, got %q, %v", saved, err)
+	}
+	if stats := log.Stats(); stats.ChainBreaks != 1 || stats.Failures != 0 || stats.LastError != "" {
+		t.Errorf("Expected one chain break and no failures, got %+v", stats)
+	}
+}
@@ -0,0 +1,372 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/internal/gitstate"
+	"github.com/felipemacedo1/go-coregit-pe/internal/logging"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// Git wraps a CoreGit and records every operation that may modify a
+// repository, including all raw commands, in an audit log. Read-only
+// operations are passed through unchanged. The actor is the caller set with
+// core.WithCaller.
+type Git struct {
+	core.CoreGit
+	log    *Log
+	source string
+	logger *logging.Logger
+}
+
+// NewGit wraps git so its mutating operations are recorded in log with the
+// given source. Entries that cannot be written are logged to logger, or the
+// default logger if nil, without failing the operation.
+func NewGit(git core.CoreGit, log *Log, source string, logger *logging.Logger) *Git {
+	if logger == nil {
+		logger = logging.Default()
+	}
+	return &Git{CoreGit: git, log: log, source: source, logger: logger}
+}
+
+// record runs op against repo and appends its outcome, with the refs it
+// changed, to the audit log
+func (g *Git) record(ctx context.Context, repo *core.Repo, op string, args map[string]interface{}, run func() error) error {
+	before := gitstate.ReadRefs(repo.GitDir)
+	err := run()
+	g.append(ctx, repo.Path, op, args, diffRefs(before, gitstate.ReadRefs(repo.GitDir)), err)
+	return err
+}
+
+// append writes an entry for an operation that ran
+func (g *Git) append(ctx context.Context, repo, op string, args map[string]interface{}, refs []RefChange, err error) {
+	actor := core.CallerFromContext(ctx)
+	if actor == "" {
+		actor = "anonymous"
+	}
+	entry := Entry{
+		Source:    g.source,
+		Actor:     actor,
+		RequestID: logging.RequestIDFromContext(ctx),
+		Repo:      repo,
+		Operation: op,
+		Args:      args,
+		Refs:      refs,
+		Result:    ResultSuccess,
+	}
+	if err != nil {
+		entry.Result = ResultFailure
+		entry.Error = executil.Sanitize(err.Error())
+	}
+
+	if _, appendErr := g.log.Append(entry); appendErr != nil {
+		g.logger.WithContext(ctx).Warn("Failed to write audit entry", map[string]interface{}{
+			"operation": op,
+			"repo":      repo,
+			"error":     appendErr.Error(),
+		})
+	}
+}
+
+// diffRefs returns the refs whose values differ between before and after,
+// sorted by name
+func diffRefs(before, after map[string]string) []RefChange {
+	var changes []RefChange
+	for name, value := range before {
+		if after[name] != value {
+			changes = append(changes, RefChange{Name: name, Before: value, After: after[name]})
+		}
+	}
+	for name, value := range after {
+		if _, ok := before[name]; !ok {
+			changes = append(changes, RefChange{Name: name, After: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// sanitize masks credentials in an argument, including the user info of URLs
+func sanitize(arg string) string {
+	arg = executil.Sanitize(arg)
+	if u, err := url.Parse(arg); err == nil && u.Scheme != "" && u.User != nil {
+		u.User = nil
+		return u.Scheme + "://***@" + strings.TrimPrefix(u.String(), u.Scheme+"://")
+	}
+	return arg
+}
+
+// Init records the creation of a repository
+func (g *Git) Init(ctx context.Context, path string, bare bool) (*core.Repo, error) {
+	repo, err := g.CoreGit.Init(ctx, path, bare)
+	g.appendCreated(ctx, path, repo, "init", map[string]interface{}{"bare": bare}, err)
+	return repo, err
+}
+
+// Clone records the creation of a repository by cloning
+func (g *Git) Clone(ctx context.Context, opts core.CloneOptions) (*core.Repo, error) {
+	repo, err := g.CoreGit.Clone(ctx, opts)
+	args := map[string]interface{}{
+		"url":    sanitize(opts.URL),
+		"branch": opts.Branch,
+		"depth":  opts.Depth,
+		"bare":   opts.Bare,
+		"mirror": opts.Mirror,
+	}
+	g.appendCreated(ctx, opts.Path, repo, "clone", args, err)
+	return repo, err
+}
+
+// appendCreated writes the entry of an operation creating a repository; all
+// refs of the new repository count as created
+func (g *Git) appendCreated(ctx context.Context, path string, repo *core.Repo, op string, args map[string]interface{}, err error) {
+	var refs []RefChange
+	if repo != nil {
+		path = repo.Path
+		refs = diffRefs(nil, gitstate.ReadRefs(repo.GitDir))
+	}
+	g.append(ctx, path, op, args, refs, err)
+}
+
+// SetConfig records a configuration change. Values are left out since they
+// may hold secrets.
+func (g *Git) SetConfig(ctx context.Context, repo *core.Repo, key, value string, global bool) error {
+	args := map[string]interface{}{"key": key, "global": global}
+	return g.record(ctx, repo, "set-config", args, func() error {
+		return g.CoreGit.SetConfig(ctx, repo, key, value, global)
+	})
+}
+
+// AddRemote records the addition of a remote
+func (g *Git) AddRemote(ctx context.Context, repo *core.Repo, name, remoteURL string) error {
+	args := map[string]interface{}{"name": name, "url": sanitize(remoteURL)}
+	return g.record(ctx, repo, "add-remote", args, func() error {
+		return g.CoreGit.AddRemote(ctx, repo, name, remoteURL)
+	})
+}
+
+// RemoveRemote records the removal of a remote
+func (g *Git) RemoveRemote(ctx context.Context, repo *core.Repo, name string) error {
+	args := map[string]interface{}{"name": name}
+	return g.record(ctx, repo, "remove-remote", args, func() error {
+		return g.CoreGit.RemoveRemote(ctx, repo, name)
+	})
+}
+
+// SetRemoteURL records a change of remote URL
+func (g *Git) SetRemoteURL(ctx context.Context, repo *core.Repo, name, remoteURL string) error {
+	args := map[string]interface{}{"name": name, "url": sanitize(remoteURL)}
+	return g.record(ctx, repo, "set-remote-url", args, func() error {
+		return g.CoreGit.SetRemoteURL(ctx, repo, name, remoteURL)
+	})
+}
+
+// Fetch records a fetch
+func (g *Git) Fetch(ctx context.Context, repo *core.Repo, remote string, prune, tags bool) error {
+	args := map[string]interface{}{"remote": sanitize(remote), "prune": prune, "tags": tags}
+	return g.record(ctx, repo, "fetch", args, func() error {
+		return g.CoreGit.Fetch(ctx, repo, remote, prune, tags)
+	})
+}
+
+// Pull records a pull
+func (g *Git) Pull(ctx context.Context, repo *core.Repo, remote, branch string, rebase bool) error {
+	args := map[string]interface{}{"remote": sanitize(remote), "branch": branch, "rebase": rebase}
+	return g.record(ctx, repo, "pull", args, func() error {
+		return g.CoreGit.Pull(ctx, repo, remote, branch, rebase)
+	})
+}
+
+// Push records a push
+func (g *Git) Push(ctx context.Context, repo *core.Repo, remote, branch string, force, tags bool) error {
+	args := map[string]interface{}{"remote": sanitize(remote), "branch": branch, "force": force, "tags": tags}
+	return g.record(ctx, repo, "push", args, func() error {
+		return g.CoreGit.Push(ctx, repo, remote, branch, force, tags)
+	})
+}
+
+// CreateBranch records the creation of a branch
+func (g *Git) CreateBranch(ctx context.Context, repo *core.Repo, name, startPoint string) error {
+	args := map[string]interface{}{"name": name, "startPoint": startPoint}
+	return g.record(ctx, repo, "create-branch", args, func() error {
+		return g.CoreGit.CreateBranch(ctx, repo, name, startPoint)
+	})
+}
+
+// DeleteBranch records the deletion of a branch
+func (g *Git) DeleteBranch(ctx context.Context, repo *core.Repo, name string, force bool) error {
+	args := map[string]interface{}{"name": name, "force": force}
+	return g.record(ctx, repo, "delete-branch", args, func() error {
+		return g.CoreGit.DeleteBranch(ctx, repo, name, force)
+	})
+}
+
+// Checkout records a checkout
+func (g *Git) Checkout(ctx context.Context, repo *core.Repo, ref string, createBranch bool) error {
+	args := map[string]interface{}{"ref": ref, "createBranch": createBranch}
+	return g.record(ctx, repo, "checkout", args, func() error {
+		return g.CoreGit.Checkout(ctx, repo, ref, createBranch)
+	})
+}
+
+// Tag records the creation of a tag
+func (g *Git) Tag(ctx context.Context, repo *core.Repo, name, ref, message string, sign bool) error {
+	args := map[string]interface{}{"name": name, "ref": ref, "sign": sign}
+	return g.record(ctx, repo, "tag", args, func() error {
+		return g.CoreGit.Tag(ctx, repo, name, ref, message, sign)
+	})
+}
+
+// DeleteTag records the deletion of a tag
+func (g *Git) DeleteTag(ctx context.Context, repo *core.Repo, name string) error {
+	args := map[string]interface{}{"name": name}
+	return g.record(ctx, repo, "delete-tag", args, func() error {
+		return g.CoreGit.DeleteTag(ctx, repo, name)
+	})
+}
+
+// Merge records a merge
+func (g *Git) Merge(ctx context.Context, repo *core.Repo, ref string, noFF bool) error {
+	args := map[string]interface{}{"ref": ref, "noFF": noFF}
+	return g.record(ctx, repo, "merge", args, func() error {
+		return g.CoreGit.Merge(ctx, repo, ref, noFF)
+	})
+}
+
+// Rebase records a rebase
+func (g *Git) Rebase(ctx context.Context, repo *core.Repo, upstream string, interactive bool) error {
+	args := map[string]interface{}{"upstream": upstream, "interactive": interactive}
+	return g.record(ctx, repo, "rebase", args, func() error {
+		return g.CoreGit.Rebase(ctx, repo, upstream, interactive)
+	})
+}
+
+// CherryPick records a cherry-pick
+func (g *Git) CherryPick(ctx context.Context, repo *core.Repo, commit string) error {
+	args := map[string]interface{}{"commit": commit}
+	return g.record(ctx, repo, "cherry-pick", args, func() error {
+		return g.CoreGit.CherryPick(ctx, repo, commit)
+	})
+}
+
+// Revert records a revert
+func (g *Git) Revert(ctx context.Context, repo *core.Repo, commit string) error {
+	args := map[string]interface{}{"commit": commit}
+	return g.record(ctx, repo, "revert", args, func() error {
+		return g.CoreGit.Revert(ctx, repo, commit)
+	})
+}
+
+// StashSave records the creation of a stash
+func (g *Git) StashSave(ctx context.Context, repo *core.Repo, message string, includeUntracked bool) error {
+	args := map[string]interface{}{"message": message, "includeUntracked": includeUntracked}
+	return g.record(ctx, repo, "stash-save", args, func() error {
+		return g.CoreGit.StashSave(ctx, repo, message, includeUntracked)
+	})
+}
+
+// StashPop records the application and removal of a stash
+func (g *Git) StashPop(ctx context.Context, repo *core.Repo, index int) error {
+	args := map[string]interface{}{"index": index}
+	return g.record(ctx, repo, "stash-pop", args, func() error {
+		return g.CoreGit.StashPop(ctx, repo, index)
+	})
+}
+
+// WorktreeCreate records the creation of a worktree
+func (g *Git) WorktreeCreate(ctx context.Context, repo *core.Repo, path, branch string) error {
+	args := map[string]interface{}{"path": path, "branch": branch}
+	return g.record(ctx, repo, "worktree-create", args, func() error {
+		return g.CoreGit.WorktreeCreate(ctx, repo, path, branch)
+	})
+}
+
+// WorktreeRemove records the removal of a worktree
+func (g *Git) WorktreeRemove(ctx context.Context, repo *core.Repo, path string, force bool) error {
+	args := map[string]interface{}{"path": path, "force": force}
+	return g.record(ctx, repo, "worktree-remove", args, func() error {
+		return g.CoreGit.WorktreeRemove(ctx, repo, path, force)
+	})
+}
+
+// SubmoduleInit records the initialization of submodules
+func (g *Git) SubmoduleInit(ctx context.Context, repo *core.Repo, path string) error {
+	args := map[string]interface{}{"path": path}
+	return g.record(ctx, repo, "submodule-init", args, func() error {
+		return g.CoreGit.SubmoduleInit(ctx, repo, path)
+	})
+}
+
+// SubmoduleUpdate records an update of submodules
+func (g *Git) SubmoduleUpdate(ctx context.Context, repo *core.Repo, path string, recursive bool) error {
+	args := map[string]interface{}{"path": path, "recursive": recursive}
+	return g.record(ctx, repo, "submodule-update", args, func() error {
+		return g.CoreGit.SubmoduleUpdate(ctx, repo, path, recursive)
+	})
+}
+
+// LFSInstall records the installation of LFS hooks
+func (g *Git) LFSInstall(ctx context.Context, repo *core.Repo) error {
+	return g.record(ctx, repo, "lfs-install", nil, func() error {
+		return g.CoreGit.LFSInstall(ctx, repo)
+	})
+}
+
+// LFSFetch records a fetch of LFS objects
+func (g *Git) LFSFetch(ctx context.Context, repo *core.Repo, remote string) error {
+	args := map[string]interface{}{"remote": sanitize(remote)}
+	return g.record(ctx, repo, "lfs-fetch", args, func() error {
+		return g.CoreGit.LFSFetch(ctx, repo, remote)
+	})
+}
+
+// LFSPull records a pull of LFS objects
+func (g *Git) LFSPull(ctx context.Context, repo *core.Repo, remote string) error {
+	args := map[string]interface{}{"remote": sanitize(remote)}
+	return g.record(ctx, repo, "lfs-pull", args, func() error {
+		return g.CoreGit.LFSPull(ctx, repo, remote)
+	})
+}
+
+// GC records a garbage collection
+func (g *Git) GC(ctx context.Context, repo *core.Repo, aggressive, prune bool) error {
+	args := map[string]interface{}{"aggressive": aggressive, "prune": prune}
+	return g.record(ctx, repo, "gc", args, func() error {
+		return g.CoreGit.GC(ctx, repo, aggressive, prune)
+	})
+}
+
+// RestoreSnapshot records the restoration of an undo snapshot
+func (g *Git) RestoreSnapshot(ctx context.Context, repo *core.Repo, id string) error {
+	args := map[string]interface{}{"snapshot": id}
+	return g.record(ctx, repo, "undo", args, func() error {
+		return g.CoreGit.RestoreSnapshot(ctx, repo, id)
+	})
+}
+
+// RunRaw records every raw command, since whether it modifies the
+// repository depends on its arguments. Commands exiting with a non-zero
+// status are recorded as failures.
+func (g *Git) RunRaw(ctx context.Context, repo *core.Repo, args []string) (*core.ExecResult, error) {
+	sanitized := make([]string, len(args))
+	for i, arg := range args {
+		sanitized[i] = sanitize(arg)
+	}
+
+	before := gitstate.ReadRefs(repo.GitDir)
+	result, err := g.CoreGit.RunRaw(ctx, repo, args)
+	outcome := err
+	if err == nil && result.ExitCode != 0 {
+		outcome = fmt.Errorf("git exited with code %d", result.ExitCode)
+	}
+	refs := diffRefs(before, gitstate.ReadRefs(repo.GitDir))
+	g.append(ctx, repo.Path, "raw", map[string]interface{}{"args": sanitized}, refs, outcome)
+	return result, err
+}
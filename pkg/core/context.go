@@ -0,0 +1,18 @@
+package core
+
+import "context"
+
+// callerKey is the context key for WithCaller
+type callerKey struct{}
+
+// WithCaller returns a context identifying who requested the operations run
+// with it. The caller selects the policy profile applied to raw commands.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+// CallerFromContext returns the caller set with WithCaller, or "" if none
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey{}).(string)
+	return caller
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors describing why a Git operation failed.
+// Use errors.Is to test for them; failures of the git binary are reported
+// as *GitError wrapping one of these.
+var (
+	ErrNotARepository        = errors.New("not a git repository")
+	ErrConflict              = errors.New("merge conflict")
+	ErrNonFastForward        = errors.New("non-fast-forward update rejected")
+	ErrAuthRequired          = errors.New("authentication required")
+	ErrRefNotFound           = errors.New("reference not found")
+	ErrDirtyWorktree         = errors.New("local changes would be overwritten")
+	ErrLocked                = errors.New("repository is locked by another git process")
+	ErrAlreadyExists         = errors.New("already exists")
+	ErrNotFullyMerged        = errors.New("branch is not fully merged")
+	ErrRemoteUnreachable     = errors.New("remote repository unreachable")
+	ErrInvalidArgument       = errors.New("invalid argument")
+	ErrNotImplemented        = errors.New("not implemented yet")
+	ErrUnsupportedGitVersion = errors.New("operation not supported by the installed git version")
+	ErrPolicyDenied          = errors.New("command not allowed by policy")
+	ErrCommandFailed         = errors.New("git command failed")
+)
+
+// GitError describes a failed Git operation
+type GitError struct {
+	Op       string    // Operation that failed, e.g. "push"
+	Kind     error     // One of the sentinel errors above
+	ExitCode int       // Exit code of the git process, 0 if git was not run
+	Stderr   string    // Sanitized stderr of the git process
+	Message  string    // Optional user-friendly message
+	Hint     *AuthHint // Guidance for authentication failures, if any
+}
+
+// Error returns the user-friendly message, or the operation and git's stderr
+func (e *GitError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+
+	detail := strings.TrimSpace(e.Stderr)
+	if detail == "" && e.Kind != nil {
+		detail = e.Kind.Error()
+	}
+	if e.Op == "" {
+		return detail
+	}
+	return fmt.Sprintf("%s failed: %s", e.Op, detail)
+}
+
+// Unwrap returns the sentinel error so errors.Is works
+func (e *GitError) Unwrap() error {
+	return e.Kind
+}
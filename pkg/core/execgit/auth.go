@@ -0,0 +1,165 @@
+package execgit
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// remoteTransport returns the transport ("ssh", "https", "http" or "file")
+// and host of a remote URL. Both scp-like (git@host:path) and URL forms are
+// understood.
+func remoteTransport(remoteURL string) (transport, host string) {
+	if strings.Contains(remoteURL, "://") {
+		u, err := url.Parse(remoteURL)
+		if err != nil {
+			return "", ""
+		}
+		switch u.Scheme {
+		case "ssh", "git+ssh", "ssh+git":
+			return "ssh", u.Hostname()
+		default:
+			return u.Scheme, u.Hostname()
+		}
+	}
+
+	// scp-like syntax: [user@]host:path, with no slash before the colon
+	colon := strings.Index(remoteURL, ":")
+	if colon > 0 && !strings.Contains(remoteURL[:colon], "/") {
+		host = remoteURL[:colon]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+		return "ssh", host
+	}
+
+	return "file", ""
+}
+
+// hasURLCredentials reports whether an http(s) URL embeds a user or token
+func hasURLCredentials(remoteURL string) bool {
+	u, err := url.Parse(remoteURL)
+	return err == nil && u.User != nil
+}
+
+// credentialsRejected reports whether stderr shows the server refused
+// credentials that were offered, as opposed to none being available
+func credentialsRejected(stderr string) bool {
+	for _, fragment := range []string{
+		"Authentication failed",
+		"Invalid username or password",
+		"The requested URL returned error: 401",
+		"The requested URL returned error: 403",
+	} {
+		if strings.Contains(stderr, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// authHint explains an authentication failure of a remote operation.
+// helpers are the configured credential helpers. It returns nil if the
+// failure cannot be attributed to a known cause.
+func authHint(remoteURL, stderr string, helpers []string) *core.AuthHint {
+	transport, host := remoteTransport(remoteURL)
+	if host == "" {
+		host = "the remote"
+	}
+
+	helper := ""
+	if len(helpers) > 0 {
+		helper = helpers[len(helpers)-1]
+	}
+
+	switch transport {
+	case "ssh":
+		if strings.Contains(stderr, "Host key verification failed") {
+			return &core.AuthHint{
+				Type:    "ssh",
+				Message: fmt.Sprintf("The SSH host key for %s is unknown or has changed. Verify its fingerprint and add it to ~/.ssh/known_hosts, e.g. with ssh-keyscan %s", host, host),
+			}
+		}
+		return &core.AuthHint{
+			Type:    "ssh",
+			Message: fmt.Sprintf("No SSH key was accepted by %s. Load a key into ssh-agent with ssh-add or set core.sshCommand to use a specific key", host),
+		}
+
+	case "https", "http":
+		if credentialsRejected(stderr) || hasURLCredentials(remoteURL) {
+			return &core.AuthHint{
+				Type:    "token",
+				Message: fmt.Sprintf("The credentials for %s were rejected. The access token may be expired, revoked or missing the required scopes", host),
+				Helper:  helper,
+			}
+		}
+		if helper == "" {
+			return &core.AuthHint{
+				Type:    "https",
+				Message: fmt.Sprintf("No credential helper is configured for %s. Configure one with git config credential.helper or use an SSH remote", host),
+			}
+		}
+		return &core.AuthHint{
+			Type:    "https",
+			Message: fmt.Sprintf("The credential helper has no credentials for %s. Sign in with the helper or store an access token for this host", host),
+			Helper:  helper,
+		}
+	}
+
+	return nil
+}
+
+// attachAuthHint sets gitErr.Hint when gitErr is an authentication failure.
+// dir is where git config is read from; remoteURL is the remote that was used.
+func (e *ExecGit) attachAuthHint(ctx context.Context, dir, remoteURL string, gitErr *core.GitError) {
+	if gitErr.Kind != core.ErrAuthRequired {
+		return
+	}
+	gitErr.Hint = authHint(remoteURL, gitErr.Stderr, e.credentialHelpers(ctx, dir))
+}
+
+// credentialHelpers returns the credential helpers configured for dir
+func (e *ExecGit) credentialHelpers(ctx context.Context, dir string) []string {
+	result, err := e.run(ctx, dir, []string{"config", "--get-all", "credential.helper"})
+	if err != nil || result.ExitCode != 0 {
+		return nil
+	}
+
+	var helpers []string
+	for _, line := range strings.Split(strings.TrimSuffix(result.Stdout, "\n"), "\n") {
+		// An empty value resets the list of helpers
+		line = strings.TrimSpace(line)
+		if line == "" {
+			helpers = nil
+			continue
+		}
+		helpers = append(helpers, line)
+	}
+	return helpers
+}
+
+// remoteURL returns the URL of remote, defaulting to origin, or its push
+// URL if push is set. Remotes given as URLs are returned unchanged.
+func (e *ExecGit) remoteURL(ctx context.Context, repo *core.Repo, remote string, push bool) string {
+	if remote == "" {
+		remote = "origin"
+	}
+	if transport, _ := remoteTransport(remote); transport != "file" {
+		return remote
+	}
+
+	args, err := executil.NewCommand("remote get-url").FlagIf(push, "--push").Arg(remote).Build()
+	if err != nil {
+		return ""
+	}
+
+	result, err := e.runRepo(ctx, repo, args)
+	if err != nil || result.ExitCode != 0 {
+		return ""
+	}
+	return strings.TrimSpace(result.Stdout)
+}
@@ -0,0 +1,30 @@
+package execgit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// Capabilities reports the installed git version and supported features.
+// Detection runs once per ExecGit and is cached.
+func (e *ExecGit) Capabilities(ctx context.Context) (*core.Capabilities, error) {
+	return e.executor.Capabilities(ctx)
+}
+
+// require returns core.ErrUnsupportedGitVersion if the installed git lacks
+// feature. operation names what needed the feature in the error message.
+func (e *ExecGit) require(ctx context.Context, feature, operation string) error {
+	caps, err := e.Capabilities(ctx)
+	if err != nil {
+		return err
+	}
+	if caps.Has(feature) {
+		return nil
+	}
+	return &core.GitError{
+		Kind:    core.ErrUnsupportedGitVersion,
+		Message: fmt.Sprintf("%s requires a newer git than %s (missing %s)", operation, caps.Version, feature),
+	}
+}
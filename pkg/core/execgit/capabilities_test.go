@@ -0,0 +1,68 @@
+package execgit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// newOldGit returns an ExecGit whose git binary reports version 2.20.1
+func newOldGit(t *testing.T) *ExecGit {
+	t.Helper()
+
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not installed")
+	}
+
+	wrapper := filepath.Join(t.TempDir(), "git")
+	script := "#!/bin/sh\nif [ \"$3\" = version ]; then echo 'git version 2.20.1'; exit 0; fi\nexec " + gitPath + " \"$@\"\n"
+	if err := os.WriteFile(wrapper, []byte(script), 0755); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	config := executil.DefaultExecutorConfig()
+	config.GitPath = wrapper
+	return New(WithExecutorConfig(config))
+}
+
+func TestCapabilitiesOldGit(t *testing.T) {
+	git := newOldGit(t)
+	ctx := context.Background()
+
+	caps, err := git.Capabilities(ctx)
+	if err != nil {
+		t.Fatalf("Capabilities failed: %v", err)
+	}
+	if caps.Version != "2.20.1" || caps.Has(core.FeatureBranchShowCurrent) {
+		t.Errorf("Unexpected capabilities: %+v", caps)
+	}
+
+	// Current branch falls back to symbolic-ref
+	repo, err := git.Init(ctx, filepath.Join(t.TempDir(), "repo"), false)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if _, err := git.RunRaw(ctx, repo, []string{"checkout", "-b", "feature"}); err != nil {
+		t.Fatalf("checkout failed: %v", err)
+	}
+	status, err := git.GetStatus(ctx, repo)
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if status.Branch != "feature" {
+		t.Errorf("Expected branch feature, got %q", status.Branch)
+	}
+
+	// Sparse clones need git 2.27
+	_, err = git.Clone(ctx, core.CloneOptions{URL: repo.Path, Path: filepath.Join(t.TempDir(), "clone"), Sparse: []string{"docs"}})
+	if !errors.Is(err, core.ErrUnsupportedGitVersion) {
+		t.Errorf("Expected ErrUnsupportedGitVersion, got %v", err)
+	}
+}
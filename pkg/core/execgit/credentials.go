@@ -0,0 +1,336 @@
+package execgit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// SetCredentialProvider configures where remote operations get credentials from.
+// A nil provider disables credential injection.
+func (e *ExecGit) SetCredentialProvider(provider core.CredentialProvider) {
+	e.credentials = provider
+}
+
+// runRemote runs a git command in dir that talks to remoteURL, holding the
+// lock of key (see runLocked) and injecting credentials from the
+// configured provider. Provider failures are logged and the command runs
+// without credentials.
+func (e *ExecGit) runRemote(ctx context.Context, key, dir, remoteURL string, args []string) (*executil.ExecResult, error) {
+	if e.credentials == nil || remoteURL == "" {
+		return e.runLocked(ctx, key, dir, args, nil)
+	}
+
+	cred, err := e.credentials.Credential(withExecutor(ctx, e.executor), remoteURL)
+	if err != nil {
+		e.logger.WithContext(ctx).Warn("Credential lookup failed", map[string]interface{}{
+			"url":   sanitizeURL(remoteURL),
+			"error": err.Error(),
+		})
+		cred = nil
+	}
+
+	if cred != nil && cred.URL == "" {
+		scoped := *cred
+		scoped.URL = remoteURL
+		cred = &scoped
+	}
+	return e.runLocked(ctx, key, dir, args, cred)
+}
+
+// StaticToken provides the same token for HTTPS remotes on the given hosts.
+// The token is never sent to other hosts or over plain HTTP.
+type StaticToken struct {
+	Username string
+	Token    string
+	Hosts    []string
+}
+
+// NewStaticToken creates a provider for a personal access token accepted by
+// hosts. An empty username defaults to "x-access-token".
+func NewStaticToken(username, token string, hosts ...string) *StaticToken {
+	if username == "" {
+		username = "x-access-token"
+	}
+	return &StaticToken{Username: username, Token: token, Hosts: hosts}
+}
+
+// Credential implements core.CredentialProvider
+func (p *StaticToken) Credential(ctx context.Context, remoteURL string) (*core.Credential, error) {
+	transport, host := remoteTransport(remoteURL)
+	if p.Token == "" || transport != "https" || !matchHost(p.Hosts, host) {
+		return nil, nil
+	}
+	return &core.Credential{Username: p.Username, Password: p.Token}, nil
+}
+
+// matchHost reports whether host is one of hosts, ignoring case
+func matchHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if h = strings.TrimSpace(h); h != "" && strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvCredentials reads credentials from environment variables
+type EnvCredentials struct {
+	UsernameVar string
+	TokenVar    string
+	HostVar     string
+	SSHKeyVar   string
+}
+
+// NewEnvCredentials creates a provider reading GITMGR_GIT_USERNAME,
+// GITMGR_GIT_TOKEN, GITMGR_GIT_HOST and GITMGR_SSH_KEY. The token is only
+// sent to the comma-separated hosts of GITMGR_GIT_HOST.
+func NewEnvCredentials() *EnvCredentials {
+	return &EnvCredentials{
+		UsernameVar: "GITMGR_GIT_USERNAME",
+		TokenVar:    "GITMGR_GIT_TOKEN",
+		HostVar:     "GITMGR_GIT_HOST",
+		SSHKeyVar:   "GITMGR_SSH_KEY",
+	}
+}
+
+// Credential implements core.CredentialProvider
+func (p *EnvCredentials) Credential(ctx context.Context, remoteURL string) (*core.Credential, error) {
+	transport, _ := remoteTransport(remoteURL)
+	switch transport {
+	case "https":
+		token := os.Getenv(p.TokenVar)
+		if token == "" {
+			return nil, nil
+		}
+		hosts := strings.Split(os.Getenv(p.HostVar), ",")
+		return NewStaticToken(os.Getenv(p.UsernameVar), token, hosts...).Credential(ctx, remoteURL)
+	case "ssh":
+		if key := os.Getenv(p.SSHKeyVar); key != "" {
+			return &core.Credential{SSHKeyFile: key}, nil
+		}
+	}
+	return nil, nil
+}
+
+// NetrcCredentials looks up HTTPS credentials in a netrc file
+type NetrcCredentials struct {
+	Path string
+}
+
+// NewNetrcCredentials creates a provider for the netrc file at path.
+// An empty path defaults to $NETRC or ~/.netrc.
+func NewNetrcCredentials(path string) *NetrcCredentials {
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, ".netrc")
+		}
+	}
+	return &NetrcCredentials{Path: path}
+}
+
+// Credential implements core.CredentialProvider
+func (p *NetrcCredentials) Credential(ctx context.Context, remoteURL string) (*core.Credential, error) {
+	transport, host := remoteTransport(remoteURL)
+	if transport != "https" && transport != "http" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(p.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netrc: %w", err)
+	}
+
+	return parseNetrc(string(data), host), nil
+}
+
+// parseNetrc returns the credentials for host from netrc content,
+// falling back to the default entry
+func parseNetrc(content, host string) *core.Credential {
+	var (
+		match, fallback *core.Credential
+		current         *core.Credential
+	)
+
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			next := func() string {
+				if j+1 < len(fields) {
+					j++
+					return fields[j]
+				}
+				return ""
+			}
+
+			switch fields[j] {
+			case "machine":
+				current = nil
+				if next() == host && match == nil {
+					match = &core.Credential{}
+					current = match
+				}
+			case "default":
+				current = nil
+				if fallback == nil {
+					fallback = &core.Credential{}
+					current = fallback
+				}
+			case "login":
+				if value := next(); current != nil {
+					current.Username = value
+				}
+			case "password":
+				if value := next(); current != nil {
+					current.Password = value
+				}
+			case "macdef":
+				// Macro definitions run until the next blank line
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+
+	if match != nil && match.Password != "" {
+		return match
+	}
+	if fallback != nil && fallback.Password != "" {
+		return fallback
+	}
+	return nil
+}
+
+// GitCredentialHelper delegates to the credential helpers configured in git
+type GitCredentialHelper struct{}
+
+// NewGitCredentialHelper creates a provider that asks git's configured helpers
+func NewGitCredentialHelper() *GitCredentialHelper {
+	return &GitCredentialHelper{}
+}
+
+// executorKey is the context key for withExecutor
+type executorKey struct{}
+
+// withExecutor returns a context making GitCredentialHelper run git with
+// executor, so helpers get the git binary, environment, config overrides and
+// process limits of the ExecGit asking for credentials
+func withExecutor(ctx context.Context, executor *executil.GitExecutor) context.Context {
+	return context.WithValue(ctx, executorKey{}, executor)
+}
+
+// Credential implements core.CredentialProvider.
+// Git runs through the executor of the ExecGit asking for credentials, or a
+// default one, outside any repository. Helpers needing more of the user's
+// environment, such as keyring integrations, get it through
+// ExecutorConfig.PassEnv. Prompts are disabled.
+func (p *GitCredentialHelper) Credential(ctx context.Context, remoteURL string) (*core.Credential, error) {
+	if !isHTTPRemote(remoteURL) {
+		return nil, nil
+	}
+
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return nil, nil
+	}
+
+	var input bytes.Buffer
+	fmt.Fprintf(&input, "protocol=%s\nhost=%s\n", u.Scheme, u.Host)
+	if path := strings.TrimPrefix(u.Path, "/"); path != "" {
+		fmt.Fprintf(&input, "path=%s\n", path)
+	}
+	if u.User != nil {
+		fmt.Fprintf(&input, "username=%s\n", u.User.Username())
+	}
+	input.WriteString("\n")
+
+	executor, _ := ctx.Value(executorKey{}).(*executil.GitExecutor)
+	if executor == nil {
+		executor = executil.NewGitExecutor()
+	}
+	ctx = executil.WithEnv(ctx, "GIT_ASKPASS=", "SSH_ASKPASS=")
+	result, err := executor.RunWithInput(ctx, os.TempDir(), []string{"credential", "fill"}, &input)
+	if err != nil || result.ExitCode != 0 {
+		// No helper had credentials and prompting is disabled
+		return nil, nil
+	}
+
+	cred := &core.Credential{}
+	scanner := bufio.NewScanner(strings.NewReader(result.Stdout))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "username":
+			cred.Username = value
+		case "password":
+			cred.Password = value
+		}
+	}
+
+	if cred.Password == "" {
+		return nil, nil
+	}
+	return cred, nil
+}
+
+// ChainCredentials tries providers in order and returns the first credentials found
+type ChainCredentials []core.CredentialProvider
+
+// Credential implements core.CredentialProvider
+func (c ChainCredentials) Credential(ctx context.Context, remoteURL string) (*core.Credential, error) {
+	for _, provider := range c {
+		cred, err := provider.Credential(ctx, remoteURL)
+		if err != nil {
+			return nil, err
+		}
+		if cred != nil {
+			return cred, nil
+		}
+	}
+	return nil, nil
+}
+
+// NewCredentialChain builds a chain from source names: "env", "netrc" and "helper"
+func NewCredentialChain(sources []string) (ChainCredentials, error) {
+	var chain ChainCredentials
+	for _, source := range sources {
+		switch strings.TrimSpace(source) {
+		case "env":
+			chain = append(chain, NewEnvCredentials())
+		case "netrc":
+			chain = append(chain, NewNetrcCredentials(""))
+		case "helper":
+			chain = append(chain, NewGitCredentialHelper())
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown credential source: %s", source)
+		}
+	}
+	return chain, nil
+}
+
+// isHTTPRemote reports whether remoteURL uses HTTP or HTTPS
+func isHTTPRemote(remoteURL string) bool {
+	transport, _ := remoteTransport(remoteURL)
+	return transport == "https" || transport == "http"
+}
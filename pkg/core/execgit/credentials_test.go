@@ -0,0 +1,149 @@
+package execgit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+func TestParseNetrc(t *testing.T) {
+	content := `machine github.com
+  login alice
+  password token1
+
+macdef init
+machine example.com login bob password nope
+
+machine gitlab.com login carol password token2
+default login anon password token3
+`
+
+	tests := []struct {
+		host     string
+		username string
+		password string
+	}{
+		{"github.com", "alice", "token1"},
+		{"gitlab.com", "carol", "token2"},
+		{"example.com", "anon", "token3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			cred := parseNetrc(content, tt.host)
+			if cred == nil {
+				t.Fatal("Expected credentials")
+			}
+			if cred.Username != tt.username || cred.Password != tt.password {
+				t.Errorf("Expected %s/%s, got %s/%s", tt.username, tt.password, cred.Username, cred.Password)
+			}
+		})
+	}
+}
+
+func TestEnvCredentials(t *testing.T) {
+	t.Setenv("GITMGR_GIT_TOKEN", "token")
+	t.Setenv("GITMGR_GIT_HOST", "example.com, GitHub.com")
+	t.Setenv("GITMGR_GIT_USERNAME", "")
+	t.Setenv("GITMGR_SSH_KEY", "/keys/id_ed25519")
+	provider := NewEnvCredentials()
+	ctx := context.Background()
+
+	cred, err := provider.Credential(ctx, "https://github.com/user/repo.git")
+	if err != nil || cred == nil {
+		t.Fatalf("Expected HTTPS credentials, got %v, %v", cred, err)
+	}
+	if cred.Username != "x-access-token" || cred.Password != "token" {
+		t.Errorf("Unexpected HTTPS credentials: %+v", *cred)
+	}
+
+	for _, remoteURL := range []string{
+		"https://attacker.example/user/repo.git",
+		"https://github.com.attacker.example/user/repo.git",
+		"http://github.com/user/repo.git",
+	} {
+		if cred, err := provider.Credential(ctx, remoteURL); err != nil || cred != nil {
+			t.Errorf("Expected no credentials for %s, got %v, %v", remoteURL, cred, err)
+		}
+	}
+
+	t.Setenv("GITMGR_GIT_HOST", "")
+	if cred, err := provider.Credential(ctx, "https://github.com/user/repo.git"); err != nil || cred != nil {
+		t.Errorf("Expected no credentials without configured hosts, got %v, %v", cred, err)
+	}
+
+	cred, err = provider.Credential(ctx, "git@github.com:user/repo.git")
+	if err != nil || cred == nil || cred.SSHKeyFile != "/keys/id_ed25519" {
+		t.Errorf("Expected SSH key credentials, got %v, %v", cred, err)
+	}
+}
+
+func TestChainCredentials(t *testing.T) {
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(netrc, []byte("machine example.com login bob password fromnetrc\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	chain := ChainCredentials{
+		NewStaticToken("", ""),
+		NewNetrcCredentials(netrc),
+		NewStaticToken("", "fallback", "other.com"),
+	}
+	ctx := context.Background()
+
+	cred, err := chain.Credential(ctx, "https://example.com/repo.git")
+	if err != nil || cred == nil || cred.Password != "fromnetrc" {
+		t.Errorf("Expected netrc credentials, got %v, %v", cred, err)
+	}
+	cred, err = chain.Credential(ctx, "https://other.com/repo.git")
+	if err != nil || cred == nil || cred.Password != "fallback" {
+		t.Errorf("Expected fallback credentials, got %v, %v", cred, err)
+	}
+	cred, err = chain.Credential(ctx, "https://unknown.com/repo.git")
+	if err != nil || cred != nil {
+		t.Errorf("Expected no credentials for an unknown host, got %v, %v", cred, err)
+	}
+}
+
+func TestCredentialRedaction(t *testing.T) {
+	cred := core.Credential{Username: "alice", Password: "s3cret"}
+	for _, format := range []string{"%v", "%+v", "%s", "%#v"} {
+		if out := fmt.Sprintf(format, cred); strings.Contains(out, "s3cret") {
+			t.Errorf("Password leaked with %s: %s", format, out)
+		}
+	}
+}
+
+func TestGitCredentialHelperUsesExecutor(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	config := executil.DefaultExecutorConfig()
+	config.Isolated = true
+	config.Config = []string{"credential.helper=!f() { echo username=alice; echo password=fromhelper; }; f"}
+	ctx := withExecutor(context.Background(), executil.NewGitExecutorWithConfig(config))
+
+	provider := NewGitCredentialHelper()
+	cred, err := provider.Credential(ctx, "https://example.com/repo.git")
+	if err != nil || cred == nil {
+		t.Fatalf("Expected credentials from the configured helper, got %v, %v", cred, err)
+	}
+	if cred.Username != "alice" || cred.Password != "fromhelper" {
+		t.Errorf("Unexpected credentials: %+v", *cred)
+	}
+
+	// Without the override no helper is configured
+	config.Config = nil
+	ctx = withExecutor(context.Background(), executil.NewGitExecutorWithConfig(config))
+	if cred, err := provider.Credential(ctx, "https://example.com/repo.git"); err != nil || cred != nil {
+		t.Errorf("Expected no credentials, got %v, %v", cred, err)
+	}
+}
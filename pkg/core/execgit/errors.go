@@ -0,0 +1,83 @@
+package execgit
+
+import (
+	"strings"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// stderrPatterns maps git stderr fragments to error kinds. Order matters:
+// the first match wins, so more specific patterns come first. Commands run
+// with LC_ALL=C, so messages are always in English.
+var stderrPatterns = []struct {
+	fragment string
+	kind     error
+}{
+	{"not a git repository", core.ErrNotARepository},
+	{".lock': File exists", core.ErrLocked},
+	{"Another git process seems to be running", core.ErrLocked},
+	{"Authentication failed", core.ErrAuthRequired},
+	{"could not read Username", core.ErrAuthRequired},
+	{"could not read Password", core.ErrAuthRequired},
+	{"terminal prompts disabled", core.ErrAuthRequired},
+	{"Permission denied (publickey", core.ErrAuthRequired},
+	{"Host key verification failed", core.ErrAuthRequired},
+	{"The requested URL returned error: 401", core.ErrAuthRequired},
+	{"The requested URL returned error: 403", core.ErrAuthRequired},
+	{"non-fast-forward", core.ErrNonFastForward},
+	{"[rejected]", core.ErrNonFastForward},
+	{"Updates were rejected", core.ErrNonFastForward},
+	{"Not possible to fast-forward", core.ErrNonFastForward},
+	{"would be overwritten", core.ErrDirtyWorktree},
+	{"Your local changes", core.ErrDirtyWorktree},
+	{"uncommitted changes", core.ErrDirtyWorktree},
+	{"unstaged changes", core.ErrDirtyWorktree},
+	{"CONFLICT", core.ErrConflict},
+	{"merge conflict", core.ErrConflict},
+	{"fix conflicts", core.ErrConflict},
+	{"not fully merged", core.ErrNotFullyMerged},
+	{"already exists", core.ErrAlreadyExists},
+	{"unknown revision", core.ErrRefNotFound},
+	{"bad revision", core.ErrRefNotFound},
+	{"not a valid ref", core.ErrRefNotFound},
+	{"did not match any file(s) known to git", core.ErrRefNotFound},
+	{"couldn't find remote ref", core.ErrRefNotFound},
+	{"invalid reference", core.ErrRefNotFound},
+	{"Repository not found", core.ErrRemoteUnreachable},
+	{"Could not resolve host", core.ErrRemoteUnreachable},
+	{"Connection refused", core.ErrRemoteUnreachable},
+	{"Connection timed out", core.ErrRemoteUnreachable},
+	{"unable to access", core.ErrRemoteUnreachable},
+	{"Could not read from remote repository", core.ErrRemoteUnreachable},
+	{"does not appear to be a git repository", core.ErrRemoteUnreachable},
+}
+
+// classifyStderr returns the error kind matching git's stderr
+func classifyStderr(stderr string) error {
+	for _, p := range stderrPatterns {
+		if strings.Contains(stderr, p.fragment) {
+			return p.kind
+		}
+	}
+	return core.ErrCommandFailed
+}
+
+// newGitError builds a typed error from a failed git invocation
+func newGitError(op string, result *executil.ExecResult) *core.GitError {
+	stderr := strings.TrimSpace(result.Stderr)
+	return &core.GitError{
+		Op:       op,
+		Kind:     classifyStderr(stderr),
+		ExitCode: result.ExitCode,
+		Stderr:   stderr,
+	}
+}
+
+// invalidArgument reports a missing or malformed argument before git is run
+func invalidArgument(message string) error {
+	return &core.GitError{
+		Kind:    core.ErrInvalidArgument,
+		Message: message,
+	}
+}
@@ -0,0 +1,134 @@
+package execgit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		name     string
+		stderr   string
+		expected error
+	}{
+		{
+			name:     "not a repository",
+			stderr:   "fatal: not a git repository (or any of the parent directories): .git",
+			expected: core.ErrNotARepository,
+		},
+		{
+			name:     "push rejected",
+			stderr:   " ! [rejected]        main -> main (non-fast-forward)\nerror: failed to push some refs",
+			expected: core.ErrNonFastForward,
+		},
+		{
+			name:     "push fetch first",
+			stderr:   " ! [rejected]        main -> main (fetch first)",
+			expected: core.ErrNonFastForward,
+		},
+		{
+			name:     "https auth",
+			stderr:   "fatal: could not read Username for 'https://github.com': terminal prompts disabled",
+			expected: core.ErrAuthRequired,
+		},
+		{
+			name:     "ssh auth",
+			stderr:   "git@github.com: Permission denied (publickey).\nfatal: Could not read from remote repository.",
+			expected: core.ErrAuthRequired,
+		},
+		{
+			name:     "merge conflict",
+			stderr:   "CONFLICT (content): Merge conflict in file.txt\nAutomatic merge failed; fix conflicts and then commit the result.",
+			expected: core.ErrConflict,
+		},
+		{
+			name:     "dirty worktree",
+			stderr:   "error: Your local changes to the following files would be overwritten by checkout:",
+			expected: core.ErrDirtyWorktree,
+		},
+		{
+			name:     "index lock",
+			stderr:   "fatal: Unable to create '/repo/.git/index.lock': File exists.",
+			expected: core.ErrLocked,
+		},
+		{
+			name:     "branch exists",
+			stderr:   "fatal: a branch named 'main' already exists",
+			expected: core.ErrAlreadyExists,
+		},
+		{
+			name:     "not fully merged",
+			stderr:   "error: The branch 'feature' is not fully merged.",
+			expected: core.ErrNotFullyMerged,
+		},
+		{
+			name:     "unknown revision",
+			stderr:   "fatal: ambiguous argument 'nope': unknown revision or path not in the working tree.",
+			expected: core.ErrRefNotFound,
+		},
+		{
+			name:     "missing remote ref",
+			stderr:   "fatal: couldn't find remote ref nope",
+			expected: core.ErrRefNotFound,
+		},
+		{
+			name:     "unresolvable host",
+			stderr:   "fatal: unable to access 'https://nope.invalid/repo.git/': Could not resolve host: nope.invalid",
+			expected: core.ErrRemoteUnreachable,
+		},
+		{
+			name:     "remote repository missing",
+			stderr:   "remote: Repository not found.\nfatal: repository 'https://github.com/user/nope.git/' not found",
+			expected: core.ErrRemoteUnreachable,
+		},
+		{
+			name:     "unrecognized",
+			stderr:   "fatal: something unexpected",
+			expected: core.ErrCommandFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyStderr(tt.stderr); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewGitError(t *testing.T) {
+	err := newGitError("push", &executil.ExecResult{
+		ExitCode: 1,
+		Stderr:   " ! [rejected] main -> main (non-fast-forward)\n",
+	})
+
+	if !errors.Is(err, core.ErrNonFastForward) {
+		t.Errorf("Expected errors.Is to match ErrNonFastForward, got %v", err.Kind)
+	}
+	if err.ExitCode != 1 {
+		t.Errorf("Expected exit code 1, got %d", err.ExitCode)
+	}
+	if expected := "push failed: ! [rejected] main -> main (non-fast-forward)"; err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	git := New()
+	ctx := context.Background()
+
+	if _, err := git.Open(ctx, t.TempDir()); !errors.Is(err, core.ErrNotARepository) {
+		t.Errorf("Expected ErrNotARepository, got %v", err)
+	}
+	if _, err := git.Clone(ctx, core.CloneOptions{}); !errors.Is(err, core.ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument, got %v", err)
+	}
+	if err := git.Merge(ctx, &core.Repo{}, "main", false); !errors.Is(err, core.ErrNotImplemented) {
+		t.Errorf("Expected ErrNotImplemented, got %v", err)
+	}
+}
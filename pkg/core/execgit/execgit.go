@@ -11,20 +11,42 @@ import (
 	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
 	"github.com/felipemacedo1/go-coregit-pe/internal/logging"
 	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/policy"
 )
 
 // ExecGit implements CoreGit interface using git binary
 type ExecGit struct {
-	executor *executil.GitExecutor
-	logger   *logging.Logger
+	executor    *executil.GitExecutor
+	logger      *logging.Logger
+	credentials core.CredentialProvider
+	policy      *policy.Policy
+	auditor     policy.Auditor
+	locks       *LockManager
+	lockConfig  LockConfig
+	tracers     []executil.Tracer
+	// snapshotLimit is the number of undo snapshots kept, 0 disables them
+	snapshotLimit int
 }
 
 // New creates a new ExecGit instance
-func New() *ExecGit {
-	return &ExecGit{
-		executor: executil.NewGitExecutor(),
-		logger:   logging.NewLogger(nil, false),
+func New(opts ...Option) *ExecGit {
+	e := &ExecGit{
+		executor:      executil.NewGitExecutor(),
+		logger:        logging.NewLogger(nil, false),
+		locks:         NewLockManager(),
+		lockConfig:    DefaultLockConfig(),
+		snapshotLimit: DefaultSnapshotLimit,
 	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.auditor == nil {
+		e.auditor = policy.NewLogAuditor(e.logger)
+	}
+	for _, t := range e.tracers {
+		e.executor.AddTracer(t)
+	}
+	return e
 }
 
 // Open opens an existing repository
@@ -35,9 +57,13 @@ func (e *ExecGit) Open(ctx context.Context, path string) (*core.Repo, error) {
 	}
 
 	// Check if it's a git repository
-	result, err := e.executor.Run(ctx, absPath, []string{"rev-parse", "--git-dir"})
+	result, err := e.run(ctx, absPath, []string{"rev-parse", "--git-dir"})
 	if err != nil || result.ExitCode != 0 {
-		return nil, fmt.Errorf("not a git repository: %s", absPath)
+		return nil, &core.GitError{
+			Op:      "open",
+			Kind:    core.ErrNotARepository,
+			Message: fmt.Sprintf("not a git repository: %s", absPath),
+		}
 	}
 
 	gitDir := strings.TrimSpace(result.Stdout)
@@ -46,7 +72,7 @@ func (e *ExecGit) Open(ctx context.Context, path string) (*core.Repo, error) {
 	}
 
 	// Check if bare repository
-	result, err = e.executor.Run(ctx, absPath, []string{"rev-parse", "--is-bare-repository"})
+	result, err = e.run(ctx, absPath, []string{"rev-parse", "--is-bare-repository"})
 	if err != nil {
 		return nil, fmt.Errorf("failed to check if bare repository: %w", err)
 	}
@@ -54,18 +80,27 @@ func (e *ExecGit) Open(ctx context.Context, path string) (*core.Repo, error) {
 	isBare := strings.TrimSpace(result.Stdout) == "true"
 
 	// Check if worktree
-	result, err = e.executor.Run(ctx, absPath, []string{"rev-parse", "--is-inside-work-tree"})
+	result, err = e.run(ctx, absPath, []string{"rev-parse", "--is-inside-work-tree"})
 	isWorktree := err == nil && result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "true"
 
+	// The worktree may start above path when path is a subdirectory
+	workDir := absPath
+	if isWorktree {
+		result, err = e.run(ctx, absPath, []string{"rev-parse", "--show-toplevel"})
+		if err == nil && result.ExitCode == 0 && strings.TrimSpace(result.Stdout) != "" {
+			workDir = strings.TrimSpace(result.Stdout)
+		}
+	}
+
 	repo := &core.Repo{
 		Path:       absPath,
-		WorkDir:    absPath,
+		WorkDir:    workDir,
 		GitDir:     gitDir,
 		IsBare:     isBare,
 		IsWorktree: isWorktree,
 	}
 
-	e.logger.Info("Opened repository", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Opened repository", map[string]interface{}{
 		"path":     absPath,
 		"bare":     isBare,
 		"worktree": isWorktree,
@@ -77,36 +112,40 @@ func (e *ExecGit) Open(ctx context.Context, path string) (*core.Repo, error) {
 // Clone clones a repository
 func (e *ExecGit) Clone(ctx context.Context, opts core.CloneOptions) (*core.Repo, error) {
 	if opts.URL == "" {
-		return nil, fmt.Errorf("clone URL is required")
+		return nil, invalidArgument("clone URL is required")
 	}
 	if opts.Path == "" {
-		return nil, fmt.Errorf("clone path is required")
+		return nil, invalidArgument("clone path is required")
 	}
 
-	args := []string{"clone"}
+	cmd := executil.NewCommand("clone")
 
 	if opts.Branch != "" {
-		args = append(args, "--branch", opts.Branch)
+		cmd.BranchOption("--branch", opts.Branch)
 	}
 	if opts.Depth > 0 {
-		args = append(args, "--depth", strconv.Itoa(opts.Depth))
-	}
-	if opts.Bare {
-		args = append(args, "--bare")
-	}
-	if opts.Mirror {
-		args = append(args, "--mirror")
-	}
-	if opts.Recursive {
-		args = append(args, "--recursive")
-	}
-	if opts.Progress {
-		args = append(args, "--progress")
+		cmd.Option("--depth", strconv.Itoa(opts.Depth))
+	}
+	cmd.FlagIf(opts.Bare, "--bare").
+		FlagIf(opts.Mirror, "--mirror").
+		FlagIf(opts.Recursive, "--recursive")
+	sparse := len(opts.Sparse) > 0 && !opts.Bare && !opts.Mirror
+	if sparse {
+		for _, feature := range []string{core.FeatureCloneSparse, core.FeatureSparseCheckout} {
+			if err := e.require(ctx, feature, "sparse clone"); err != nil {
+				return nil, err
+			}
+		}
+		cmd.Flag("--sparse")
 	}
+	cmd.FlagIf(opts.Progress, "--progress")
 
-	args = append(args, opts.URL, opts.Path)
+	args, err := cmd.URL(opts.URL).Arg(opts.Path).Build()
+	if err != nil {
+		return nil, err
+	}
 
-	e.logger.Info("Cloning repository", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Cloning repository", map[string]interface{}{
 		"url":    sanitizeURL(opts.URL),
 		"path":   opts.Path,
 		"branch": opts.Branch,
@@ -115,28 +154,65 @@ func (e *ExecGit) Clone(ctx context.Context, opts core.CloneOptions) (*core.Repo
 
 	// Clone from parent directory
 	parentDir := filepath.Dir(opts.Path)
-	result, err := e.executor.Run(ctx, parentDir, args)
+	result, err := e.runRemote(ctx, opts.Path, parentDir, opts.URL, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute clone: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return nil, fmt.Errorf("clone failed: %s", result.Stderr)
+		gitErr := newGitError("clone", result)
+		e.attachAuthHint(ctx, parentDir, opts.URL, gitErr)
+		return nil, gitErr
 	}
 
 	// Open the cloned repository
-	return e.Open(ctx, opts.Path)
+	repo, err := e.Open(ctx, opts.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Restrict the checkout to the requested directories
+	if sparse {
+		sparseArgs, err := executil.NewCommand("sparse-checkout set").Paths(opts.Sparse...).Build()
+		if err != nil {
+			return nil, err
+		}
+		result, err = e.runRepo(ctx, repo, sparseArgs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute sparse-checkout: %w", err)
+		}
+		if result.ExitCode != 0 {
+			return nil, newGitError("sparse-checkout", result)
+		}
+	}
+
+	return repo, nil
+}
+
+// currentBranch returns the checked out branch, or "" for a detached HEAD.
+// Older git versions without branch --show-current use symbolic-ref.
+func (e *ExecGit) currentBranch(ctx context.Context, repo *core.Repo) (string, error) {
+	args := []string{"branch", "--show-current"}
+	if caps, err := e.Capabilities(ctx); err == nil && !caps.Has(core.FeatureBranchShowCurrent) {
+		args = []string{"symbolic-ref", "--quiet", "--short", "HEAD"}
+	}
+
+	result, err := e.runRepo(ctx, repo, args)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result.Stdout), nil
 }
 
 // GetStatus gets repository status
 func (e *ExecGit) GetStatus(ctx context.Context, repo *core.Repo) (*core.RepoStatus, error) {
 	// Get current branch
-	result, err := e.executor.Run(ctx, repo.Path, []string{"branch", "--show-current"})
+	branch, err := e.currentBranch(ctx, repo)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current branch: %w", err)
 	}
 
-	branch := strings.TrimSpace(result.Stdout)
+	var result *executil.ExecResult
 
 	// Get upstream info
 	upstream := ""
@@ -144,12 +220,12 @@ func (e *ExecGit) GetStatus(ctx context.Context, repo *core.Repo) (*core.RepoSta
 	behind := 0
 
 	if branch != "" {
-		result, err = e.executor.Run(ctx, repo.Path, []string{"rev-parse", "--abbrev-ref", branch + "@{upstream}"})
+		result, err = e.runRepo(ctx, repo, []string{"rev-parse", "--abbrev-ref", branch + "@{upstream}"})
 		if err == nil && result.ExitCode == 0 {
 			upstream = strings.TrimSpace(result.Stdout)
 
 			// Get ahead/behind counts
-			result, err = e.executor.Run(ctx, repo.Path, []string{"rev-list", "--count", "--left-right", branch + "..." + upstream})
+			result, err = e.runRepo(ctx, repo, []string{"rev-list", "--count", "--left-right", branch + "..." + upstream})
 			if err == nil && result.ExitCode == 0 {
 				counts := strings.Fields(strings.TrimSpace(result.Stdout))
 				if len(counts) == 2 {
@@ -161,7 +237,7 @@ func (e *ExecGit) GetStatus(ctx context.Context, repo *core.Repo) (*core.RepoSta
 	}
 
 	// Get file status
-	result, err = e.executor.Run(ctx, repo.Path, []string{"status", "--porcelain"})
+	result, err = e.runRepo(ctx, repo, []string{"status", "--porcelain"})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get status: %w", err)
 	}
@@ -196,18 +272,51 @@ func (e *ExecGit) GetStatus(ctx context.Context, repo *core.Repo) (*core.RepoSta
 	}, nil
 }
 
-// RunRaw executes a raw git command
+// RunRaw executes a raw git command. If a policy is configured, the command
+// must be allowed by the profile of the caller in ctx. Every invocation is
+// recorded with the auditor.
 func (e *ExecGit) RunRaw(ctx context.Context, repo *core.Repo, args []string) (*core.ExecResult, error) {
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	record := policy.Record{
+		Time:      time.Now(),
+		RequestID: logging.RequestIDFromContext(ctx),
+		Caller:    core.CallerFromContext(ctx),
+		Repo:      repo.Path,
+		Args:      make([]string, len(args)),
+	}
+	for i, arg := range args {
+		record.Args[i] = sanitizeURL(arg)
+	}
+
+	if e.policy != nil {
+		profile, err := e.policy.Check(record.Caller, args)
+		record.Profile = profile
+		if err != nil {
+			record.Reason = err.Error()
+			e.auditor.Audit(record)
+			return nil, err
+		}
+	}
+
+	record.Allowed = true
+	result, err := e.runRepo(ctx, repo, args)
+	record.Duration = time.Since(record.Time)
 	if err != nil {
+		record.Reason = err.Error()
+		e.auditor.Audit(record)
 		return nil, err
 	}
 
+	record.ExitCode = result.ExitCode
+	e.auditor.Audit(record)
+
 	return &core.ExecResult{
-		ExitCode: result.ExitCode,
-		Stdout:   result.Stdout,
-		Stderr:   result.Stderr,
-		Duration: result.Duration,
+		ExitCode:  result.ExitCode,
+		Stdout:    result.Stdout,
+		Stderr:    result.Stderr,
+		Duration:  result.Duration,
+		CPUTime:   result.CPUTime,
+		MaxRSS:    result.MaxRSS,
+		Truncated: result.Truncated,
 	}, nil
 }
 
@@ -238,20 +347,20 @@ func (e *ExecGit) Init(ctx context.Context, path string, bare bool) (*core.Repo,
 	}
 	args = append(args, absPath)
 
-	e.logger.Info("Initializing repository", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Initializing repository", map[string]interface{}{
 		"path": absPath,
 		"bare": bare,
 	})
 
 	// Init from parent directory
 	parentDir := filepath.Dir(absPath)
-	result, err := e.executor.Run(ctx, parentDir, args)
+	result, err := e.runLocked(ctx, absPath, parentDir, args, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute init: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return nil, fmt.Errorf("init failed: %s", result.Stderr)
+		return nil, newGitError("init", result)
 	}
 
 	// Open the initialized repository
@@ -265,9 +374,13 @@ func (e *ExecGit) Discover(ctx context.Context, path string) (*core.Repo, error)
 	}
 
 	// Find the git repository root
-	result, err := e.executor.Run(ctx, absPath, []string{"rev-parse", "--show-toplevel"})
+	result, err := e.run(ctx, absPath, []string{"rev-parse", "--show-toplevel"})
 	if err != nil || result.ExitCode != 0 {
-		return nil, fmt.Errorf("no git repository found at %s", absPath)
+		return nil, &core.GitError{
+			Op:      "discover",
+			Kind:    core.ErrNotARepository,
+			Message: fmt.Sprintf("no git repository found at %s", absPath),
+		}
 	}
 
 	repoRoot := strings.TrimSpace(result.Stdout)
@@ -276,16 +389,26 @@ func (e *ExecGit) Discover(ctx context.Context, path string) (*core.Repo, error)
 
 func (e *ExecGit) GetConfig(ctx context.Context, repo *core.Repo, key string) (string, error) {
 	if key == "" {
-		return "", fmt.Errorf("config key is required")
+		return "", invalidArgument("config key is required")
 	}
 
-	result, err := e.executor.Run(ctx, repo.Path, []string{"config", "--get", key})
+	args, err := executil.NewCommand("config").Flag("--get").Arg(key).Build()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return "", fmt.Errorf("failed to get config: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return "", fmt.Errorf("config key not found: %s", key)
+		return "", &core.GitError{
+			Op:       "config",
+			Kind:     core.ErrRefNotFound,
+			ExitCode: result.ExitCode,
+			Message:  fmt.Sprintf("config key not found: %s", key),
+		}
 	}
 
 	return strings.TrimSpace(result.Stdout), nil
@@ -293,25 +416,30 @@ func (e *ExecGit) GetConfig(ctx context.Context, repo *core.Repo, key string) (s
 
 func (e *ExecGit) SetConfig(ctx context.Context, repo *core.Repo, key, value string, global bool) error {
 	if key == "" {
-		return fmt.Errorf("config key is required")
+		return invalidArgument("config key is required")
 	}
 
-	args := []string{"config"}
-	if global {
-		args = append(args, "--global")
+	args, err := executil.NewCommand("config").
+		FlagIf(global, "--global").
+		Arg(key).
+		Value(value).
+		Build()
+	if err != nil {
+		return err
 	}
-	args = append(args, key, value)
 
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return fmt.Errorf("failed to set config: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to set config %s: %s", key, result.Stderr)
+		gitErr := newGitError("config", result)
+		gitErr.Message = fmt.Sprintf("failed to set config %s: %s", key, gitErr.Stderr)
+		return gitErr
 	}
 
-	e.logger.Info("Config updated", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Config updated", map[string]interface{}{
 		"key":    key,
 		"global": global,
 	})
@@ -320,13 +448,13 @@ func (e *ExecGit) SetConfig(ctx context.Context, repo *core.Repo, key, value str
 }
 
 func (e *ExecGit) ListRemotes(ctx context.Context, repo *core.Repo) ([]core.RemoteInfo, error) {
-	result, err := e.executor.Run(ctx, repo.Path, []string{"remote", "-v"})
+	result, err := e.runRepo(ctx, repo, []string{"remote", "-v"})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list remotes: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return nil, fmt.Errorf("failed to list remotes: %s", result.Stderr)
+		return nil, newGitError("remote", result)
 	}
 
 	remotes := make(map[string]*core.RemoteInfo)
@@ -373,22 +501,29 @@ func (e *ExecGit) ListRemotes(ctx context.Context, repo *core.Repo) ([]core.Remo
 
 func (e *ExecGit) AddRemote(ctx context.Context, repo *core.Repo, name, url string) error {
 	if name == "" {
-		return fmt.Errorf("remote name is required")
+		return invalidArgument("remote name is required")
 	}
 	if url == "" {
-		return fmt.Errorf("remote URL is required")
+		return invalidArgument("remote URL is required")
+	}
+
+	args, err := executil.NewCommand("remote add").Arg(name).URL(url).Build()
+	if err != nil {
+		return err
 	}
 
-	result, err := e.executor.Run(ctx, repo.Path, []string{"remote", "add", name, url})
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return fmt.Errorf("failed to add remote: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to add remote %s: %s", name, result.Stderr)
+		gitErr := newGitError("remote", result)
+		gitErr.Message = fmt.Sprintf("failed to add remote %s: %s", name, gitErr.Stderr)
+		return gitErr
 	}
 
-	e.logger.Info("Remote added", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Remote added", map[string]interface{}{
 		"name": name,
 		"url":  sanitizeURL(url),
 	})
@@ -398,19 +533,26 @@ func (e *ExecGit) AddRemote(ctx context.Context, repo *core.Repo, name, url stri
 
 func (e *ExecGit) RemoveRemote(ctx context.Context, repo *core.Repo, name string) error {
 	if name == "" {
-		return fmt.Errorf("remote name is required")
+		return invalidArgument("remote name is required")
 	}
 
-	result, err := e.executor.Run(ctx, repo.Path, []string{"remote", "remove", name})
+	args, err := executil.NewCommand("remote remove").Arg(name).Build()
+	if err != nil {
+		return err
+	}
+
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return fmt.Errorf("failed to remove remote: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to remove remote %s: %s", name, result.Stderr)
+		gitErr := newGitError("remote", result)
+		gitErr.Message = fmt.Sprintf("failed to remove remote %s: %s", name, gitErr.Stderr)
+		return gitErr
 	}
 
-	e.logger.Info("Remote removed", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Remote removed", map[string]interface{}{
 		"name": name,
 	})
 
@@ -419,22 +561,29 @@ func (e *ExecGit) RemoveRemote(ctx context.Context, repo *core.Repo, name string
 
 func (e *ExecGit) SetRemoteURL(ctx context.Context, repo *core.Repo, name, url string) error {
 	if name == "" {
-		return fmt.Errorf("remote name is required")
+		return invalidArgument("remote name is required")
 	}
 	if url == "" {
-		return fmt.Errorf("remote URL is required")
+		return invalidArgument("remote URL is required")
+	}
+
+	args, err := executil.NewCommand("remote set-url").Arg(name).URL(url).Build()
+	if err != nil {
+		return err
 	}
 
-	result, err := e.executor.Run(ctx, repo.Path, []string{"remote", "set-url", name, url})
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return fmt.Errorf("failed to set remote URL: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to set remote URL for %s: %s", name, result.Stderr)
+		gitErr := newGitError("remote", result)
+		gitErr.Message = fmt.Sprintf("failed to set remote URL for %s: %s", name, gitErr.Stderr)
+		return gitErr
 	}
 
-	e.logger.Info("Remote URL updated", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Remote URL updated", map[string]interface{}{
 		"name": name,
 		"url":  sanitizeURL(url),
 	})
@@ -443,139 +592,191 @@ func (e *ExecGit) SetRemoteURL(ctx context.Context, repo *core.Repo, name, url s
 }
 
 func (e *ExecGit) Fetch(ctx context.Context, repo *core.Repo, remote string, prune, tags bool) error {
-	args := []string{"fetch"}
-
+	cmd := executil.NewCommand("fetch").
+		FlagIf(prune, "--prune").
+		FlagIf(tags, "--tags")
 	if remote != "" {
-		args = append(args, remote)
-	}
-	if prune {
-		args = append(args, "--prune")
+		cmd.URL(remote)
 	}
-	if tags {
-		args = append(args, "--tags")
+	args, err := cmd.Build()
+	if err != nil {
+		return err
 	}
 
-	e.logger.Info("Fetching from remote", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Fetching from remote", map[string]interface{}{
 		"remote": remote,
 		"prune":  prune,
 		"tags":   tags,
 	})
 
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	remoteURL := e.remoteURL(ctx, repo, remote, false)
+	result, err := e.runRemote(ctx, lockKey(repo), repo.Path, remoteURL, args)
 	if err != nil {
 		return fmt.Errorf("failed to fetch: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return fmt.Errorf("fetch failed: %s", result.Stderr)
+		gitErr := newGitError("fetch", result)
+		e.attachAuthHint(ctx, repo.Path, remoteURL, gitErr)
+		return gitErr
 	}
 
 	return nil
 }
 
 func (e *ExecGit) Pull(ctx context.Context, repo *core.Repo, remote, branch string, rebase bool) error {
-	args := []string{"pull"}
-
-	if rebase {
-		args = append(args, "--rebase")
-	}
+	cmd := executil.NewCommand("pull").FlagIf(rebase, "--rebase")
 	if remote != "" {
-		args = append(args, remote)
+		cmd.URL(remote)
 		if branch != "" {
-			args = append(args, branch)
+			cmd.Arg(branch)
 		}
 	}
+	args, err := cmd.Build()
+	if err != nil {
+		return err
+	}
 
-	e.logger.Info("Pulling from remote", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Pulling from remote", map[string]interface{}{
 		"remote": remote,
 		"branch": branch,
 		"rebase": rebase,
 	})
 
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	remoteURL := e.remoteURL(ctx, repo, remote, false)
+	result, err := e.runRemote(ctx, lockKey(repo), repo.Path, remoteURL, args)
 	if err != nil {
 		return fmt.Errorf("failed to pull: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		// Check for common error patterns
-		if strings.Contains(result.Stderr, "merge conflict") {
-			return fmt.Errorf("pull failed due to merge conflicts: resolve conflicts and commit")
-		}
-		if strings.Contains(result.Stderr, "non-fast-forward") {
-			return fmt.Errorf("pull failed: non-fast-forward update rejected. Try pull --rebase or merge manually")
+		gitErr := newGitError("pull", result)
+		e.attachAuthHint(ctx, repo.Path, remoteURL, gitErr)
+		switch gitErr.Kind {
+		case core.ErrConflict:
+			gitErr.Message = "pull failed due to merge conflicts: resolve conflicts and commit"
+		case core.ErrNonFastForward:
+			gitErr.Message = "pull failed: non-fast-forward update rejected. Try pull --rebase or merge manually"
 		}
-		return fmt.Errorf("pull failed: %s", result.Stderr)
+		return gitErr
 	}
 
 	return nil
 }
 
 func (e *ExecGit) Push(ctx context.Context, repo *core.Repo, remote, branch string, force, tags bool) error {
-	args := []string{"push"}
-
-	if force {
-		args = append(args, "--force-with-lease")
-	}
-	if tags {
-		args = append(args, "--tags")
+	if branch != "" {
+		if err := validatePushBranch(branch); err != nil {
+			return err
+		}
 	}
+
+	cmd := executil.NewCommand("push").
+		FlagIf(force, "--force-with-lease").
+		FlagIf(tags, "--tags")
 	if remote != "" {
-		args = append(args, remote)
+		cmd.URL(remote)
 		if branch != "" {
-			args = append(args, branch)
+			cmd.Arg(branch)
 		}
 	}
+	args, err := cmd.Build()
+	if err != nil {
+		return err
+	}
 
-	e.logger.Info("Pushing to remote", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Pushing to remote", map[string]interface{}{
 		"remote": remote,
 		"branch": branch,
 		"force":  force,
 		"tags":   tags,
 	})
 
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	// A forced push may drop commits from the remote branch
+	if force {
+		if ref := e.pushedRef(ctx, repo, remote, branch); ref != "" {
+			e.snapshot(ctx, repo, "push", []string{ref}, skipWorktree)
+		}
+	}
+
+	remoteURL := e.remoteURL(ctx, repo, remote, true)
+	result, err := e.runRemote(ctx, lockKey(repo), repo.Path, remoteURL, args)
 	if err != nil {
 		return fmt.Errorf("failed to push: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		// Check for common error patterns
-		if strings.Contains(result.Stderr, "non-fast-forward") {
-			return fmt.Errorf("push rejected: non-fast-forward update. Use --force-with-lease if you're sure")
-		}
-		if strings.Contains(result.Stderr, "authentication") || strings.Contains(result.Stderr, "Permission denied") {
-			return fmt.Errorf("push failed: authentication required. Check your credentials")
+		gitErr := newGitError("push", result)
+		e.attachAuthHint(ctx, repo.Path, remoteURL, gitErr)
+		switch gitErr.Kind {
+		case core.ErrNonFastForward:
+			gitErr.Message = "push rejected: non-fast-forward update. Use --force-with-lease if you're sure"
+		case core.ErrAuthRequired:
+			gitErr.Message = "push failed: authentication required. Check your credentials"
 		}
-		return fmt.Errorf("push failed: %s", result.Stderr)
+		return gitErr
 	}
 
 	return nil
 }
 
+// validatePushBranch checks the branch of a push, either a branch name or a
+// src:dst refspec. Forcing with a leading "+" and deleting with an empty src
+// are rejected: forced pushes go through the force flag, so the remote branch
+// is snapshotted and the push audited as forced.
+func validatePushBranch(branch string) error {
+	src, dst, isRefspec := strings.Cut(branch, ":")
+	if strings.HasPrefix(src, "+") {
+		return invalidArgument(fmt.Sprintf("invalid push branch %q: use force instead of a leading '+'", branch))
+	}
+	if !isRefspec {
+		if branch == "HEAD" {
+			return nil
+		}
+		return executil.ValidateBranchName(branch)
+	}
+	if src == "" {
+		return invalidArgument(fmt.Sprintf("invalid push branch %q: deleting remote branches is not supported", branch))
+	}
+	if strings.HasPrefix(src, "-") {
+		return invalidArgument(fmt.Sprintf("invalid push branch %q: must not start with '-'", branch))
+	}
+	if strings.HasPrefix(dst, "refs/") {
+		return executil.ValidateRefName(dst)
+	}
+	return executil.ValidateBranchName(dst)
+}
+
 func (e *ExecGit) CreateBranch(ctx context.Context, repo *core.Repo, name, startPoint string) error {
 	if name == "" {
-		return fmt.Errorf("branch name is required")
+		return invalidArgument("branch name is required")
 	}
 
-	args := []string{"branch", name}
+	cmd := executil.NewCommand("branch").Branch(name)
 	if startPoint != "" {
-		args = append(args, startPoint)
+		cmd.Arg(startPoint)
+	}
+	args, err := cmd.Build()
+	if err != nil {
+		return err
 	}
 
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return fmt.Errorf("failed to create branch: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		if strings.Contains(result.Stderr, "already exists") {
-			return fmt.Errorf("branch %s already exists", name)
+		gitErr := newGitError("branch", result)
+		if gitErr.Kind == core.ErrAlreadyExists {
+			gitErr.Message = fmt.Sprintf("branch %s already exists", name)
+		} else {
+			gitErr.Message = fmt.Sprintf("failed to create branch %s: %s", name, gitErr.Stderr)
 		}
-		return fmt.Errorf("failed to create branch %s: %s", name, result.Stderr)
+		return gitErr
 	}
 
-	e.logger.Info("Branch created", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Branch created", map[string]interface{}{
 		"name":       name,
 		"startPoint": startPoint,
 	})
@@ -585,30 +786,39 @@ func (e *ExecGit) CreateBranch(ctx context.Context, repo *core.Repo, name, start
 
 func (e *ExecGit) DeleteBranch(ctx context.Context, repo *core.Repo, name string, force bool) error {
 	if name == "" {
-		return fmt.Errorf("branch name is required")
+		return invalidArgument("branch name is required")
 	}
 
-	args := []string{"branch"}
+	flag := "-d"
 	if force {
-		args = append(args, "-D")
-	} else {
-		args = append(args, "-d")
+		flag = "-D"
+	}
+	args, err := executil.NewCommand("branch").Flag(flag).Arg(name).Build()
+	if err != nil {
+		return err
 	}
-	args = append(args, name)
 
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	// Only forced deletions can drop unmerged commits
+	if force {
+		e.snapshot(ctx, repo, "delete-branch", []string{"refs/heads/" + name}, skipWorktree)
+	}
+
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return fmt.Errorf("failed to delete branch: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		if strings.Contains(result.Stderr, "not fully merged") {
-			return fmt.Errorf("branch %s is not fully merged. Use force=true to delete anyway", name)
+		gitErr := newGitError("branch", result)
+		if gitErr.Kind == core.ErrNotFullyMerged {
+			gitErr.Message = fmt.Sprintf("branch %s is not fully merged. Use force=true to delete anyway", name)
+		} else {
+			gitErr.Message = fmt.Sprintf("failed to delete branch %s: %s", name, gitErr.Stderr)
 		}
-		return fmt.Errorf("failed to delete branch %s: %s", name, result.Stderr)
+		return gitErr
 	}
 
-	e.logger.Info("Branch deleted", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Branch deleted", map[string]interface{}{
 		"name":  name,
 		"force": force,
 	})
@@ -618,31 +828,40 @@ func (e *ExecGit) DeleteBranch(ctx context.Context, repo *core.Repo, name string
 
 func (e *ExecGit) Checkout(ctx context.Context, repo *core.Repo, ref string, createBranch bool) error {
 	if ref == "" {
-		return fmt.Errorf("reference is required")
+		return invalidArgument("reference is required")
 	}
 
-	args := []string{"checkout"}
+	cmd := executil.NewCommand("checkout")
 	if createBranch {
-		args = append(args, "-b")
+		cmd.BranchOption("-b", ref)
+	} else {
+		cmd.Rev(ref)
 	}
-	args = append(args, ref)
+	args, err := cmd.Build()
+	if err != nil {
+		return err
+	}
+
+	// A checkout can only lose uncommitted changes and commits of a detached HEAD
+	e.snapshot(ctx, repo, "checkout", nil, saveChanges)
 
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return fmt.Errorf("failed to checkout: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		if strings.Contains(result.Stderr, "already exists") {
-			return fmt.Errorf("branch %s already exists", ref)
+		gitErr := newGitError("checkout", result)
+		switch gitErr.Kind {
+		case core.ErrAlreadyExists:
+			gitErr.Message = fmt.Sprintf("branch %s already exists", ref)
+		case core.ErrDirtyWorktree:
+			gitErr.Message = "checkout failed: local changes would be overwritten. Commit or stash changes first"
 		}
-		if strings.Contains(result.Stderr, "would be overwritten") {
-			return fmt.Errorf("checkout failed: local changes would be overwritten. Commit or stash changes first")
-		}
-		return fmt.Errorf("checkout failed: %s", result.Stderr)
+		return gitErr
 	}
 
-	e.logger.Info("Checked out", map[string]interface{}{
+	e.logger.WithContext(ctx).Info("Checked out", map[string]interface{}{
 		"ref":          ref,
 		"createBranch": createBranch,
 	})
@@ -656,13 +875,13 @@ func (e *ExecGit) ListBranches(ctx context.Context, repo *core.Repo, all bool) (
 		args = append(args, "-a")
 	}
 
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list branches: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return nil, fmt.Errorf("failed to list branches: %s", result.Stderr)
+		return nil, newGitError("branch", result)
 	}
 
 	var branches []core.BranchInfo
@@ -709,53 +928,58 @@ func (e *ExecGit) ListBranches(ctx context.Context, repo *core.Repo, all bool) (
 }
 
 func (e *ExecGit) Tag(ctx context.Context, repo *core.Repo, name, ref, message string, sign bool) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) DeleteTag(ctx context.Context, repo *core.Repo, name string) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) Merge(ctx context.Context, repo *core.Repo, ref string, noFF bool) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) Rebase(ctx context.Context, repo *core.Repo, upstream string, interactive bool) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) CherryPick(ctx context.Context, repo *core.Repo, commit string) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) Revert(ctx context.Context, repo *core.Repo, commit string) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) Log(ctx context.Context, repo *core.Repo, ref string, maxCount int, oneline bool) ([]core.CommitInfo, error) {
-	args := []string{"log"}
+	cmd := executil.NewCommand("log")
 
 	if oneline {
-		args = append(args, "--oneline")
+		cmd.Flag("--oneline")
 	} else {
-		args = append(args, "--pretty=format:%H|%h|%an|%ae|%ai|%s|%b")
+		cmd.Option("--pretty", "format:%H|%h|%an|%ae|%ai|%s|%b")
 	}
 
 	if maxCount > 0 {
-		args = append(args, "-n", strconv.Itoa(maxCount))
+		cmd.Option("-n", strconv.Itoa(maxCount))
 	}
 
 	if ref != "" {
-		args = append(args, ref)
+		cmd.Rev(ref)
+	}
+
+	args, err := cmd.Build()
+	if err != nil {
+		return nil, err
 	}
 
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get log: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return nil, fmt.Errorf("log failed: %s", result.Stderr)
+		return nil, newGitError("log", result)
 	}
 
 	var commits []core.CommitInfo
@@ -799,92 +1023,148 @@ func (e *ExecGit) Log(ctx context.Context, repo *core.Repo, ref string, maxCount
 }
 
 func (e *ExecGit) Diff(ctx context.Context, repo *core.Repo, base, head string, stat bool) (string, error) {
-	args := []string{"diff"}
-
-	if stat {
-		args = append(args, "--stat")
-	}
+	cmd := executil.NewCommand("diff").FlagIf(stat, "--stat")
 
 	if base != "" && head != "" {
-		args = append(args, base+"..."+head)
+		cmd.Rev(base + "..." + head)
 	} else if base != "" {
-		args = append(args, base)
+		cmd.Rev(base)
 	} else if head != "" {
-		args = append(args, head)
+		cmd.Rev(head)
 	}
 
-	result, err := e.executor.Run(ctx, repo.Path, args)
+	args, err := cmd.Build()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := e.runRepo(ctx, repo, args)
 	if err != nil {
 		return "", fmt.Errorf("failed to get diff: %w", err)
 	}
 
 	if result.ExitCode != 0 {
-		return "", fmt.Errorf("diff failed: %s", result.Stderr)
+		return "", newGitError("diff", result)
 	}
 
 	return result.Stdout, nil
 }
 
 func (e *ExecGit) Blame(ctx context.Context, repo *core.Repo, file, ref string) (string, error) {
-	return "", fmt.Errorf("not implemented yet")
+	return "", core.ErrNotImplemented
 }
 
 func (e *ExecGit) RevParse(ctx context.Context, repo *core.Repo, ref string) (string, error) {
-	return "", fmt.Errorf("not implemented yet")
+	if ref == "" {
+		return "", invalidArgument("reference is required")
+	}
+
+	args, err := executil.NewCommand("rev-parse").
+		Flag("--verify").
+		Flag("--quiet").
+		Rev(ref + "^{commit}").
+		NoDashDash().
+		Build()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := e.runRepo(ctx, repo, args)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve reference: %w", err)
+	}
+
+	if result.ExitCode != 0 {
+		return "", &core.GitError{
+			Op:       "rev-parse",
+			Kind:     core.ErrRefNotFound,
+			ExitCode: result.ExitCode,
+			Message:  fmt.Sprintf("reference not found: %s", ref),
+		}
+	}
+
+	return strings.TrimSpace(result.Stdout), nil
 }
 
 func (e *ExecGit) Show(ctx context.Context, repo *core.Repo, ref string) (string, error) {
-	return "", fmt.Errorf("not implemented yet")
+	return "", core.ErrNotImplemented
 }
 
 func (e *ExecGit) LsTree(ctx context.Context, repo *core.Repo, ref, path string) (string, error) {
-	return "", fmt.Errorf("not implemented yet")
+	return "", core.ErrNotImplemented
 }
 
 func (e *ExecGit) StashSave(ctx context.Context, repo *core.Repo, message string, includeUntracked bool) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) StashList(ctx context.Context, repo *core.Repo) ([]string, error) {
-	return nil, fmt.Errorf("not implemented yet")
+	return nil, core.ErrNotImplemented
 }
 
 func (e *ExecGit) StashPop(ctx context.Context, repo *core.Repo, index int) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) WorktreeCreate(ctx context.Context, repo *core.Repo, path, branch string) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) WorktreeRemove(ctx context.Context, repo *core.Repo, path string, force bool) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) WorktreeList(ctx context.Context, repo *core.Repo) ([]string, error) {
-	return nil, fmt.Errorf("not implemented yet")
+	return nil, core.ErrNotImplemented
 }
 
 func (e *ExecGit) SubmoduleInit(ctx context.Context, repo *core.Repo, path string) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) SubmoduleUpdate(ctx context.Context, repo *core.Repo, path string, recursive bool) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) SubmoduleStatus(ctx context.Context, repo *core.Repo) (string, error) {
-	return "", fmt.Errorf("not implemented yet")
+	return "", core.ErrNotImplemented
+}
+
+func (e *ExecGit) GC(ctx context.Context, repo *core.Repo, aggressive, prune bool) error {
+	args := []string{"gc", "--quiet"}
+	if aggressive {
+		args = append(args, "--aggressive")
+	}
+	if prune {
+		args = append(args, "--prune=now")
+	}
+
+	e.logger.WithContext(ctx).Info("Running garbage collection", map[string]interface{}{
+		"path":       repo.Path,
+		"aggressive": aggressive,
+		"prune":      prune,
+	})
+
+	result, err := e.runRepo(ctx, repo, args)
+	if err != nil {
+		return fmt.Errorf("failed to run gc: %w", err)
+	}
+
+	if result.ExitCode != 0 {
+		return newGitError("gc", result)
+	}
+
+	return nil
 }
 
 func (e *ExecGit) LFSInstall(ctx context.Context, repo *core.Repo) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) LFSFetch(ctx context.Context, repo *core.Repo, remote string) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
 
 func (e *ExecGit) LFSPull(ctx context.Context, repo *core.Repo, remote string) error {
-	return fmt.Errorf("not implemented yet")
+	return core.ErrNotImplemented
 }
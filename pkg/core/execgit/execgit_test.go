@@ -2,7 +2,13 @@ package execgit
 
 import (
 	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
 	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/policy"
 )
 
 func TestNew(t *testing.T) {
@@ -65,3 +71,81 @@ func TestOpen_InvalidPath(t *testing.T) {
 		t.Error("Expected error for nonexistent path")
 	}
 }
+
+// recordingAuditor collects audit records
+type recordingAuditor struct {
+	records []policy.Record
+}
+
+func (a *recordingAuditor) Audit(record policy.Record) {
+	a.records = append(a.records, record)
+}
+
+func TestRunRawPolicy(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	auditor := &recordingAuditor{}
+	git := New(WithPolicy(policy.Default()), WithAuditor(auditor))
+	ctx := core.WithCaller(context.Background(), "tester")
+
+	repo, err := git.Init(ctx, filepath.Join(t.TempDir(), "repo"), false)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	if _, err := git.RunRaw(ctx, repo, []string{"status", "--porcelain"}); err != nil {
+		t.Fatalf("Expected status to be allowed, got %v", err)
+	}
+	_, err = git.RunRaw(ctx, repo, []string{"config", "core.sshCommand", "touch /tmp/pwned"})
+	if !errors.Is(err, core.ErrPolicyDenied) {
+		t.Fatalf("Expected policy error, got %v", err)
+	}
+
+	if len(auditor.records) != 2 {
+		t.Fatalf("Expected 2 audit records, got %d", len(auditor.records))
+	}
+	allowed, denied := auditor.records[0], auditor.records[1]
+	if !allowed.Allowed || allowed.Caller != "tester" || allowed.Profile != policy.ReadOnlyProfile {
+		t.Errorf("Unexpected record for allowed command: %+v", allowed)
+	}
+	if denied.Allowed || denied.Reason == "" {
+		t.Errorf("Unexpected record for denied command: %+v", denied)
+	}
+}
+
+func TestValidatePushBranch(t *testing.T) {
+	tests := []struct {
+		branch  string
+		wantErr bool
+	}{
+		{"main", false},
+		{"feature/login", false},
+		{"HEAD", false},
+		{"HEAD:main", false},
+		{"main:refs/heads/release", false},
+		{":main", true},
+		{"+main", true},
+		{"+main:main", true},
+		{"main:", true},
+		{"-main", true},
+		{"-f:main", true},
+		{"main:bad..name", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.branch, func(t *testing.T) {
+			err := validatePushBranch(tt.branch)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// Rejected before git runs, so no snapshot or push happens
+	err := New().Push(context.Background(), &core.Repo{Path: t.TempDir()}, "origin", ":main", false, false)
+	if !errors.Is(err, core.ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument for a deleting push, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package execgit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// tipRefs are the ref namespaces whose commits RefTips lists. Other
+// namespaces, such as undo snapshots, are not part of the history.
+var tipRefs = []string{"refs/heads", "refs/remotes", "refs/tags"}
+
+// historyFormat prints a record separator followed by NUL terminated
+// fields; with -z the paths of --name-only follow, NUL terminated too
+const historyFormat = "%x1e%H%x00%h%x00%P%x00%an%x00%ae%x00%aI%x00%s%x00%b%x00"
+
+// historyFields is the number of fields of historyFormat
+const historyFields = 8
+
+// RefTips lists the distinct commits HEAD, branches, remote-tracking
+// branches and tags point to, sorted. Annotated tags are peeled and tags of
+// other objects skipped.
+func (e *ExecGit) RefTips(ctx context.Context, repo *core.Repo) ([]string, error) {
+	args := append([]string{"for-each-ref", "--format=%(objecttype) %(objectname) %(*objecttype) %(*objectname)"}, tipRefs...)
+	result, err := e.runRepo(ctx, repo, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, newGitError("for-each-ref", result)
+	}
+
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 2 && fields[0] == "commit":
+			seen[fields[1]] = true
+		case len(fields) == 4 && fields[2] == "commit":
+			seen[fields[3]] = true
+		}
+	}
+
+	head, err := e.RevParse(ctx, repo, "HEAD")
+	switch {
+	case err == nil:
+		seen[head] = true
+	case !errors.Is(err, core.ErrRefNotFound):
+		// An unborn HEAD has no commit; anything else is a failure
+		return nil, err
+	}
+
+	tips := make([]string, 0, len(seen))
+	for tip := range seen {
+		tips = append(tips, tip)
+	}
+	sort.Strings(tips)
+	return tips, nil
+}
+
+// History lists the commits reachable from opts.Revs but not from
+// opts.Exclude, children before their parents, with their parents and the
+// paths each commit changed. Merge commits list no paths.
+func (e *ExecGit) History(ctx context.Context, repo *core.Repo, opts core.HistoryOptions) ([]core.CommitInfo, error) {
+	if len(opts.Revs) == 0 {
+		return nil, nil
+	}
+
+	cmd := executil.NewCommand("log").
+		Flag("--name-only").
+		Flag("--no-renames").
+		Flag("--topo-order").
+		Flag("-z").
+		Option("--format", historyFormat)
+	if opts.MaxCount > 0 {
+		cmd.Option("--max-count", strconv.Itoa(opts.MaxCount))
+	}
+	if opts.Skip > 0 {
+		cmd.Option("--skip", strconv.Itoa(opts.Skip))
+	}
+	for _, rev := range opts.Revs {
+		cmd.Rev(rev)
+	}
+	for _, rev := range opts.Exclude {
+		cmd.Rev("^" + rev)
+	}
+
+	args, err := cmd.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := e.runRepo(ctx, repo, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, newGitError("log", result)
+	}
+	if result.Truncated {
+		return nil, fmt.Errorf("failed to get history: output exceeds the limit, list fewer commits")
+	}
+
+	return parseHistory(result.Stdout), nil
+}
+
+// parseHistory parses the output of git log with historyFormat
+func parseHistory(output string) []core.CommitInfo {
+	var commits []core.CommitInfo
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.Split(record, "\x00")
+		if len(fields) < historyFields {
+			continue
+		}
+
+		date, _ := time.Parse(time.RFC3339, fields[5])
+		commit := core.CommitInfo{
+			Hash:      fields[0],
+			ShortHash: fields[1],
+			Parents:   strings.Fields(fields[2]),
+			Author:    fields[3],
+			Email:     fields[4],
+			Date:      date,
+			Subject:   fields[6],
+			Body:      strings.TrimSpace(fields[7]),
+		}
+		for _, path := range fields[historyFields:] {
+			// The first path follows the newline ending the format
+			if path = strings.TrimPrefix(path, "\n"); path != "" {
+				commit.Paths = append(commit.Paths, path)
+			}
+		}
+		commits = append(commits, commit)
+	}
+	return commits
+}
@@ -0,0 +1,108 @@
+package execgit
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+func TestHistory(t *testing.T) {
+	git := New()
+	repo := newUndoRepo(t, git)
+	ctx := context.Background()
+
+	main, err := git.RevParse(ctx, repo, "main")
+	if err != nil {
+		t.Fatalf("RevParse failed: %v", err)
+	}
+	// Annotated tags are peeled to the commit they tag
+	if out, err := exec.Command("git", "-C", repo.Path, "-c", "user.name=Test", "-c", "user.email=test@example.com",
+		"tag", "-a", "-m", "release", "v1", "main").CombinedOutput(); err != nil {
+		t.Fatalf("git tag failed: %v: %s", err, out)
+	}
+
+	tips, err := git.RefTips(ctx, repo)
+	if err != nil {
+		t.Fatalf("RefTips failed: %v", err)
+	}
+	if len(tips) != 2 {
+		t.Fatalf("Expected the tips of main and feature, got %v", tips)
+	}
+
+	commits, err := git.History(ctx, repo, core.HistoryOptions{Revs: tips})
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(commits) != 2 || commits[0].Subject != "unmerged" || commits[1].Subject != "initial" {
+		t.Fatalf("Expected unmerged and initial, got %+v", commits)
+	}
+	initial := commits[1]
+	if initial.Hash != main || initial.Author != "Test" || initial.Email != "test@example.com" || initial.Date.IsZero() {
+		t.Errorf("Expected the commit of main by Test, got %+v", initial)
+	}
+	if !reflect.DeepEqual(initial.Paths, []string{"file.txt"}) {
+		t.Errorf("Expected paths [file.txt], got %v", initial.Paths)
+	}
+	if len(initial.Parents) != 0 || !reflect.DeepEqual(commits[0].Parents, []string{main}) {
+		t.Errorf("Expected unmerged to have the parent %s, got %v and %v", main, commits[0].Parents, initial.Parents)
+	}
+	if len(commits[0].Paths) != 0 {
+		t.Errorf("Expected no paths for an empty commit, got %v", commits[0].Paths)
+	}
+
+	tests := []struct {
+		name string
+		opts core.HistoryOptions
+		want []string
+	}{
+		{"exclude", core.HistoryOptions{Revs: tips, Exclude: []string{main}}, []string{"unmerged"}},
+		{"max count", core.HistoryOptions{Revs: tips, MaxCount: 1}, []string{"unmerged"}},
+		{"skip", core.HistoryOptions{Revs: tips, Skip: 1}, []string{"initial"}},
+		{"no revisions", core.HistoryOptions{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commits, err := git.History(ctx, repo, tt.opts)
+			if err != nil {
+				t.Fatalf("History failed: %v", err)
+			}
+			var subjects []string
+			for _, commit := range commits {
+				subjects = append(subjects, commit.Subject)
+			}
+			if !reflect.DeepEqual(subjects, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, subjects)
+			}
+		})
+	}
+
+	if _, err := git.History(ctx, repo, core.HistoryOptions{Revs: []string{"--all"}}); err == nil {
+		t.Error("Expected an option-like revision to be rejected")
+	}
+}
+
+func TestRefTipsUnbornHead(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+
+	git := New()
+	repo, err := git.Open(context.Background(), root)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	tips, err := git.RefTips(context.Background(), repo)
+	if err != nil {
+		t.Fatalf("RefTips failed: %v", err)
+	}
+	if len(tips) != 0 {
+		t.Errorf("Expected no tips in an empty repository, got %v", tips)
+	}
+}
@@ -0,0 +1,255 @@
+package execgit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/policy"
+)
+
+// LockManager serializes git commands per repository: read-only commands
+// share a repository, commands that modify it run alone. Waiting writers
+// block new readers so they are not starved.
+type LockManager struct {
+	mu      sync.Mutex
+	locks   map[string]*repoLock
+	changed chan struct{}
+}
+
+// repoLock is the state of one repository, guarded by LockManager.mu
+type repoLock struct {
+	readers        int
+	writer         bool
+	waitingWriters int
+}
+
+// NewLockManager creates an empty lock manager. Share one between ExecGit
+// instances working on the same repositories.
+func NewLockManager() *LockManager {
+	return &LockManager{
+		locks:   make(map[string]*repoLock),
+		changed: make(chan struct{}),
+	}
+}
+
+// Lock acquires the repository at path exclusively
+func (m *LockManager) Lock(ctx context.Context, path string) (func(), error) {
+	return m.acquire(ctx, path, true)
+}
+
+// RLock acquires the repository at path shared with other readers
+func (m *LockManager) RLock(ctx context.Context, path string) (func(), error) {
+	return m.acquire(ctx, path, false)
+}
+
+// acquire waits until the lock can be taken or ctx is done and returns
+// the function releasing it
+func (m *LockManager) acquire(ctx context.Context, path string, exclusive bool) (func(), error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		key = filepath.Clean(path)
+	}
+
+	m.mu.Lock()
+	l := m.get(key)
+	if exclusive {
+		l.waitingWriters++
+	}
+
+	for {
+		// Unused locks are forgotten while waiting, so look it up again
+		l = m.get(key)
+		if exclusive && !l.writer && l.readers == 0 {
+			l.waitingWriters--
+			l.writer = true
+			break
+		}
+		if !exclusive && !l.writer && l.waitingWriters == 0 {
+			l.readers++
+			break
+		}
+
+		changed := m.changed
+		m.mu.Unlock()
+		select {
+		case <-changed:
+			m.mu.Lock()
+		case <-ctx.Done():
+			m.mu.Lock()
+			if exclusive {
+				l.waitingWriters--
+			}
+			m.release(key, l)
+			m.mu.Unlock()
+			return nil, fmt.Errorf("waiting for repository lock: %w", ctx.Err())
+		}
+	}
+	m.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if exclusive {
+				l.writer = false
+			} else {
+				l.readers--
+			}
+			m.release(key, l)
+		})
+	}, nil
+}
+
+// get returns the lock for key, creating it if needed. m.mu must be held.
+func (m *LockManager) get(key string) *repoLock {
+	l, ok := m.locks[key]
+	if !ok {
+		l = &repoLock{}
+		m.locks[key] = l
+	}
+	return l
+}
+
+// release wakes up waiters and forgets unused locks. m.mu must be held.
+func (m *LockManager) release(key string, l *repoLock) {
+	if !l.writer && l.readers == 0 && l.waitingWriters == 0 && m.locks[key] == l {
+		delete(m.locks, key)
+	}
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// LockConfig controls how commands failing on git's own lock files are retried
+type LockConfig struct {
+	// Retries is how often a command is retried after failing on a lock file
+	Retries int
+	// Backoff is the delay before the first retry; it doubles on each retry
+	Backoff time.Duration
+	// StaleAfter is the age after which a lock file is considered left behind
+	// by a crashed git process and removed. Zero disables the cleanup.
+	StaleAfter time.Duration
+}
+
+// DefaultLockConfig returns the lock retry settings used by New
+func DefaultLockConfig() LockConfig {
+	return LockConfig{
+		Retries:    3,
+		Backoff:    100 * time.Millisecond,
+		StaleAfter: 10 * time.Minute,
+	}
+}
+
+// lockFilePattern extracts the lock file from git's "Unable to create" message
+var lockFilePattern = regexp.MustCompile(`Unable to create '([^']+\.lock)': File exists`)
+
+// run runs git in dir holding the lock of dir, for commands run before the
+// repository is opened
+func (e *ExecGit) run(ctx context.Context, dir string, args []string) (*executil.ExecResult, error) {
+	return e.runLocked(ctx, dir, dir, args, nil)
+}
+
+// runRepo runs git in repo.Path holding the lock of repo
+func (e *ExecGit) runRepo(ctx context.Context, repo *core.Repo, args []string) (*executil.ExecResult, error) {
+	return e.runLocked(ctx, lockKey(repo), repo.Path, args, nil)
+}
+
+// lockKey returns the path repo is locked by: its git directory with
+// symlinks resolved, so the repository opened from a subdirectory or
+// through a symlink has the same lock
+func lockKey(repo *core.Repo) string {
+	path := repo.GitDir
+	if path == "" {
+		path = repo.Path
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// runLocked runs git in dir authenticating with cred, holding the lock of
+// key, the path of a repository: shared for read-only commands, exclusive
+// otherwise. Commands failing because a git lock file exists are retried,
+// and lock files older than LockConfig.StaleAfter are removed first.
+func (e *ExecGit) runLocked(ctx context.Context, key, dir string, args []string, cred *core.Credential) (*executil.ExecResult, error) {
+	acquire := e.locks.Lock
+	if policy.IsReadOnly(args) {
+		acquire = e.locks.RLock
+	}
+	release, err := acquire(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	backoff := e.lockConfig.Backoff
+	for attempt := 0; ; attempt++ {
+		result, err := e.executor.RunWithCredential(ctx, dir, args, cred)
+		if err != nil || result.ExitCode == 0 || classifyStderr(result.Stderr) != core.ErrLocked {
+			return result, err
+		}
+		if attempt >= e.lockConfig.Retries {
+			return result, nil
+		}
+
+		e.removeStaleLock(ctx, dir, result.Stderr)
+		e.logger.WithContext(ctx).Warn("Repository is locked, retrying", map[string]interface{}{
+			"path":    dir,
+			"command": args[0],
+			"attempt": attempt + 1,
+		})
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return result, nil
+		}
+		backoff *= 2
+	}
+}
+
+// removeStaleLock removes the lock file named in stderr of a command run in
+// dir if it is older than LockConfig.StaleAfter
+func (e *ExecGit) removeStaleLock(ctx context.Context, dir, stderr string) {
+	if e.lockConfig.StaleAfter <= 0 {
+		return
+	}
+	match := lockFilePattern.FindStringSubmatch(stderr)
+	if match == nil {
+		return
+	}
+
+	path := match[1]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || !strings.HasSuffix(path, ".lock") {
+		return
+	}
+	age := time.Since(info.ModTime())
+	if age < e.lockConfig.StaleAfter {
+		return
+	}
+
+	if err := os.Remove(path); err != nil {
+		e.logger.WithContext(ctx).Warn("Failed to remove stale lock file", map[string]interface{}{
+			"lock":  path,
+			"error": err.Error(),
+		})
+		return
+	}
+	e.logger.WithContext(ctx).Warn("Removed stale lock file", map[string]interface{}{
+		"lock": path,
+		"age":  age.Round(time.Second).String(),
+	})
+}
@@ -0,0 +1,146 @@
+package execgit
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockManager(t *testing.T) {
+	m := NewLockManager()
+	ctx := context.Background()
+
+	// Readers share the lock
+	r1, err := m.RLock(ctx, "/repo")
+	if err != nil {
+		t.Fatalf("RLock failed: %v", err)
+	}
+	r2, err := m.RLock(ctx, "/repo")
+	if err != nil {
+		t.Fatalf("Second RLock failed: %v", err)
+	}
+
+	// Other repositories are independent
+	other, err := m.Lock(ctx, "/other")
+	if err != nil {
+		t.Fatalf("Lock of another repository failed: %v", err)
+	}
+	other()
+
+	// A writer waits for the readers
+	acquired := make(chan func())
+	go func() {
+		release, err := m.Lock(ctx, "/repo")
+		if err != nil {
+			t.Errorf("Lock failed: %v", err)
+		}
+		acquired <- release
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Writer acquired the lock while readers held it")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// New readers wait behind the waiting writer
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := m.RLock(short, "/repo"); err == nil {
+		t.Fatal("Reader acquired the lock while a writer was waiting")
+	}
+
+	r1()
+	r2()
+	release := <-acquired
+	release()
+
+	if len(m.locks) != 0 {
+		t.Errorf("Expected unused locks to be forgotten, got %d", len(m.locks))
+	}
+}
+
+func TestRunLockedRetriesStaleLock(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	git := New(WithLockConfig(LockConfig{Retries: 2, Backoff: time.Millisecond, StaleAfter: time.Minute}))
+	ctx := context.Background()
+
+	repo, err := git.Init(ctx, filepath.Join(t.TempDir(), "repo"), false)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo.Path, "file"), []byte("x"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	lock := filepath.Join(repo.Path, ".git", "index.lock")
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	// A recent lock file belongs to a running git process and is kept
+	result, err := git.RunRaw(ctx, repo, []string{"add", "file"})
+	if err != nil {
+		t.Fatalf("RunRaw failed: %v", err)
+	}
+	if result.ExitCode == 0 {
+		t.Fatal("Expected add to fail while index.lock exists")
+	}
+	if _, err := os.Stat(lock); err != nil {
+		t.Fatalf("Expected recent lock file to be kept: %v", err)
+	}
+
+	// A stale lock file is removed and the command retried
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	result, err = git.RunRaw(ctx, repo, []string{"add", "file"})
+	if err != nil || result.ExitCode != 0 {
+		t.Fatalf("Expected add to succeed after removing the stale lock, got %v %+v", err, result)
+	}
+}
+
+func TestLockKey(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	git := New()
+	ctx := context.Background()
+	dir := t.TempDir()
+	root, err := git.Init(ctx, filepath.Join(dir, "repo"), false)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(root.Path, "sub"), 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+	if err := os.Symlink(root.Path, filepath.Join(dir, "link")); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	// Every way of opening the repository locks the same key
+	release, err := git.locks.Lock(ctx, lockKey(root))
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+	defer release()
+	for _, path := range []string{filepath.Join(root.Path, "sub"), filepath.Join(dir, "link")} {
+		repo, err := git.Open(ctx, path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		if _, err := git.runRepo(short, repo, []string{"commit", "--allow-empty", "-m", "x"}); err == nil {
+			t.Errorf("Expected %s to wait for the lock of %s", path, root.Path)
+		}
+		cancel()
+	}
+}
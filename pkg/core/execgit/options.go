@@ -0,0 +1,87 @@
+package execgit
+
+import (
+	"context"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/internal/logging"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/policy"
+)
+
+// Option configures an ExecGit
+type Option func(*ExecGit)
+
+// WithExecutorConfig sets the git binary, environment and config overrides
+// used for every git invocation
+func WithExecutorConfig(config executil.ExecutorConfig) Option {
+	return func(e *ExecGit) {
+		e.executor = executil.NewGitExecutorWithConfig(config)
+	}
+}
+
+// WithLogger sets the logger of the ExecGit. Entries carry the request ID of
+// the operation's context, see logging.WithRequestID.
+func WithLogger(logger *logging.Logger) Option {
+	return func(e *ExecGit) {
+		e.logger = logger
+	}
+}
+
+// WithCredentialProvider sets where remote operations get credentials from
+func WithCredentialProvider(provider core.CredentialProvider) Option {
+	return func(e *ExecGit) {
+		e.credentials = provider
+	}
+}
+
+// WithPolicy restricts RunRaw to the commands allowed by the caller's profile.
+// Without a policy, RunRaw runs any command.
+func WithPolicy(p *policy.Policy) Option {
+	return func(e *ExecGit) {
+		e.policy = p
+	}
+}
+
+// WithAuditor sets where RunRaw invocations are recorded.
+// By default they are written to the log.
+func WithAuditor(auditor policy.Auditor) Option {
+	return func(e *ExecGit) {
+		e.auditor = auditor
+	}
+}
+
+// WithLockManager shares repository locks with other ExecGit instances
+func WithLockManager(locks *LockManager) Option {
+	return func(e *ExecGit) {
+		e.locks = locks
+	}
+}
+
+// WithLockConfig sets how commands failing on git lock files are retried
+func WithLockConfig(config LockConfig) Option {
+	return func(e *ExecGit) {
+		e.lockConfig = config
+	}
+}
+
+// WithTracer reports every git command run by the ExecGit to t
+func WithTracer(t executil.Tracer) Option {
+	return func(e *ExecGit) {
+		e.tracers = append(e.tracers, t)
+	}
+}
+
+// WithSnapshotLimit sets how many undo snapshots are kept per repository,
+// see UndoRefPrefix. A limit of 0 disables snapshots.
+func WithSnapshotLimit(n int) Option {
+	return func(e *ExecGit) {
+		e.snapshotLimit = n
+	}
+}
+
+// WithConfigOverrides returns a context that passes the given key=value
+// settings to git with -c for all operations run with it
+func WithConfigOverrides(ctx context.Context, overrides ...string) context.Context {
+	return executil.WithConfigOverrides(ctx, overrides...)
+}
@@ -0,0 +1,413 @@
+package execgit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/executil"
+	"github.com/felipemacedo1/go-coregit-pe/internal/gitstate"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// UndoRefPrefix is the ref namespace holding undo snapshots. Each snapshot
+// is a commit whose message describes it and whose parents keep the saved
+// commits reachable, so gc does not remove them.
+const UndoRefPrefix = "refs/gitmgr/undo/"
+
+// DefaultSnapshotLimit is the number of snapshots kept per repository
+const DefaultSnapshotLimit = 50
+
+// snapshotIDFormat names snapshots so they sort by time
+const snapshotIDFormat = "20060102T150405.000000000Z"
+
+// snapshotIdentity authors snapshot commits, which never leave the repository
+var snapshotIdentity = []string{"user.name=gitmgr", "user.email=gitmgr@localhost"}
+
+// objectIDPattern matches SHA-1 and SHA-256 object names
+var objectIDPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// worktreeSnapshot selects what a snapshot saves besides refs
+type worktreeSnapshot int
+
+const (
+	skipWorktree worktreeSnapshot = iota // Refs only
+	saveWorktree                         // HEAD and uncommitted changes
+	saveChanges                          // Like saveWorktree, if there are changes or HEAD is detached
+)
+
+// snapshot saves refs before operation runs, and as worktree selects also
+// HEAD and uncommitted changes. Snapshots are a safety net: failing to take one
+// is logged and does not prevent the operation.
+func (e *ExecGit) snapshot(ctx context.Context, repo *core.Repo, operation string, refs []string, worktree worktreeSnapshot) {
+	if e.snapshotLimit <= 0 {
+		return
+	}
+	snap, err := e.saveSnapshot(ctx, repo, operation, refs, worktree)
+	if err != nil {
+		e.logger.WithContext(ctx).Warn("Failed to save undo snapshot", map[string]interface{}{
+			"path":      repo.Path,
+			"operation": operation,
+			"error":     err.Error(),
+		})
+		return
+	}
+	if snap != nil {
+		e.logger.WithContext(ctx).Debug("Saved undo snapshot", map[string]interface{}{
+			"path":      repo.Path,
+			"operation": operation,
+			"id":        snap.ID,
+		})
+	}
+}
+
+// saveSnapshot stores a snapshot under UndoRefPrefix and prunes the oldest
+// ones beyond the limit. It returns nil if there is nothing to save.
+func (e *ExecGit) saveSnapshot(ctx context.Context, repo *core.Repo, operation string, refs []string, worktree worktreeSnapshot) (*core.Snapshot, error) {
+	ctx = WithConfigOverrides(ctx, snapshotIdentity...)
+	current := gitstate.ReadRefs(repo.GitDir)
+
+	snap := &core.Snapshot{
+		ID:        time.Now().UTC().Format(snapshotIDFormat),
+		Time:      time.Now().UTC(),
+		Operation: operation,
+		Refs:      make(map[string]string),
+	}
+	var commits []string
+	for _, ref := range refs {
+		if value := current[ref]; objectIDPattern.MatchString(value) {
+			snap.Refs[ref] = value
+			commits = append(commits, value)
+		}
+	}
+
+	if worktree != skipWorktree {
+		head := current["HEAD"]
+		detached := objectIDPattern.MatchString(head)
+		if target, ok := strings.CutPrefix(head, "ref: "); ok {
+			snap.Head = target
+			if value := current[target]; objectIDPattern.MatchString(value) {
+				commits = append(commits, value)
+			}
+		} else if objectIDPattern.MatchString(head) {
+			snap.Head = head
+			commits = append(commits, head)
+		}
+
+		if !repo.IsBare {
+			stash, err := e.stashCreate(ctx, repo)
+			if err != nil {
+				return nil, err
+			}
+			if stash != "" {
+				snap.Stash = stash
+				commits = append(commits, stash)
+			}
+		}
+
+		// A branch keeps its commits; only changes and a detached HEAD can be lost
+		if worktree == saveChanges && len(snap.Refs) == 0 && snap.Stash == "" && !detached {
+			return nil, nil
+		}
+	}
+
+	// Without commits there is nothing to lose, nor a tree for the snapshot commit
+	if len(commits) == 0 {
+		return nil, nil
+	}
+
+	message, err := json.Marshal(snap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	args := []string{"commit-tree", commits[0] + "^{tree}"}
+	seen := make(map[string]bool)
+	for _, commit := range commits {
+		if !seen[commit] {
+			seen[commit] = true
+			args = append(args, "-p", commit)
+		}
+	}
+	args = append(args, "-m", string(message))
+
+	result, err := e.runRepo(ctx, repo, args)
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, newGitError("commit-tree", result)
+	}
+
+	result, err = e.runRepo(ctx, repo, []string{"update-ref", UndoRefPrefix + snap.ID, strings.TrimSpace(result.Stdout)})
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, newGitError("update-ref", result)
+	}
+
+	return snap, e.pruneSnapshots(ctx, repo)
+}
+
+// stashCreate records uncommitted changes in a stash commit without
+// touching the worktree or the stash list. It returns "" if there are none.
+func (e *ExecGit) stashCreate(ctx context.Context, repo *core.Repo) (string, error) {
+	result, err := e.runRepo(ctx, repo, []string{"stash", "create"})
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		return "", newGitError("stash", result)
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// pruneSnapshots removes the oldest snapshots beyond the limit
+func (e *ExecGit) pruneSnapshots(ctx context.Context, repo *core.Repo) error {
+	snapshots, err := e.ListSnapshots(ctx, repo)
+	if err != nil || len(snapshots) <= e.snapshotLimit {
+		return err
+	}
+
+	for _, snap := range snapshots[e.snapshotLimit:] {
+		result, err := e.runRepo(ctx, repo, []string{"update-ref", "-d", UndoRefPrefix + snap.ID})
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != 0 {
+			return newGitError("update-ref", result)
+		}
+	}
+	return nil
+}
+
+// ListSnapshots returns the undo snapshots of repo, newest first
+func (e *ExecGit) ListSnapshots(ctx context.Context, repo *core.Repo) ([]core.Snapshot, error) {
+	result, err := e.runRepo(ctx, repo, []string{
+		"for-each-ref", "--sort=-refname", "--format=%(refname)%09%(contents:subject)", UndoRefPrefix,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, newGitError("for-each-ref", result)
+	}
+
+	snapshots := []core.Snapshot{}
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		ref, message, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		var snap core.Snapshot
+		if err := json.Unmarshal([]byte(message), &snap); err != nil {
+			continue
+		}
+		snap.ID = strings.TrimPrefix(ref, UndoRefPrefix)
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, nil
+}
+
+// RestoreSnapshot resets the refs saved in the snapshot with the given ID,
+// checks out the saved HEAD and reapplies saved uncommitted changes. Saved
+// remote-tracking branches are pushed back to their remote first. The
+// current state is snapshotted first, so a restore can be undone too.
+// Saved changes are only applied to a clean worktree; otherwise the restore
+// fails with core.ErrDirtyWorktree after resetting refs and HEAD.
+func (e *ExecGit) RestoreSnapshot(ctx context.Context, repo *core.Repo, id string) error {
+	if id == "" {
+		return invalidArgument("snapshot ID is required")
+	}
+
+	snapshots, err := e.ListSnapshots(ctx, repo)
+	if err != nil {
+		return err
+	}
+	var snap *core.Snapshot
+	for i := range snapshots {
+		if snapshots[i].ID == id {
+			snap = &snapshots[i]
+			break
+		}
+	}
+	if snap == nil {
+		return &core.GitError{
+			Op:      "undo",
+			Kind:    core.ErrRefNotFound,
+			Message: fmt.Sprintf("snapshot %s not found", id),
+		}
+	}
+
+	refs := make([]string, 0, len(snap.Refs))
+	for ref := range snap.Refs {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	worktree := skipWorktree
+	if snap.Head != "" {
+		worktree = saveWorktree
+	}
+	e.snapshot(ctx, repo, "undo", refs, worktree)
+
+	current := gitstate.ReadRefs(repo.GitDir)
+	for _, ref := range refs {
+		if err := e.restoreRemoteBranch(ctx, repo, ref, snap.Refs[ref], current[ref]); err != nil {
+			return err
+		}
+		result, err := e.runRepo(ctx, repo, []string{"update-ref", ref, snap.Refs[ref]})
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", ref, err)
+		}
+		if result.ExitCode != 0 {
+			return newGitError("update-ref", result)
+		}
+	}
+
+	if snap.Head != "" && !repo.IsBare {
+		if err := e.restoreHead(ctx, repo, snap.Head); err != nil {
+			return err
+		}
+	}
+	if snap.Stash != "" && !repo.IsBare {
+		if err := e.restoreStash(ctx, repo, snap.Stash); err != nil {
+			return err
+		}
+	}
+
+	e.logger.WithContext(ctx).Info("Snapshot restored", map[string]interface{}{
+		"path":      repo.Path,
+		"id":        id,
+		"operation": snap.Operation,
+	})
+	return nil
+}
+
+// restoreRemoteBranch pushes commit to the remote branch that ref, a
+// remote-tracking ref saved by a forced push, tracks. The push is leased on
+// current, the tracking ref's value, so it fails if the remote branch moved
+// since. Other refs are left to update-ref.
+func (e *ExecGit) restoreRemoteBranch(ctx context.Context, repo *core.Repo, ref, commit, current string) error {
+	remote, branch, ok := strings.Cut(strings.TrimPrefix(ref, "refs/remotes/"), "/")
+	if !ok || !strings.HasPrefix(ref, "refs/remotes/") || commit == current {
+		return nil
+	}
+	if !objectIDPattern.MatchString(current) {
+		current = ""
+	}
+
+	args, err := executil.NewCommand("push").
+		Option("--force-with-lease", "refs/heads/"+branch+":"+current).
+		URL(remote).
+		Arg(commit + ":refs/heads/" + branch).
+		Build()
+	if err != nil {
+		return err
+	}
+
+	remoteURL := e.remoteURL(ctx, repo, remote, true)
+	result, err := e.runRemote(ctx, lockKey(repo), repo.Path, remoteURL, args)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", ref, err)
+	}
+	if result.ExitCode != 0 {
+		gitErr := newGitError("push", result)
+		e.attachAuthHint(ctx, repo.Path, remoteURL, gitErr)
+		if gitErr.Kind == core.ErrNonFastForward {
+			gitErr.Message = fmt.Sprintf("undo failed: %s/%s changed since the snapshot. Fetch and push it with force instead", remote, branch)
+		}
+		return gitErr
+	}
+	return nil
+}
+
+// restoreHead checks out head, a branch ref or a commit, unless it is
+// already checked out
+func (e *ExecGit) restoreHead(ctx context.Context, repo *core.Repo, head string) error {
+	current := gitstate.ReadRefs(repo.GitDir)["HEAD"]
+	if current == head || current == "ref: "+head {
+		return nil
+	}
+
+	args := []string{"checkout", "--detach", head}
+	if branch, ok := strings.CutPrefix(head, "refs/heads/"); ok {
+		args = []string{"checkout", branch}
+	}
+	result, err := e.runRepo(ctx, repo, append(args, "--"))
+	if err != nil {
+		return fmt.Errorf("failed to checkout: %w", err)
+	}
+	if result.ExitCode != 0 {
+		gitErr := newGitError("checkout", result)
+		if gitErr.Kind == core.ErrDirtyWorktree {
+			gitErr.Message = "undo failed: local changes would be overwritten. Commit or stash changes first"
+		}
+		return gitErr
+	}
+	return nil
+}
+
+// restoreStash applies the changes saved in stash. Nothing is done if the
+// worktree already holds them, e.g. because checkout carried them along.
+func (e *ExecGit) restoreStash(ctx context.Context, repo *core.Repo, stash string) error {
+	current, err := e.stashCreate(ctx, repo)
+	if err != nil {
+		return err
+	}
+	if current != "" {
+		same, err := e.sameTree(ctx, repo, current, stash)
+		if err != nil || same {
+			return err
+		}
+		return &core.GitError{
+			Op:      "undo",
+			Kind:    core.ErrDirtyWorktree,
+			Message: fmt.Sprintf("refs restored, but local changes prevent applying the saved ones. Apply them with git stash apply %s", stash),
+		}
+	}
+
+	result, err := e.runRepo(ctx, repo, []string{"stash", "apply", stash})
+	if err != nil {
+		return fmt.Errorf("failed to apply saved changes: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return newGitError("stash", result)
+	}
+	return nil
+}
+
+// sameTree reports whether two commits have the same tree
+func (e *ExecGit) sameTree(ctx context.Context, repo *core.Repo, a, b string) (bool, error) {
+	result, err := e.runRepo(ctx, repo, []string{"rev-parse", a + "^{tree}", b + "^{tree}"})
+	if err != nil {
+		return false, err
+	}
+	if result.ExitCode != 0 {
+		return false, newGitError("rev-parse", result)
+	}
+	trees := strings.Fields(result.Stdout)
+	return len(trees) == 2 && trees[0] == trees[1], nil
+}
+
+// pushedRef returns the remote-tracking ref a push of branch to remote
+// updates, or "" if remote is not a configured remote name
+func (e *ExecGit) pushedRef(ctx context.Context, repo *core.Repo, remote, branch string) string {
+	if remote == "" || strings.Contains(remote, ":") || strings.Contains(remote, "/") {
+		return ""
+	}
+	if branch == "" {
+		current, err := e.currentBranch(ctx, repo)
+		if err != nil || current == "" {
+			return ""
+		}
+		branch = current
+	}
+	if _, dst, ok := strings.Cut(branch, ":"); ok {
+		branch = dst
+	}
+	return "refs/remotes/" + remote + "/" + strings.TrimPrefix(branch, "refs/heads/")
+}
@@ -0,0 +1,271 @@
+package execgit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// newUndoRepo creates a repository with a commit on main and an unmerged
+// commit on feature, with main checked out
+func newUndoRepo(t *testing.T, git *ExecGit) *core.Repo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	gitCmd := func(args ...string) string {
+		t.Helper()
+		args = append([]string{"-C", root, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+		out, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	gitCmd("init", "-q")
+	gitCmd("symbolic-ref", "HEAD", "refs/heads/main")
+	if err := os.WriteFile(filepath.Join(root, "file.txt"), []byte("main\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	gitCmd("add", "file.txt")
+	gitCmd("commit", "-q", "-m", "initial")
+	gitCmd("checkout", "-q", "-b", "feature")
+	gitCmd("commit", "-q", "--allow-empty", "-m", "unmerged")
+	gitCmd("checkout", "-q", "main")
+
+	repo, err := git.Open(context.Background(), root)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return repo
+}
+
+func TestUndoDeleteBranch(t *testing.T) {
+	git := New()
+	repo := newUndoRepo(t, git)
+	ctx := context.Background()
+
+	feature, err := git.RevParse(ctx, repo, "feature")
+	if err != nil {
+		t.Fatalf("RevParse failed: %v", err)
+	}
+	if err := git.DeleteBranch(ctx, repo, "feature", true); err != nil {
+		t.Fatalf("DeleteBranch failed: %v", err)
+	}
+
+	snapshots, err := git.ListSnapshots(ctx, repo)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Operation != "delete-branch" || snapshots[0].Refs["refs/heads/feature"] != feature {
+		t.Fatalf("Expected a delete-branch snapshot of feature, got %+v", snapshots)
+	}
+
+	if err := git.RestoreSnapshot(ctx, repo, snapshots[0].ID); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+	restored, err := git.RevParse(ctx, repo, "feature")
+	if err != nil || restored != feature {
+		t.Errorf("Expected feature at %s, got %s (%v)", feature, restored, err)
+	}
+
+	err = git.RestoreSnapshot(ctx, repo, "missing")
+	if !errors.Is(err, core.ErrRefNotFound) {
+		t.Errorf("Expected ErrRefNotFound for an unknown snapshot, got %v", err)
+	}
+}
+
+func TestUndoCheckout(t *testing.T) {
+	git := New()
+	repo := newUndoRepo(t, git)
+	ctx := context.Background()
+	file := filepath.Join(repo.Path, "file.txt")
+
+	if err := os.WriteFile(file, []byte("uncommitted\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := git.Checkout(ctx, repo, "feature", false); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	snapshots, err := git.ListSnapshots(ctx, repo)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Head != "refs/heads/main" || snapshots[0].Stash == "" {
+		t.Fatalf("Expected a snapshot of main with uncommitted changes, got %+v", snapshots)
+	}
+
+	// Lose the changes, then get them back along with the branch
+	if out, err := exec.Command("git", "-C", repo.Path, "checkout", "--", "file.txt").CombinedOutput(); err != nil {
+		t.Fatalf("git checkout failed: %v: %s", err, out)
+	}
+	if err := git.RestoreSnapshot(ctx, repo, snapshots[0].ID); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+
+	branch, err := git.currentBranch(ctx, repo)
+	if err != nil || branch != "main" {
+		t.Errorf("Expected main to be checked out, got %q (%v)", branch, err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil || string(data) != "uncommitted\n" {
+		t.Errorf("Expected uncommitted changes to be restored, got %q (%v)", data, err)
+	}
+
+	// The restore itself can be undone
+	snapshots, err = git.ListSnapshots(ctx, repo)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Operation != "undo" || snapshots[0].Head != "refs/heads/feature" {
+		t.Errorf("Expected an undo snapshot of feature first, got %+v", snapshots)
+	}
+}
+
+func TestUndoCheckoutWithoutChanges(t *testing.T) {
+	git := New()
+	repo := newUndoRepo(t, git)
+	ctx := context.Background()
+
+	// Branches keep their commits, so a clean checkout needs no snapshot
+	if err := git.Checkout(ctx, repo, "feature", false); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if snapshots, err := git.ListSnapshots(ctx, repo); err != nil || len(snapshots) != 0 {
+		t.Fatalf("Expected no snapshot of a clean checkout, got %+v, %v", snapshots, err)
+	}
+
+	// Leaving a detached HEAD can lose its commits
+	head, err := git.RevParse(ctx, repo, "HEAD")
+	if err != nil {
+		t.Fatalf("RevParse failed: %v", err)
+	}
+	if err := git.Checkout(ctx, repo, head, false); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if err := git.Checkout(ctx, repo, "main", false); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	snapshots, err := git.ListSnapshots(ctx, repo)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Head != head {
+		t.Errorf("Expected a snapshot of the detached HEAD %s, got %+v", head, snapshots)
+	}
+}
+
+func TestUndoForcedPush(t *testing.T) {
+	git := New()
+	repo := newUndoRepo(t, git)
+	ctx := context.Background()
+
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	remoteMain := func() string {
+		t.Helper()
+		out, err := exec.Command("git", "-C", remote, "rev-parse", "refs/heads/main").CombinedOutput()
+		if err != nil {
+			t.Fatalf("git rev-parse failed: %v: %s", err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if err := git.AddRemote(ctx, repo, "origin", remote); err != nil {
+		t.Fatalf("AddRemote failed: %v", err)
+	}
+	feature, err := git.RevParse(ctx, repo, "feature")
+	if err != nil {
+		t.Fatalf("RevParse failed: %v", err)
+	}
+	if err := git.Push(ctx, repo, "origin", "feature:main", false, false); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	// Forcing main drops the feature commit from the remote
+	if err := git.Push(ctx, repo, "origin", "main", true, false); err != nil {
+		t.Fatalf("Forced push failed: %v", err)
+	}
+	snapshots, err := git.ListSnapshots(ctx, repo)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Operation != "push" || snapshots[0].Refs["refs/remotes/origin/main"] != feature {
+		t.Fatalf("Expected a push snapshot of origin/main, got %+v", snapshots)
+	}
+
+	// Restoring pushes the saved commit back to the remote
+	if err := git.RestoreSnapshot(ctx, repo, snapshots[0].ID); err != nil {
+		t.Fatalf("RestoreSnapshot failed: %v", err)
+	}
+	if got := remoteMain(); got != feature {
+		t.Errorf("Expected remote main at %s, got %s", feature, got)
+	}
+	if tracking, err := git.RevParse(ctx, repo, "origin/main"); err != nil || tracking != feature {
+		t.Errorf("Expected origin/main at %s, got %s (%v)", feature, tracking, err)
+	}
+
+	// The restore is leased, so it fails if the remote moved since
+	if err := git.Push(ctx, repo, "origin", "main", true, false); err != nil {
+		t.Fatalf("Forced push failed: %v", err)
+	}
+	snapshots, err = git.ListSnapshots(ctx, repo)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	out, err := exec.Command("git", "-C", remote, "-c", "user.name=Test", "-c", "user.email=test@example.com",
+		"commit-tree", "refs/heads/main^{tree}", "-m", "other").CombinedOutput()
+	if err != nil {
+		t.Fatalf("git commit-tree failed: %v: %s", err, out)
+	}
+	other := strings.TrimSpace(string(out))
+	if out, err := exec.Command("git", "-C", remote, "update-ref", "refs/heads/main", other).CombinedOutput(); err != nil {
+		t.Fatalf("git update-ref failed: %v: %s", err, out)
+	}
+	if err := git.RestoreSnapshot(ctx, repo, snapshots[0].ID); !errors.Is(err, core.ErrNonFastForward) {
+		t.Errorf("Expected ErrNonFastForward after the remote moved, got %v", err)
+	}
+	if got := remoteMain(); got != other {
+		t.Errorf("Expected remote main to stay at %s, got %s", other, got)
+	}
+}
+
+func TestSnapshotLimit(t *testing.T) {
+	git := New(WithSnapshotLimit(2))
+	repo := newUndoRepo(t, git)
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := git.CreateBranch(ctx, repo, name, "feature"); err != nil {
+			t.Fatalf("CreateBranch failed: %v", err)
+		}
+		if err := git.DeleteBranch(ctx, repo, name, true); err != nil {
+			t.Fatalf("DeleteBranch failed: %v", err)
+		}
+	}
+
+	snapshots, err := git.ListSnapshots(ctx, repo)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Refs["refs/heads/c"] == "" || snapshots[1].Refs["refs/heads/b"] == "" {
+		t.Errorf("Expected snapshots of c and b, got %+v", snapshots)
+	}
+
+	disabled := New(WithSnapshotLimit(0))
+	if err := disabled.DeleteBranch(ctx, repo, "feature", true); err != nil {
+		t.Fatalf("DeleteBranch failed: %v", err)
+	}
+	if snapshots, _ := disabled.ListSnapshots(ctx, repo); len(snapshots) != 2 {
+		t.Errorf("Expected no snapshot with a limit of 0, got %d snapshots", len(snapshots))
+	}
+}
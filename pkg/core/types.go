@@ -2,16 +2,17 @@ package core
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
 // Repo represents a Git repository
 type Repo struct {
-	Path       string
-	WorkDir    string
-	GitDir     string
-	IsBare     bool
-	IsWorktree bool
+	Path       string `json:"path"`
+	WorkDir    string `json:"workDir"`
+	GitDir     string `json:"gitDir"`
+	IsBare     bool   `json:"isBare"`
+	IsWorktree bool   `json:"isWorktree"`
 }
 
 // CloneOptions configures repository cloning
@@ -29,64 +30,139 @@ type CloneOptions struct {
 
 // ExecResult contains the result of a Git command execution
 type ExecResult struct {
-	ExitCode int
-	Stdout   string
-	Stderr   string
-	Duration time.Duration
+	ExitCode  int           `json:"exitCode"`
+	Stdout    string        `json:"stdout"`
+	Stderr    string        `json:"stderr"`
+	Duration  time.Duration `json:"duration"`
+	CPUTime   time.Duration `json:"cpuTime"`
+	MaxRSS    int64         `json:"maxRss"`
+	Truncated bool          `json:"truncated,omitempty"`
 }
 
 // AuthHint provides authentication guidance
 type AuthHint struct {
-	Type    string // "ssh", "https", "token"
-	Message string
-	Helper  string
+	Type    string `json:"type"` // "ssh", "https", "token"
+	Message string `json:"message"`
+	Helper  string `json:"helper,omitempty"`
+}
+
+// Credential holds the secrets used to authenticate against a remote.
+// Password is used for HTTPS remotes, SSHKeyFile for SSH remotes.
+type Credential struct {
+	Username   string
+	Password   string
+	SSHKeyFile string
+	// URL is the remote the credential was chosen for. Git only offers the
+	// password to the scheme and host of URL, or to every host if it is empty.
+	URL string
+}
+
+// String redacts the password so credentials never end up in logs
+func (c Credential) String() string {
+	password := ""
+	if c.Password != "" {
+		password = "***"
+	}
+	return fmt.Sprintf("{Username:%s Password:%s SSHKeyFile:%s}", c.Username, password, c.SSHKeyFile)
+}
+
+// GoString redacts the password for %#v as well
+func (c Credential) GoString() string {
+	return "core.Credential" + c.String()
+}
+
+// CredentialProvider supplies credentials for remote operations
+type CredentialProvider interface {
+	// Credential returns credentials for remoteURL, or nil if it has none
+	Credential(ctx context.Context, remoteURL string) (*Credential, error)
+}
+
+// Git features whose availability depends on the installed git version
+const (
+	FeatureBranchShowCurrent = "branch-show-current" // git branch --show-current (2.22)
+	FeatureTrace2            = "trace2"              // GIT_TRACE2_EVENT tracing (2.22)
+	FeatureSparseCheckout    = "sparse-checkout"     // git sparse-checkout (2.25)
+	FeatureCloneSparse       = "clone-sparse"        // git clone --sparse (2.27)
+	FeatureConfigGlobalEnv   = "config-global-env"   // GIT_CONFIG_GLOBAL and GIT_CONFIG_SYSTEM (2.32)
+)
+
+// Capabilities describes the installed git binary
+type Capabilities struct {
+	Version  string          `json:"version"`
+	Features map[string]bool `json:"features"`
+}
+
+// Has reports whether the git binary supports feature
+func (c *Capabilities) Has(feature string) bool {
+	return c != nil && c.Features[feature]
 }
 
 // BranchInfo represents branch information
 type BranchInfo struct {
-	Name     string
-	Current  bool
-	Remote   string
-	Upstream string
-	Ahead    int
-	Behind   int
+	Name     string `json:"name"`
+	Current  bool   `json:"current"`
+	Remote   string `json:"remote,omitempty"`
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
 }
 
 // RemoteInfo represents remote repository information
 type RemoteInfo struct {
-	Name     string
-	URL      string
-	FetchURL string
-	PushURL  string
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	FetchURL string `json:"fetchUrl,omitempty"`
+	PushURL  string `json:"pushUrl,omitempty"`
 }
 
 // CommitInfo represents commit information
 type CommitInfo struct {
-	Hash      string
-	ShortHash string
-	Author    string
-	Email     string
-	Date      time.Time
-	Subject   string
-	Body      string
+	Hash      string    `json:"hash"`
+	ShortHash string    `json:"shortHash"`
+	Author    string    `json:"author"`
+	Email     string    `json:"email"`
+	Date      time.Time `json:"date"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body"`
+	Parents   []string  `json:"parents,omitempty"` // Parent hashes, only listed by History
+	Paths     []string  `json:"paths,omitempty"`   // Files changed, only listed by History
+}
+
+// HistoryOptions selects the commits listed by History
+type HistoryOptions struct {
+	Revs     []string // Commits to list the history of
+	Exclude  []string // Commits whose history is left out, e.g. previously listed tips
+	MaxCount int      // Maximum number of commits, 0 for no limit
+	Skip     int      // Number of commits skipped before listing
 }
 
 // FileStatus represents file change status
 type FileStatus struct {
-	Path     string
-	Status   string // "M", "A", "D", "R", "C", "U", "?", "!"
-	Staged   bool
-	Modified bool
+	Path     string `json:"path"`
+	Status   string `json:"status"` // "M", "A", "D", "R", "C", "U", "?", "!"
+	Staged   bool   `json:"staged"`
+	Modified bool   `json:"modified"`
 }
 
 // RepoStatus represents repository status
 type RepoStatus struct {
-	Branch   string
-	Upstream string
-	Ahead    int
-	Behind   int
-	Files    []FileStatus
-	Clean    bool
+	Branch   string       `json:"branch"`
+	Upstream string       `json:"upstream"`
+	Ahead    int          `json:"ahead"`
+	Behind   int          `json:"behind"`
+	Files    []FileStatus `json:"files"`
+	Clean    bool         `json:"clean"`
+}
+
+// Snapshot records the refs saved before a destructive operation, such as a
+// forced branch deletion, so the operation can be undone
+type Snapshot struct {
+	ID        string            `json:"id"`
+	Time      time.Time         `json:"time"`
+	Operation string            `json:"operation"`
+	Refs      map[string]string `json:"refs,omitempty"`  // Ref name to the commit it pointed to
+	Head      string            `json:"head,omitempty"`  // Checked out branch ref, or commit if detached
+	Stash     string            `json:"stash,omitempty"` // Commit holding uncommitted changes, as made by git stash create
 }
 
 // CoreGit defines the main interface for Git operations
@@ -132,6 +208,8 @@ type CoreGit interface {
 	RevParse(ctx context.Context, repo *Repo, ref string) (string, error)
 	Show(ctx context.Context, repo *Repo, ref string) (string, error)
 	LsTree(ctx context.Context, repo *Repo, ref, path string) (string, error)
+	RefTips(ctx context.Context, repo *Repo) ([]string, error)
+	History(ctx context.Context, repo *Repo, opts HistoryOptions) ([]CommitInfo, error)
 
 	// Stash operations
 	StashSave(ctx context.Context, repo *Repo, message string, includeUntracked bool) error
@@ -153,6 +231,16 @@ type CoreGit interface {
 	LFSFetch(ctx context.Context, repo *Repo, remote string) error
 	LFSPull(ctx context.Context, repo *Repo, remote string) error
 
+	// Maintenance operations
+	GC(ctx context.Context, repo *Repo, aggressive, prune bool) error
+
+	// Undo operations
+	ListSnapshots(ctx context.Context, repo *Repo) ([]Snapshot, error)
+	RestoreSnapshot(ctx context.Context, repo *Repo, id string) error
+
 	// Raw command execution
 	RunRaw(ctx context.Context, repo *Repo, args []string) (*ExecResult, error)
+
+	// Capabilities reports the git version and supported features
+	Capabilities(ctx context.Context) (*Capabilities, error)
 }
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types emitted by the watcher and the job system
+const (
+	TypeHead        = "repo.head"
+	TypeRefs        = "repo.refs"
+	TypeIndex       = "repo.index"
+	TypeWorktree    = "repo.worktree"
+	TypeJobStarted  = "job.started"
+	TypeJobFinished = "job.finished"
+)
+
+// subscriberBuffer is the number of events buffered per subscriber.
+// Slow subscribers miss events instead of blocking publishers.
+const subscriberBuffer = 64
+
+// historySize is the number of recent events kept for resuming streams
+const historySize = 256
+
+// Event is a typed notification about a repository or job
+type Event struct {
+	ID     uint64      `json:"id"`
+	Type   string      `json:"type"`
+	RepoID string      `json:"repoId,omitempty"`
+	Time   time.Time   `json:"time"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// Bus fans out events to subscribers
+type Bus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	subscribers map[chan Event]struct{}
+	history     []Event
+	closed      bool
+}
+
+// NewBus creates an event bus
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish assigns an ID to the event and delivers it to all subscribers
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event.ID = b.nextID
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > historySize {
+		b.history = b.history[len(b.history)-historySize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Subscriber is not keeping up; drop rather than block
+		}
+	}
+}
+
+// Subscribe registers a subscriber. Events published after lastID that are
+// still in the history are replayed first, so clients can resume streams.
+// The returned function must be called to unsubscribe.
+func (b *Bus) Subscribe(lastID uint64) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer+historySize)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if lastID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastID {
+				ch <- event
+			}
+		}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+// Close ends all subscriptions; later subscribers receive a closed channel
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// HasSubscribers reports whether anyone is listening
+func (b *Bus) HasSubscribers() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers) > 0
+}
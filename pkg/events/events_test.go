@@ -0,0 +1,111 @@
+package events
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBusPublishSubscribe(t *testing.T) {
+	bus := NewBus()
+	stream, unsubscribe := bus.Subscribe(0)
+	defer unsubscribe()
+
+	bus.Publish(Event{Type: TypeRefs, RepoID: "repo1"})
+
+	select {
+	case event := <-stream:
+		if event.ID != 1 || event.Type != TypeRefs || event.RepoID != "repo1" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+		if event.Time.IsZero() {
+			t.Error("Expected event time to be set")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected event to be delivered")
+	}
+}
+
+func TestBusReplay(t *testing.T) {
+	bus := NewBus()
+	bus.Publish(Event{Type: TypeHead})
+	bus.Publish(Event{Type: TypeRefs})
+	bus.Publish(Event{Type: TypeIndex})
+
+	stream, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	for _, expected := range []string{TypeRefs, TypeIndex} {
+		event := <-stream
+		if event.Type != expected {
+			t.Errorf("Expected replayed %s, got %s", expected, event.Type)
+		}
+	}
+}
+
+func TestBusClose(t *testing.T) {
+	bus := NewBus()
+	stream, unsubscribe := bus.Subscribe(0)
+	defer unsubscribe()
+
+	bus.Close()
+	if _, ok := <-stream; ok {
+		t.Error("Expected stream to be closed")
+	}
+	if bus.HasSubscribers() {
+		t.Error("Expected no subscribers after Close")
+	}
+}
+
+func TestWatcherDetectsChanges(t *testing.T) {
+	workDir := t.TempDir()
+	gitDir := filepath.Join(workDir, ".git")
+	if err := os.MkdirAll(filepath.Join(gitDir, "refs", "heads"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	writeFile(t, filepath.Join(gitDir, "HEAD"), "ref: refs/heads/main\n")
+
+	bus := NewBus()
+	stream, unsubscribe := bus.Subscribe(0)
+	defer unsubscribe()
+
+	watcher := NewWatcher(bus, time.Second, func() []Target {
+		return []Target{{RepoID: "repo1", GitDir: gitDir, WorkDir: workDir}}
+	})
+
+	// First poll records the baseline without emitting events
+	watcher.Poll()
+	select {
+	case event := <-stream:
+		t.Fatalf("Unexpected event on baseline poll: %+v", event)
+	default:
+	}
+
+	writeFile(t, filepath.Join(gitDir, "HEAD"), "ref: refs/heads/feature\n")
+	writeFile(t, filepath.Join(gitDir, "refs", "heads", "feature"), "abc\n")
+	writeFile(t, filepath.Join(workDir, "file.txt"), "changed\n")
+	watcher.Poll()
+
+	got := make(map[string]bool)
+	for len(stream) > 0 {
+		event := <-stream
+		got[event.Type] = true
+	}
+
+	for _, expected := range []string{TypeHead, TypeRefs, TypeWorktree} {
+		if !got[expected] {
+			t.Errorf("Expected %s event, got %v", expected, got)
+		}
+	}
+	if got[TypeIndex] {
+		t.Error("Did not expect an index event")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
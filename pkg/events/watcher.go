@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/gitstate"
+)
+
+// Target is a repository the watcher polls
+type Target struct {
+	RepoID  string
+	GitDir  string
+	WorkDir string
+	IsBare  bool
+}
+
+// repoSnapshot is the last observed state of a target
+type repoSnapshot struct {
+	state    gitstate.State
+	worktree gitstate.Worktree
+}
+
+// Watcher detects repository changes by polling .git mtimes and publishes them on a bus.
+// It works without OS-specific notification APIs and only polls while the
+// bus has subscribers.
+type Watcher struct {
+	bus       *Bus
+	interval  time.Duration
+	targets   func() []Target
+	snapshots map[string]repoSnapshot
+}
+
+// NewWatcher creates a watcher that polls the repositories returned by targets
+func NewWatcher(bus *Bus, interval time.Duration, targets func() []Target) *Watcher {
+	return &Watcher{
+		bus:       bus,
+		interval:  interval,
+		targets:   targets,
+		snapshots: make(map[string]repoSnapshot),
+	}
+}
+
+// Run polls until ctx is canceled
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !w.bus.HasSubscribers() {
+				// Forget snapshots so a new subscriber doesn't get a burst of stale changes
+				w.snapshots = make(map[string]repoSnapshot)
+				continue
+			}
+			w.Poll()
+		}
+	}
+}
+
+// Poll compares every target with its previous snapshot and publishes changes.
+// The first observation of a target only records a baseline.
+func (w *Watcher) Poll() {
+	seen := make(map[string]bool)
+
+	for _, target := range w.targets() {
+		seen[target.RepoID] = true
+
+		current := repoSnapshot{state: gitstate.Read(target.GitDir)}
+		if !target.IsBare {
+			current.worktree = gitstate.ReadWorktree(target.WorkDir)
+		}
+
+		previous, ok := w.snapshots[target.RepoID]
+		w.snapshots[target.RepoID] = current
+		if !ok {
+			continue
+		}
+
+		if current.state.HeadChanged(previous.state) {
+			w.bus.Publish(Event{
+				Type:   TypeHead,
+				RepoID: target.RepoID,
+				Data:   map[string]string{"head": current.state.Head},
+			})
+		}
+		if current.state.RefsChanged(previous.state) {
+			w.bus.Publish(Event{Type: TypeRefs, RepoID: target.RepoID})
+		}
+		if current.state.IndexChanged(previous.state) {
+			w.bus.Publish(Event{Type: TypeIndex, RepoID: target.RepoID})
+		}
+		if current.worktree.Changed(previous.worktree) {
+			w.bus.Publish(Event{Type: TypeWorktree, RepoID: target.RepoID})
+		}
+	}
+
+	// Drop snapshots of repositories that are no longer watched
+	for id := range w.snapshots {
+		if !seen[id] {
+			delete(w.snapshots, id)
+		}
+	}
+}
@@ -1,192 +1,322 @@
 package index
 
 import (
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/felipemacedo1/go-coregit-pe/internal/gitstate"
 	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
 )
 
-// Cache provides lightweight caching for Git repository metadata
+// TTLs bounding how long metadata is cached. Entries are also invalidated as
+// soon as the repository's git state changes, see CacheEntry, so only status,
+// which also depends on worktree edits, needs a short TTL.
+const (
+	StatusTTL   = 30 * time.Second
+	BranchesTTL = time.Hour
+	RemotesTTL  = time.Hour
+	CommitsTTL  = time.Hour
+)
+
+// Keys of the entries stored by the typed helpers
+const (
+	branchesKey = "branches"
+	remotesKey  = "remotes"
+	statusKey   = "status"
+	commitsKey  = "commits"
+)
+
+// Cache provides lightweight caching for Git repository metadata. Entries
+// are encoded as JSON and kept in a Store, by default a FileStore behind an
+// LRUStore memory tier.
 type Cache struct {
-	basePath string
-	mu       sync.RWMutex
+	basePath      string
+	store         Store
+	backing       Store // store without the memory tier
+	logStore      bool
+	memoryEntries int
+	memoryBytes   int64
+	maxSize       int64
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	evictions     atomic.Uint64
 }
 
-// CacheEntry represents a cached item with TTL
-type CacheEntry struct {
-	Data      interface{}   `json:"data"`
-	Timestamp time.Time     `json:"timestamp"`
-	TTL       time.Duration `json:"ttl"`
+// CacheOption configures a Cache
+type CacheOption func(*Cache)
+
+// WithStore keeps entries in store, without a memory tier in front of it
+func WithStore(store Store) CacheOption {
+	return func(c *Cache) {
+		c.store = store
+	}
 }
 
-// NewCache creates a new cache instance
-func NewCache() (*Cache, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+// WithLogStore keeps entries in a single LogStore file, cache.log in the
+// cache directory, instead of a file per entry
+func WithLogStore() CacheOption {
+	return func(c *Cache) {
+		c.logStore = true
 	}
+}
 
-	basePath := filepath.Join(homeDir, ".gitmgr", "cache")
-	if err := os.MkdirAll(basePath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+// WithMemoryLimits bounds the memory tier to the given number of entries
+// and bytes. A limit <= 0 means no limit; with both the tier is disabled.
+func WithMemoryLimits(entries int, bytes int64) CacheOption {
+	return func(c *Cache) {
+		c.memoryEntries = entries
+		c.memoryBytes = bytes
 	}
+}
 
-	return &Cache{
-		basePath: basePath,
-	}, nil
+// WithMaxSize bounds the total size of the entries Prune keeps to size
+// bytes. A size <= 0 means no limit.
+func WithMaxSize(size int64) CacheOption {
+	return func(c *Cache) {
+		c.maxSize = size
+	}
 }
 
-// getRepoHash generates a unique hash for a repository path
-func (c *Cache) getRepoHash(repoPath string) string {
-	hash := sha256.Sum256([]byte(repoPath))
-	return fmt.Sprintf("%x", hash)
+// CacheStats reports the content of a cache and how it has been used since
+// it was created
+type CacheStats struct {
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`    // Including entries that failed to read
+	Evictions uint64 `json:"evictions"` // Entries removed by Prune
 }
 
-// getCacheDir returns the cache directory for a repository
-func (c *Cache) getCacheDir(repoPath string) string {
-	repoHash := c.getRepoHash(repoPath)
-	return filepath.Join(c.basePath, repoHash)
+// CacheEntryVersion is the version of the CacheEntry format. Entries of
+// other versions, including those written before entries were versioned,
+// are treated as misses and replaced.
+const CacheEntryVersion = 1
+
+// CacheEntry represents a cached item. It is valid until its TTL elapses or
+// the fingerprint of the repository's git state, taken when it was stored,
+// changes (see gitstate.Fingerprint), whichever comes first.
+type CacheEntry struct {
+	Version     int           `json:"version"`
+	Data        interface{}   `json:"data"`
+	Timestamp   time.Time     `json:"timestamp"`
+	TTL         time.Duration `json:"ttl"`
+	Fingerprint string        `json:"fingerprint"`
 }
 
-// ensureCacheDir creates the cache directory for a repository if it doesn't exist
-func (c *Cache) ensureCacheDir(repoPath string) error {
-	cacheDir := c.getCacheDir(repoPath)
-	return os.MkdirAll(cacheDir, 0755)
+// DefaultCacheDir returns the default cache directory: gitmgr in
+// $XDG_CACHE_HOME if it is set, ~/.gitmgr/cache otherwise
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, "gitmgr"), nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".gitmgr", "cache"), nil
 }
 
-// Set stores data in cache with TTL
-func (c *Cache) Set(repoPath, key string, data interface{}, ttl time.Duration) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// NewCache creates a new cache instance in DefaultCacheDir
+func NewCache(opts ...CacheOption) (*Cache, error) {
+	basePath, err := DefaultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return OpenCache(basePath, opts...)
+}
 
-	if err := c.ensureCacheDir(repoPath); err != nil {
-		return err
+// OpenCache creates a cache stored in the directory at basePath
+func OpenCache(basePath string, opts ...CacheOption) (*Cache, error) {
+	c := &Cache{
+		basePath:      basePath,
+		memoryEntries: DefaultMemoryEntries,
+		memoryBytes:   DefaultMemoryBytes,
+		maxSize:       DefaultMaxSize,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.store != nil {
+		c.backing = c.store
+		return c, nil
+	}
+
+	var store Store
+	var err error
+	if c.logStore {
+		store, err = OpenLogStore(filepath.Join(basePath, "cache.log"))
+	} else {
+		store, err = NewFileStore(basePath)
+	}
+	if err != nil {
+		return nil, err
 	}
+	c.backing = store
+	if c.memoryEntries > 0 || c.memoryBytes > 0 {
+		store = NewLRUStore(store, c.memoryEntries, c.memoryBytes)
+	}
+	c.store = store
+	return c, nil
+}
+
+// Set stores data in cache with TTL, tied to the current git state of the
+// repository at repoPath. The state is read after data was computed, so index
+// refreshes done by commands like git status do not invalidate the entry.
+func (c *Cache) Set(repoPath, key string, data interface{}, ttl time.Duration) error {
+	return c.setFingerprint(repoPath, key, data, ttl, fingerprint(repoPath))
+}
 
+// setFingerprint stores data tied to fp, a fingerprint taken before data was
+// computed, so the entry misses if the repository changed meanwhile
+func (c *Cache) setFingerprint(repoPath, key string, data interface{}, ttl time.Duration, fp string) error {
 	entry := CacheEntry{
-		Data:      data,
-		Timestamp: time.Now(),
-		TTL:       ttl,
+		Version:     CacheEntryVersion,
+		Data:        data,
+		Timestamp:   time.Now(),
+		TTL:         ttl,
+		Fingerprint: fp,
 	}
 
-	jsonData, err := json.MarshalIndent(entry, "", "  ")
+	jsonData, err := json.Marshal(entry)
 	if err != nil {
 		return fmt.Errorf("failed to marshal cache entry: %w", err)
 	}
 
-	cacheFile := filepath.Join(c.getCacheDir(repoPath), key+".json")
-	if err := os.WriteFile(cacheFile, jsonData, 0600); err != nil {
-		return fmt.Errorf("failed to write cache file: %w", err)
-	}
-
-	return nil
+	return c.store.Put(repoPath, key, jsonData)
 }
 
 // Get retrieves data from cache
 func (c *Cache) Get(repoPath, key string, target interface{}) (bool, error) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	cacheFile := filepath.Join(c.getCacheDir(repoPath), key+".json")
+	found, err := c.get(repoPath, key, target)
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return found, err
+}
 
-	data, err := os.ReadFile(cacheFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil // Cache miss
+// Stats returns the number and size of the stored entries, which are left
+// zero if they cannot be listed, and the counters of Get and Prune
+func (c *Cache) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+	if entries, err := c.store.Entries(); err == nil {
+		stats.Entries = len(entries)
+		for _, entry := range entries {
+			stats.Bytes += entry.Size
 		}
-		return false, fmt.Errorf("failed to read cache file: %w", err)
 	}
+	return stats
+}
+
+// storedEntry is a CacheEntry whose data is left encoded
+type storedEntry struct {
+	CacheEntry
+	Data json.RawMessage `json:"data"`
+}
 
-	var entry CacheEntry
-	if err := json.Unmarshal(data, &entry); err != nil {
-		return false, fmt.Errorf("failed to unmarshal cache entry: %w", err)
+// decodeEntry decodes a stored CacheEntry, reporting false if it is
+// corrupt or of another version
+func decodeEntry(data []byte) (*storedEntry, bool) {
+	var entry storedEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Version != CacheEntryVersion {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// get reads and decodes an entry that has not expired. Entries that cannot
+// be decoded, e.g. left by a crash or an older version, are removed and
+// reported as misses, so the next Set replaces them.
+func (c *Cache) get(repoPath, key string, target interface{}) (bool, error) {
+	data, found, err := c.store.Get(repoPath, key)
+	if err != nil || !found {
+		return false, err
 	}
 
-	// Check if entry has expired
-	if time.Since(entry.Timestamp) > entry.TTL {
-		// Entry expired, remove it
-		_ = os.Remove(cacheFile)
+	entry, ok := decodeEntry(data)
+	if !ok {
+		_ = c.store.Delete(repoPath, key)
 		return false, nil
 	}
 
-	// Unmarshal the actual data
-	entryData, err := json.Marshal(entry.Data)
-	if err != nil {
-		return false, fmt.Errorf("failed to marshal entry data: %w", err)
+	// Check if entry has expired or the repository changed since it was stored
+	if time.Since(entry.Timestamp) > entry.TTL || entry.Fingerprint != fingerprint(repoPath) {
+		_ = c.store.Delete(repoPath, key)
+		return false, nil
 	}
 
-	if err := json.Unmarshal(entryData, target); err != nil {
-		return false, fmt.Errorf("failed to unmarshal target data: %w", err)
+	if err := json.Unmarshal(entry.Data, target); err != nil {
+		_ = c.store.Delete(repoPath, key)
+		return false, nil
 	}
 
+	_ = c.store.Touch(repoPath, key)
 	return true, nil
 }
 
+// fingerprint identifies the git state of the repository at repoPath
+func fingerprint(repoPath string) string {
+	return gitstate.Fingerprint(gitstate.GitDir(repoPath))
+}
+
 // Delete removes an entry from cache
 func (c *Cache) Delete(repoPath, key string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	cacheFile := filepath.Join(c.getCacheDir(repoPath), key+".json")
-	if err := os.Remove(cacheFile); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete cache file: %w", err)
-	}
-
-	return nil
+	return c.store.Delete(repoPath, key)
 }
 
 // Clear removes all cache entries for a repository
 func (c *Cache) Clear(repoPath string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	cacheDir := c.getCacheDir(repoPath)
-	if err := os.RemoveAll(cacheDir); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to clear cache directory: %w", err)
-	}
+	return c.store.Clear(repoPath)
+}
 
-	return nil
+// ClearAll removes the cache entries of all repositories
+func (c *Cache) ClearAll() error {
+	return c.store.ClearAll()
 }
 
 // CacheBranches stores branch information in cache
 func (c *Cache) CacheBranches(repoPath string, branches []core.BranchInfo) error {
-	return c.Set(repoPath, "branches", branches, 5*time.Minute)
+	return c.Set(repoPath, branchesKey, branches, BranchesTTL)
 }
 
 // GetCachedBranches retrieves cached branch information
 func (c *Cache) GetCachedBranches(repoPath string) ([]core.BranchInfo, bool, error) {
 	var branches []core.BranchInfo
-	found, err := c.Get(repoPath, "branches", &branches)
+	found, err := c.Get(repoPath, branchesKey, &branches)
 	return branches, found, err
 }
 
 // CacheRemotes stores remote information in cache
 func (c *Cache) CacheRemotes(repoPath string, remotes []core.RemoteInfo) error {
-	return c.Set(repoPath, "remotes", remotes, 10*time.Minute)
+	return c.Set(repoPath, remotesKey, remotes, RemotesTTL)
 }
 
 // GetCachedRemotes retrieves cached remote information
 func (c *Cache) GetCachedRemotes(repoPath string) ([]core.RemoteInfo, bool, error) {
 	var remotes []core.RemoteInfo
-	found, err := c.Get(repoPath, "remotes", &remotes)
+	found, err := c.Get(repoPath, remotesKey, &remotes)
 	return remotes, found, err
 }
 
 // CacheStatus stores repository status in cache
 func (c *Cache) CacheStatus(repoPath string, status *core.RepoStatus) error {
-	return c.Set(repoPath, "status", status, 30*time.Second)
+	return c.Set(repoPath, statusKey, status, StatusTTL)
 }
 
 // GetCachedStatus retrieves cached repository status
 func (c *Cache) GetCachedStatus(repoPath string) (*core.RepoStatus, bool, error) {
 	var status core.RepoStatus
-	found, err := c.Get(repoPath, "status", &status)
+	found, err := c.Get(repoPath, statusKey, &status)
 	if err != nil {
 		return nil, found, err
 	}
@@ -198,12 +328,12 @@ func (c *Cache) GetCachedStatus(repoPath string) (*core.RepoStatus, bool, error)
 
 // CacheCommits stores commit history in cache
 func (c *Cache) CacheCommits(repoPath string, commits []core.CommitInfo) error {
-	return c.Set(repoPath, "commits", commits, 2*time.Minute)
+	return c.Set(repoPath, commitsKey, commits, CommitsTTL)
 }
 
 // GetCachedCommits retrieves cached commit history
 func (c *Cache) GetCachedCommits(repoPath string) ([]core.CommitInfo, bool, error) {
 	var commits []core.CommitInfo
-	found, err := c.Get(repoPath, "commits", &commits)
+	found, err := c.Get(repoPath, commitsKey, &commits)
 	return commits, found, err
 }
@@ -1,6 +1,8 @@
 package index
 
 import (
+	"fmt"
+	"os/exec"
 	"testing"
 	"time"
 
@@ -159,17 +161,81 @@ func TestCacheDelete(t *testing.T) {
 	_ = cache.Clear(repoPath)
 }
 
-func TestGetRepoHash(t *testing.T) {
+func TestCacheStats(t *testing.T) {
+	cache, err := NewCache()
+	if err != nil {
+		t.Fatalf("NewCache failed: %v", err)
+	}
+
+	repoPath := "/test/repo-stats"
+	if err := cache.Set(repoPath, "present", "data", time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	var result string
+	_, _ = cache.Get(repoPath, "present", &result)
+	_, _ = cache.Get(repoPath, "present", &result)
+	_, _ = cache.Get(repoPath, "missing", &result)
+
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %+v", stats)
+	}
+
+	// Clean up
+	_ = cache.Clear(repoPath)
+}
+
+func TestCacheInvalidatedByGitState(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
 	cache, err := NewCache()
 	if err != nil {
 		t.Fatalf("NewCache failed: %v", err)
 	}
 
+	repoPath := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-C", repoPath, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "initial")
+	defer func() { _ = cache.Clear(repoPath) }()
+
+	branches := []core.BranchInfo{{Name: "main", Current: true}}
+	if err := cache.CacheBranches(repoPath, branches); err != nil {
+		t.Fatalf("CacheBranches failed: %v", err)
+	}
+	if _, found, _ := cache.GetCachedBranches(repoPath); !found {
+		t.Fatal("Expected a hit while the repository is unchanged")
+	}
+
+	git("branch", "feature")
+	if _, found, _ := cache.GetCachedBranches(repoPath); found {
+		t.Error("Expected a miss after a branch was created")
+	}
+
+	if err := cache.CacheBranches(repoPath, branches); err != nil {
+		t.Fatalf("CacheBranches failed: %v", err)
+	}
+	git("commit", "-q", "--allow-empty", "-m", "second")
+	if _, found, _ := cache.GetCachedBranches(repoPath); found {
+		t.Error("Expected a miss after a commit")
+	}
+}
+
+func TestGetRepoHash(t *testing.T) {
 	path1 := "/test/repo1"
 	path2 := "/test/repo2"
 
-	hash1 := cache.getRepoHash(path1)
-	hash2 := cache.getRepoHash(path2)
+	hash1 := repoHash(path1)
+	hash2 := repoHash(path2)
 
 	if hash1 == hash2 {
 		t.Error("Different paths should have different hashes")
@@ -179,8 +245,52 @@ func TestGetRepoHash(t *testing.T) {
 	}
 
 	// Same path should produce same hash
-	hash1_again := cache.getRepoHash(path1)
+	hash1_again := repoHash(path1)
 	if hash1 != hash1_again {
 		t.Error("Same path should produce same hash")
 	}
 }
+
+func TestCacheUnreadableEntriesAreMisses(t *testing.T) {
+	cache, err := OpenCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	repoPath := t.TempDir()
+	unversioned := fmt.Sprintf(`{"data":"old","timestamp":%q,"ttl":3600000000000,"fingerprint":%q}`,
+		time.Now().Format(time.RFC3339Nano), fingerprint(repoPath))
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"truncated", `{"version":1,"data":"val`},
+		{"unversioned", unversioned},
+		{"future version", `{"version":99,"data":"new"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := cache.store.Put(repoPath, "key", []byte(tt.data)); err != nil {
+				t.Fatalf("Put failed: %v", err)
+			}
+
+			var value string
+			found, err := cache.Get(repoPath, "key", &value)
+			if err != nil || found {
+				t.Errorf("Expected a miss without error, got found %v and error %v", found, err)
+			}
+			if _, found, _ := cache.store.Get(repoPath, "key"); found {
+				t.Error("Expected the unreadable entry to be removed")
+			}
+
+			// The next Set heals the entry
+			if err := cache.Set(repoPath, "key", "value", time.Minute); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			if found, _ := cache.Get(repoPath, "key", &value); !found || value != "value" {
+				t.Errorf("Expected value after Set, got %q (found %v)", value, found)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package index
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/policy"
+)
+
+// allBranchesKey stores the branches listed including remote-tracking ones
+const allBranchesKey = "branches-all"
+
+// CachedGit wraps a CoreGit and serves ListBranches, ListRemotes, GetStatus
+// and Log from a Cache. Entries of a repository are dropped by the mutating
+// operations that may affect them, and the cache itself drops entries once
+// the repository's git state changes, which covers changes made outside of
+// CachedGit. The cache is best effort: failing to read or write an entry
+// falls back to the wrapped implementation.
+type CachedGit struct {
+	core.CoreGit
+	cache *Cache
+}
+
+// NewCachedGit wraps git so its read operations are cached in cache
+func NewCachedGit(git core.CoreGit, cache *Cache) *CachedGit {
+	return &CachedGit{CoreGit: git, cache: cache}
+}
+
+// logKey returns the cache key of a log query
+func logKey(ref string, maxCount int, oneline bool) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%t", ref, maxCount, oneline)))
+	return fmt.Sprintf("log-%x", hash[:8])
+}
+
+// CachePath returns the path the cache entries of repo are stored under:
+// its working tree, or its git directory if it is bare. A repository opened
+// from a subdirectory thus shares the entries of its root, and the entries
+// are tied to the state of its git directory.
+func CachePath(repo *core.Repo) string {
+	switch {
+	case repo.WorkDir != "" && !repo.IsBare:
+		return repo.WorkDir
+	case repo.GitDir != "":
+		return repo.GitDir
+	}
+	return repo.Path
+}
+
+// invalidate drops all cached entries of repo
+func (g *CachedGit) invalidate(repo *core.Repo) {
+	_ = g.cache.Clear(CachePath(repo))
+}
+
+// GetStatus returns the cached status of repo, running git on a miss
+func (g *CachedGit) GetStatus(ctx context.Context, repo *core.Repo) (*core.RepoStatus, error) {
+	path := CachePath(repo)
+	if status, found, err := g.cache.GetCachedStatus(path); err == nil && found {
+		return status, nil
+	}
+	status, err := g.CoreGit.GetStatus(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	// git status refreshes the index, so the entry is tied to the state after it ran
+	_ = g.cache.CacheStatus(path, status)
+	return status, nil
+}
+
+// ListRemotes returns the cached remotes of repo, running git on a miss
+func (g *CachedGit) ListRemotes(ctx context.Context, repo *core.Repo) ([]core.RemoteInfo, error) {
+	path := CachePath(repo)
+	if remotes, found, err := g.cache.GetCachedRemotes(path); err == nil && found {
+		return remotes, nil
+	}
+	// Read the state first, so changes made while git runs make the entry miss
+	fp := fingerprint(path)
+	remotes, err := g.CoreGit.ListRemotes(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	_ = g.cache.setFingerprint(path, remotesKey, remotes, RemotesTTL, fp)
+	return remotes, nil
+}
+
+// ListBranches returns the cached branches of repo, running git on a miss
+func (g *CachedGit) ListBranches(ctx context.Context, repo *core.Repo, all bool) ([]core.BranchInfo, error) {
+	path := CachePath(repo)
+	key := branchesKey
+	if all {
+		key = allBranchesKey
+	}
+	var branches []core.BranchInfo
+	if found, err := g.cache.Get(path, key, &branches); err == nil && found {
+		return branches, nil
+	}
+	fp := fingerprint(path)
+	branches, err := g.CoreGit.ListBranches(ctx, repo, all)
+	if err != nil {
+		return nil, err
+	}
+	_ = g.cache.setFingerprint(path, key, branches, BranchesTTL, fp)
+	return branches, nil
+}
+
+// Log returns the cached result of a log query, running git on a miss
+func (g *CachedGit) Log(ctx context.Context, repo *core.Repo, ref string, maxCount int, oneline bool) ([]core.CommitInfo, error) {
+	path := CachePath(repo)
+	key := logKey(ref, maxCount, oneline)
+	var commits []core.CommitInfo
+	if found, err := g.cache.Get(path, key, &commits); err == nil && found {
+		return commits, nil
+	}
+	fp := fingerprint(path)
+	commits, err := g.CoreGit.Log(ctx, repo, ref, maxCount, oneline)
+	if err != nil {
+		return nil, err
+	}
+	_ = g.cache.setFingerprint(path, key, commits, CommitsTTL, fp)
+	return commits, nil
+}
+
+// SetConfig invalidates the cache, since configuration affects every cached result
+func (g *CachedGit) SetConfig(ctx context.Context, repo *core.Repo, key, value string, global bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.SetConfig(ctx, repo, key, value, global)
+}
+
+// AddRemote invalidates the cached remotes
+func (g *CachedGit) AddRemote(ctx context.Context, repo *core.Repo, name, url string) error {
+	defer func() { _ = g.cache.Delete(CachePath(repo), remotesKey) }()
+	return g.CoreGit.AddRemote(ctx, repo, name, url)
+}
+
+// RemoveRemote invalidates the cache, since the remote's tracking branches are removed too
+func (g *CachedGit) RemoveRemote(ctx context.Context, repo *core.Repo, name string) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.RemoveRemote(ctx, repo, name)
+}
+
+// SetRemoteURL invalidates the cached remotes
+func (g *CachedGit) SetRemoteURL(ctx context.Context, repo *core.Repo, name, url string) error {
+	defer func() { _ = g.cache.Delete(CachePath(repo), remotesKey) }()
+	return g.CoreGit.SetRemoteURL(ctx, repo, name, url)
+}
+
+// Fetch invalidates the cache
+func (g *CachedGit) Fetch(ctx context.Context, repo *core.Repo, remote string, prune, tags bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.Fetch(ctx, repo, remote, prune, tags)
+}
+
+// Pull invalidates the cache
+func (g *CachedGit) Pull(ctx context.Context, repo *core.Repo, remote, branch string, rebase bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.Pull(ctx, repo, remote, branch, rebase)
+}
+
+// Push invalidates the cache, since remote-tracking branches move
+func (g *CachedGit) Push(ctx context.Context, repo *core.Repo, remote, branch string, force, tags bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.Push(ctx, repo, remote, branch, force, tags)
+}
+
+// CreateBranch invalidates the cache
+func (g *CachedGit) CreateBranch(ctx context.Context, repo *core.Repo, name, startPoint string) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.CreateBranch(ctx, repo, name, startPoint)
+}
+
+// DeleteBranch invalidates the cache
+func (g *CachedGit) DeleteBranch(ctx context.Context, repo *core.Repo, name string, force bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.DeleteBranch(ctx, repo, name, force)
+}
+
+// Checkout invalidates the cache
+func (g *CachedGit) Checkout(ctx context.Context, repo *core.Repo, ref string, createBranch bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.Checkout(ctx, repo, ref, createBranch)
+}
+
+// Tag invalidates the cache
+func (g *CachedGit) Tag(ctx context.Context, repo *core.Repo, name, ref, message string, sign bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.Tag(ctx, repo, name, ref, message, sign)
+}
+
+// DeleteTag invalidates the cache
+func (g *CachedGit) DeleteTag(ctx context.Context, repo *core.Repo, name string) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.DeleteTag(ctx, repo, name)
+}
+
+// Merge invalidates the cache
+func (g *CachedGit) Merge(ctx context.Context, repo *core.Repo, ref string, noFF bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.Merge(ctx, repo, ref, noFF)
+}
+
+// Rebase invalidates the cache
+func (g *CachedGit) Rebase(ctx context.Context, repo *core.Repo, upstream string, interactive bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.Rebase(ctx, repo, upstream, interactive)
+}
+
+// CherryPick invalidates the cache
+func (g *CachedGit) CherryPick(ctx context.Context, repo *core.Repo, commit string) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.CherryPick(ctx, repo, commit)
+}
+
+// Revert invalidates the cache
+func (g *CachedGit) Revert(ctx context.Context, repo *core.Repo, commit string) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.Revert(ctx, repo, commit)
+}
+
+// StashSave invalidates the cache
+func (g *CachedGit) StashSave(ctx context.Context, repo *core.Repo, message string, includeUntracked bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.StashSave(ctx, repo, message, includeUntracked)
+}
+
+// StashPop invalidates the cache
+func (g *CachedGit) StashPop(ctx context.Context, repo *core.Repo, index int) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.StashPop(ctx, repo, index)
+}
+
+// WorktreeCreate invalidates the cache, since it may create a branch
+func (g *CachedGit) WorktreeCreate(ctx context.Context, repo *core.Repo, path, branch string) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.WorktreeCreate(ctx, repo, path, branch)
+}
+
+// WorktreeRemove invalidates the cache
+func (g *CachedGit) WorktreeRemove(ctx context.Context, repo *core.Repo, path string, force bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.WorktreeRemove(ctx, repo, path, force)
+}
+
+// SubmoduleInit invalidates the cache
+func (g *CachedGit) SubmoduleInit(ctx context.Context, repo *core.Repo, path string) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.SubmoduleInit(ctx, repo, path)
+}
+
+// SubmoduleUpdate invalidates the cache, since submodule changes show in the status
+func (g *CachedGit) SubmoduleUpdate(ctx context.Context, repo *core.Repo, path string, recursive bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.SubmoduleUpdate(ctx, repo, path, recursive)
+}
+
+// LFSInstall invalidates the cache
+func (g *CachedGit) LFSInstall(ctx context.Context, repo *core.Repo) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.LFSInstall(ctx, repo)
+}
+
+// LFSFetch invalidates the cache
+func (g *CachedGit) LFSFetch(ctx context.Context, repo *core.Repo, remote string) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.LFSFetch(ctx, repo, remote)
+}
+
+// LFSPull invalidates the cache, since it replaces pointer files in the worktree
+func (g *CachedGit) LFSPull(ctx context.Context, repo *core.Repo, remote string) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.LFSPull(ctx, repo, remote)
+}
+
+// GC invalidates the cache, since it packs refs
+func (g *CachedGit) GC(ctx context.Context, repo *core.Repo, aggressive, prune bool) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.GC(ctx, repo, aggressive, prune)
+}
+
+// RestoreSnapshot invalidates the cache
+func (g *CachedGit) RestoreSnapshot(ctx context.Context, repo *core.Repo, id string) error {
+	defer g.invalidate(repo)
+	return g.CoreGit.RestoreSnapshot(ctx, repo, id)
+}
+
+// RunRaw invalidates the cache unless the command is read-only
+func (g *CachedGit) RunRaw(ctx context.Context, repo *core.Repo, args []string) (*core.ExecResult, error) {
+	if !policy.IsReadOnly(args) {
+		defer g.invalidate(repo)
+	}
+	return g.CoreGit.RunRaw(ctx, repo, args)
+}
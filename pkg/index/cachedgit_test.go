@@ -0,0 +1,226 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core/execgit"
+)
+
+// countingGit counts the calls reaching the wrapped implementation
+type countingGit struct {
+	core.CoreGit
+	calls map[string]int
+}
+
+func (g *countingGit) GetStatus(ctx context.Context, repo *core.Repo) (*core.RepoStatus, error) {
+	g.calls["status"]++
+	return &core.RepoStatus{Branch: "main"}, nil
+}
+
+func (g *countingGit) ListRemotes(ctx context.Context, repo *core.Repo) ([]core.RemoteInfo, error) {
+	g.calls["remotes"]++
+	return []core.RemoteInfo{{Name: "origin"}}, nil
+}
+
+func (g *countingGit) ListBranches(ctx context.Context, repo *core.Repo, all bool) ([]core.BranchInfo, error) {
+	g.calls["branches"]++
+	return []core.BranchInfo{{Name: "main", Current: true}}, nil
+}
+
+func (g *countingGit) Log(ctx context.Context, repo *core.Repo, ref string, maxCount int, oneline bool) ([]core.CommitInfo, error) {
+	g.calls["log"]++
+	return []core.CommitInfo{{Hash: ref}}, nil
+}
+
+func (g *countingGit) CreateBranch(ctx context.Context, repo *core.Repo, name, startPoint string) error {
+	return nil
+}
+
+func (g *countingGit) AddRemote(ctx context.Context, repo *core.Repo, name, url string) error {
+	return nil
+}
+
+func (g *countingGit) RunRaw(ctx context.Context, repo *core.Repo, args []string) (*core.ExecResult, error) {
+	return &core.ExecResult{}, nil
+}
+
+func TestCachedGit(t *testing.T) {
+	cache, err := OpenCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	inner := &countingGit{calls: make(map[string]int)}
+	git := NewCachedGit(inner, cache)
+	ctx := context.Background()
+	repo := &core.Repo{Path: t.TempDir()}
+
+	readAll := func() {
+		t.Helper()
+		if _, err := git.GetStatus(ctx, repo); err != nil {
+			t.Fatalf("GetStatus failed: %v", err)
+		}
+		if _, err := git.ListRemotes(ctx, repo); err != nil {
+			t.Fatalf("ListRemotes failed: %v", err)
+		}
+		if _, err := git.ListBranches(ctx, repo, false); err != nil {
+			t.Fatalf("ListBranches failed: %v", err)
+		}
+		commits, err := git.Log(ctx, repo, "main", 10, false)
+		if err != nil {
+			t.Fatalf("Log failed: %v", err)
+		}
+		if len(commits) != 1 || commits[0].Hash != "main" {
+			t.Errorf("Expected the commits of main, got %+v", commits)
+		}
+	}
+	expect := func(step string, want map[string]int) {
+		t.Helper()
+		for name, count := range want {
+			if inner.calls[name] != count {
+				t.Errorf("%s: expected %d %s calls, got %d", step, count, name, inner.calls[name])
+			}
+		}
+	}
+
+	readAll()
+	readAll()
+	expect("cached", map[string]int{"status": 1, "remotes": 1, "branches": 1, "log": 1})
+
+	// Different queries are cached separately
+	_, _ = git.ListBranches(ctx, repo, true)
+	_, _ = git.Log(ctx, repo, "dev", 10, false)
+	expect("queries", map[string]int{"branches": 2, "log": 2})
+
+	// Adding a remote only affects the remotes
+	_ = git.AddRemote(ctx, repo, "upstream", "https://example.com/repo.git")
+	readAll()
+	expect("add remote", map[string]int{"status": 1, "remotes": 2, "branches": 2, "log": 2})
+
+	// Read-only raw commands keep the cache
+	_, _ = git.RunRaw(ctx, repo, []string{"status"})
+	readAll()
+	expect("raw status", map[string]int{"status": 1, "remotes": 2, "branches": 2, "log": 2})
+
+	_, _ = git.RunRaw(ctx, repo, []string{"commit", "-m", "test"})
+	readAll()
+	expect("raw commit", map[string]int{"status": 2, "remotes": 3, "branches": 3, "log": 3})
+
+	_ = git.CreateBranch(ctx, repo, "feature", "")
+	readAll()
+	expect("create branch", map[string]int{"status": 3, "remotes": 4, "branches": 4, "log": 4})
+
+	if stats := cache.Stats(); stats.Hits == 0 || stats.Misses == 0 {
+		t.Errorf("Expected hits and misses, got %+v", stats)
+	}
+}
+
+// racingGit changes the refs of the repository while git lists them
+type racingGit struct {
+	countingGit
+	gitDir string
+}
+
+func (g *racingGit) ListBranches(ctx context.Context, repo *core.Repo, all bool) ([]core.BranchInfo, error) {
+	branches, err := g.countingGit.ListBranches(ctx, repo, all)
+	_ = os.WriteFile(filepath.Join(g.gitDir, "refs", "heads", fmt.Sprintf("branch-%d", g.calls["branches"])), []byte("0\n"), 0644)
+	return branches, err
+}
+
+func (g *racingGit) ListRemotes(ctx context.Context, repo *core.Repo) ([]core.RemoteInfo, error) {
+	remotes, err := g.countingGit.ListRemotes(ctx, repo)
+	_ = os.WriteFile(filepath.Join(g.gitDir, "config"), []byte(fmt.Sprintf("# %d\n", g.calls["remotes"])), 0644)
+	return remotes, err
+}
+
+func (g *racingGit) Log(ctx context.Context, repo *core.Repo, ref string, maxCount int, oneline bool) ([]core.CommitInfo, error) {
+	commits, err := g.countingGit.Log(ctx, repo, ref, maxCount, oneline)
+	_ = os.WriteFile(filepath.Join(g.gitDir, "refs", "heads", fmt.Sprintf("log-%d", g.calls["log"])), []byte("0\n"), 0644)
+	return commits, err
+}
+
+func TestCachedGitChangesWhileReading(t *testing.T) {
+	cache, err := OpenCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	repo := &core.Repo{Path: t.TempDir()}
+	gitDir := filepath.Join(repo.Path, ".git")
+	if err := os.MkdirAll(filepath.Join(gitDir, "refs", "heads"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	inner := &racingGit{countingGit: countingGit{calls: make(map[string]int)}, gitDir: gitDir}
+	git := NewCachedGit(inner, cache)
+	ctx := context.Background()
+
+	// The results may predate the changes, so they must not be served
+	// for the state after them
+	_, _ = git.ListBranches(ctx, repo, false)
+	_, _ = git.ListBranches(ctx, repo, false)
+	_, _ = git.ListRemotes(ctx, repo)
+	_, _ = git.ListRemotes(ctx, repo)
+	_, _ = git.Log(ctx, repo, "main", 10, false)
+	_, _ = git.Log(ctx, repo, "main", 10, false)
+	for _, name := range []string{"branches", "remotes", "log"} {
+		if inner.calls[name] != 2 {
+			t.Errorf("Expected 2 %s calls, got %d", name, inner.calls[name])
+		}
+	}
+}
+
+func TestCachedGitOpenedFromSubdirectory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	cache, err := OpenCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	root := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-C", root, "-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	run("commit", "-q", "--allow-empty", "-m", "initial")
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	ctx := context.Background()
+	inner := execgit.New()
+	repo, err := inner.Open(ctx, filepath.Join(root, "sub"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	git := NewCachedGit(inner, cache)
+
+	branches, err := git.ListBranches(ctx, repo, false)
+	if err != nil || len(branches) != 1 {
+		t.Fatalf("Expected 1 branch, got %+v, %v", branches, err)
+	}
+
+	// The entry follows the git state of the repository, not of the subdirectory
+	run("branch", "new")
+	branches, err = git.ListBranches(ctx, repo, false)
+	if err != nil || len(branches) != 2 {
+		t.Errorf("Expected 2 branches after git branch, got %+v, %v", branches, err)
+	}
+
+	// Entries are shared with the repository opened at its root
+	if path := CachePath(repo); path != repo.WorkDir {
+		t.Errorf("Expected entries under %s, got %s", repo.WorkDir, path)
+	}
+}
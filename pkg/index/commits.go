@@ -0,0 +1,404 @@
+package index
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/filelock"
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// CommitIndexVersion is the format version of commit index files. Indexes
+// written with another version are rebuilt.
+const CommitIndexVersion = 1
+
+// commitBatchSize is the number of commits read from git at a time, which
+// keeps the output of each command well below the executor's limit
+const commitBatchSize = 5000
+
+// CommitQuery selects indexed commits. Empty fields match every commit.
+type CommitQuery struct {
+	Author  string    // Substring of the author name or email, ignoring case
+	Message string    // Substring of the subject or body, ignoring case
+	Path    string    // File the commit changed, or a directory containing it
+	Since   time.Time // Oldest author date
+	Until   time.Time // Author date the commits must precede
+	Limit   int       // Maximum number of commits, 0 for all
+}
+
+// CommitIndex keeps the commits of repositories with the paths they
+// changed, so they can be searched without walking the history. Each
+// repository has a JSON lines file of commits and a state file recording
+// the ref tips indexed so far; updates only read the commits added since.
+//
+// The commits file is appended to and the state file replaced atomically
+// afterwards, so commits written by an interrupted update are ignored and
+// truncated. Processes sharing the directory serialize updates with an
+// advisory lock per repository.
+type CommitIndex struct {
+	dir   string
+	mu    sync.Mutex
+	repos map[string]*indexedRepo
+}
+
+// commitIndexState is the state file of a repository
+type commitIndexState struct {
+	Version int       `json:"version"`
+	Repo    string    `json:"repo"`
+	Tips    []string  `json:"tips"`
+	Size    int64     `json:"size"`    // Bytes of the commits file holding indexed commits
+	Created time.Time `json:"created"` // Start of the index, reset when it is rebuilt
+	Updated time.Time `json:"updated"`
+}
+
+// indexedRepo holds the loaded commits of a repository, parents first
+type indexedRepo struct {
+	mu      sync.Mutex
+	state   commitIndexState
+	commits []core.CommitInfo
+}
+
+// NewCommitIndex opens the commit index in the commits directory of
+// DefaultCacheDir
+func NewCommitIndex() (*CommitIndex, error) {
+	dir, err := DefaultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return OpenCommitIndex(filepath.Join(dir, "commits"))
+}
+
+// OpenCommitIndex opens the commit index stored in dir
+func OpenCommitIndex(dir string) (*CommitIndex, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create commit index directory: %w", err)
+	}
+	return &CommitIndex{dir: dir, repos: make(map[string]*indexedRepo)}, nil
+}
+
+// files returns the state, commits and lock files of a repository
+func (x *CommitIndex) files(repoPath string) (state, commits, lock string) {
+	base := filepath.Join(x.dir, repoHash(repoPath))
+	return base + ".json", base + ".commits", base + ".lock"
+}
+
+// lock takes the locks of a repository and loads its index from disk. The
+// returned function releases the locks.
+func (x *CommitIndex) lock(repoPath string) (*indexedRepo, func(), error) {
+	x.mu.Lock()
+	repo, ok := x.repos[repoPath]
+	if !ok {
+		repo = &indexedRepo{}
+		x.repos[repoPath] = repo
+	}
+	x.mu.Unlock()
+
+	repo.mu.Lock()
+	_, _, lockFile := x.files(repoPath)
+	unlock, err := filelock.Lock(lockFile)
+	if err != nil {
+		repo.mu.Unlock()
+		return nil, nil, err
+	}
+	release := func() {
+		unlock()
+		repo.mu.Unlock()
+	}
+	if err := x.load(repoPath, repo); err != nil {
+		release()
+		return nil, nil, err
+	}
+	return repo, release, nil
+}
+
+// load brings repo up to date with the files written by this or another
+// process, reading only the commits appended since it was last loaded. An
+// index of another version starts over empty. The caller holds the locks.
+func (x *CommitIndex) load(repoPath string, repo *indexedRepo) error {
+	stateFile, commitsFile, _ := x.files(repoPath)
+
+	state := commitIndexState{Version: CommitIndexVersion, Repo: repoPath}
+	data, err := os.ReadFile(stateFile)
+	switch {
+	case err == nil:
+		var stored commitIndexState
+		if json.Unmarshal(data, &stored) == nil && stored.Version == CommitIndexVersion && stored.Repo == repoPath {
+			state = stored
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to read commit index: %w", err)
+	}
+
+	// Start over if the index was rebuilt since it was loaded
+	if state.Size < repo.state.Size || !state.Created.Equal(repo.state.Created) {
+		repo.state, repo.commits = commitIndexState{}, nil
+	}
+
+	file, err := os.OpenFile(commitsFile, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open commit index: %w", err)
+	}
+	defer file.Close()
+
+	// Drop commits an interrupted update wrote past the indexed ones
+	if info, err := file.Stat(); err == nil && info.Size() > state.Size {
+		if err := file.Truncate(state.Size); err != nil {
+			return fmt.Errorf("failed to truncate commit index: %w", err)
+		}
+	}
+
+	if state.Size > repo.state.Size {
+		reader := bufio.NewReader(io.NewSectionReader(file, repo.state.Size, state.Size-repo.state.Size))
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read commit index: %w", err)
+			}
+			var commit core.CommitInfo
+			if json.Unmarshal(line, &commit) == nil {
+				repo.commits = append(repo.commits, commit)
+			}
+		}
+	}
+	repo.state = state
+	return nil
+}
+
+// Update indexes the commits of repo reachable from its refs that are not
+// indexed yet, returning how many were added. Indexed commits the refs no
+// longer reach, e.g. after a rebase or a forced push, are dropped, and if
+// the commits of the refs indexed before no longer exist, e.g. after a
+// forced push and gc, the index is rebuilt.
+func (x *CommitIndex) Update(ctx context.Context, git core.CoreGit, repo *core.Repo) (int, error) {
+	indexed, unlock, err := x.lock(repo.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	tips, err := git.RefTips(ctx, repo)
+	if err != nil {
+		return 0, err
+	}
+	if slices.Equal(tips, indexed.state.Tips) {
+		return 0, nil
+	}
+
+	commits, err := x.history(ctx, git, repo, tips, indexed.state.Tips)
+	var stale []core.CommitInfo
+	if err == nil && len(indexed.state.Tips) > 0 {
+		stale, err = x.history(ctx, git, repo, indexed.state.Tips, tips)
+	}
+
+	// Commits are rewritten from the start when some have to go
+	var kept []core.CommitInfo
+	rewrite := false
+	switch {
+	case err != nil && len(indexed.state.Tips) > 0 && ctx.Err() == nil:
+		commits, err = x.history(ctx, git, repo, tips, nil)
+		rewrite = true
+	case len(stale) > 0:
+		dropped := make(map[string]bool, len(stale))
+		for _, commit := range stale {
+			dropped[commit.Hash] = true
+		}
+		for _, commit := range indexed.commits {
+			if !dropped[commit.Hash] {
+				kept = append(kept, commit)
+			}
+		}
+		rewrite = true
+	}
+	if err != nil {
+		return 0, err
+	}
+	if rewrite {
+		// Record the reset first, so an interrupted rewrite is not taken
+		// for the commits of the old index
+		indexed.commits = nil
+		if err := x.saveState(indexed, commitIndexState{Version: CommitIndexVersion, Repo: repo.Path}); err != nil {
+			return 0, err
+		}
+	}
+
+	// Commits are stored parents first, so the file lists the history in
+	// topological order across updates
+	slices.Reverse(commits)
+	_, commitsFile, _ := x.files(repo.Path)
+	size, err := appendCommits(commitsFile, indexed.state.Size, append(kept, commits...))
+	if err != nil {
+		return 0, err
+	}
+
+	state := indexed.state
+	state.Tips = tips
+	state.Size = size
+	if err := x.saveState(indexed, state); err != nil {
+		return 0, err
+	}
+	indexed.commits = append(append(indexed.commits, kept...), commits...)
+	return len(commits), nil
+}
+
+// saveState replaces the state file of indexed with state, starting a new
+// index if state has no creation time
+func (x *CommitIndex) saveState(indexed *indexedRepo, state commitIndexState) error {
+	if state.Created.IsZero() {
+		state.Created = time.Now().UTC()
+	}
+	state.Updated = time.Now().UTC()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode commit index: %w", err)
+	}
+	stateFile, _, _ := x.files(state.Repo)
+	if err := writeFileAtomic(stateFile, data); err != nil {
+		return fmt.Errorf("failed to write commit index: %w", err)
+	}
+	indexed.state = state
+	return nil
+}
+
+// history reads the commits reachable from revs but not from exclude in
+// batches of commitBatchSize, children before their parents. revs are
+// commit hashes. Each batch continues from the revs and the parents of
+// listed commits that are not listed yet, which reach exactly the remaining
+// commits, so git does not walk the listed ones again as with --skip.
+func (x *CommitIndex) history(ctx context.Context, git core.CoreGit, repo *core.Repo, revs, exclude []string) ([]core.CommitInfo, error) {
+	var commits []core.CommitInfo
+	listed := make(map[string]bool)
+	for {
+		batch, err := git.History(ctx, repo, core.HistoryOptions{
+			Revs:     revs,
+			Exclude:  exclude,
+			MaxCount: commitBatchSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, batch...)
+		if len(batch) < commitBatchSize {
+			return commits, nil
+		}
+
+		for _, commit := range batch {
+			listed[commit.Hash] = true
+		}
+		pending := make(map[string]bool)
+		var next []string
+		for _, commit := range batch {
+			for _, parent := range commit.Parents {
+				if !listed[parent] && !pending[parent] {
+					pending[parent] = true
+					next = append(next, parent)
+				}
+			}
+		}
+		for _, rev := range revs {
+			if !listed[rev] && !pending[rev] {
+				pending[rev] = true
+				next = append(next, rev)
+			}
+		}
+		if len(next) == 0 {
+			return commits, nil
+		}
+		revs = next
+	}
+}
+
+// appendCommits writes commits to the file at path from offset and syncs
+// it, returning the new size
+func appendCommits(path string, offset int64, commits []core.CommitInfo) (int64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open commit index: %w", err)
+	}
+	defer file.Close()
+	if err := file.Truncate(offset); err != nil {
+		return 0, fmt.Errorf("failed to truncate commit index: %w", err)
+	}
+
+	var buf []byte
+	for _, commit := range commits {
+		line, err := json.Marshal(commit)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode commit: %w", err)
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	if _, err := file.WriteAt(buf, offset); err != nil {
+		return 0, fmt.Errorf("failed to write commit index: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to write commit index: %w", err)
+	}
+	return offset + int64(len(buf)), nil
+}
+
+// Search returns the indexed commits of a repository matching query,
+// newest first. It does not update the index.
+func (x *CommitIndex) Search(repoPath string, query CommitQuery) ([]core.CommitInfo, error) {
+	indexed, unlock, err := x.lock(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	author := strings.ToLower(query.Author)
+	message := strings.ToLower(query.Message)
+	path := strings.Trim(filepath.ToSlash(query.Path), "/")
+
+	matches := []core.CommitInfo{}
+	for i := len(indexed.commits) - 1; i >= 0; i-- {
+		commit := indexed.commits[i]
+		if !query.Since.IsZero() && commit.Date.Before(query.Since) {
+			continue
+		}
+		if !query.Until.IsZero() && !commit.Date.Before(query.Until) {
+			continue
+		}
+		if author != "" && !strings.Contains(strings.ToLower(commit.Author), author) &&
+			!strings.Contains(strings.ToLower(commit.Email), author) {
+			continue
+		}
+		if message != "" && !strings.Contains(strings.ToLower(commit.Subject+"\n"+commit.Body), message) {
+			continue
+		}
+		if path != "" && !touches(commit.Paths, path) {
+			continue
+		}
+		matches = append(matches, commit)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Date.After(matches[j].Date)
+	})
+	if query.Limit > 0 && len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+	}
+	return matches, nil
+}
+
+// touches reports whether paths contains path or a file below it
+func touches(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// historyGit serves a history whose commits are added oldest first, by
+// default on top of each other
+type historyGit struct {
+	core.CoreGit
+	commits []core.CommitInfo
+	tips    []string // Ref tips, the last commit if empty
+	calls   int
+}
+
+// commit appends a commit with the given author, subject and paths, whose
+// parent is the last commit
+func (g *historyGit) commit(author, subject string, paths ...string) {
+	var parents []string
+	if n := len(g.commits); n > 0 {
+		parents = []string{g.commits[n-1].Hash}
+	}
+	g.commitOn(parents, author, subject, paths...)
+}
+
+// commitOn appends a commit with the given parents
+func (g *historyGit) commitOn(parents []string, author, subject string, paths ...string) {
+	n := len(g.commits)
+	g.commits = append(g.commits, core.CommitInfo{
+		Hash:    fmt.Sprintf("%040x", n+1+len(subject)<<8),
+		Author:  author,
+		Email:   author + "@example.com",
+		Date:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, n),
+		Subject: subject,
+		Parents: parents,
+		Paths:   paths,
+	})
+}
+
+// last returns the hash of the last commit
+func (g *historyGit) last() string {
+	return g.commits[len(g.commits)-1].Hash
+}
+
+func (g *historyGit) RefTips(ctx context.Context, repo *core.Repo) ([]string, error) {
+	if len(g.tips) > 0 {
+		return g.tips, nil
+	}
+	if len(g.commits) == 0 {
+		return nil, nil
+	}
+	return []string{g.last()}, nil
+}
+
+// reachable returns the commits reachable from revs, failing for unknown ones
+func (g *historyGit) reachable(revs []string) (map[string]bool, error) {
+	parents := make(map[string][]string)
+	for _, commit := range g.commits {
+		parents[commit.Hash] = commit.Parents
+	}
+	seen := make(map[string]bool)
+	queue := append([]string(nil), revs...)
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if seen[hash] {
+			continue
+		}
+		if _, ok := parents[hash]; !ok {
+			return nil, fmt.Errorf("bad revision %s", hash)
+		}
+		seen[hash] = true
+		queue = append(queue, parents[hash]...)
+	}
+	return seen, nil
+}
+
+func (g *historyGit) History(ctx context.Context, repo *core.Repo, opts core.HistoryOptions) ([]core.CommitInfo, error) {
+	g.calls++
+	if opts.Skip > 0 {
+		return nil, fmt.Errorf("unexpected skip of %d commits", opts.Skip)
+	}
+	included, err := g.reachable(opts.Revs)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := g.reachable(opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commits are added after their parents, so newest first is a
+	// topological order
+	var commits []core.CommitInfo
+	for i := len(g.commits) - 1; i >= 0; i-- {
+		commit := g.commits[i]
+		if included[commit.Hash] && !excluded[commit.Hash] {
+			commits = append(commits, commit)
+		}
+	}
+	if opts.MaxCount > 0 && len(commits) > opts.MaxCount {
+		commits = commits[:opts.MaxCount]
+	}
+	return commits, nil
+}
+
+// subjects returns the subjects of commits
+func subjects(commits []core.CommitInfo) []string {
+	var list []string
+	for _, commit := range commits {
+		list = append(list, commit.Subject)
+	}
+	return list
+}
+
+func TestCommitIndexUpdate(t *testing.T) {
+	dir := t.TempDir()
+	x, err := OpenCommitIndex(dir)
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+	git := &historyGit{}
+	repo := &core.Repo{Path: "/repo"}
+	ctx := context.Background()
+
+	git.commit("alice", "initial", "README.md")
+	git.commit("bob", "add parser", "pkg/parser/parser.go")
+	added, err := x.Update(ctx, git, repo)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if added != 2 {
+		t.Errorf("Expected 2 commits indexed, got %d", added)
+	}
+
+	if added, _ := x.Update(ctx, git, repo); added != 0 || git.calls != 1 {
+		t.Errorf("Expected an unchanged repository not to be read, got %d commits in %d calls", added, git.calls)
+	}
+
+	git.commit("alice", "fix parser", "pkg/parser/parser.go")
+	if added, err := x.Update(ctx, git, repo); err != nil || added != 1 {
+		t.Errorf("Expected only the new commit indexed, got %d (%v)", added, err)
+	}
+
+	// Another instance, like another process, sees the indexed commits and
+	// appends to them
+	other, err := OpenCommitIndex(dir)
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+	git.commit("carol", "docs", "docs/guide.md")
+	if added, err := other.Update(ctx, git, repo); err != nil || added != 1 {
+		t.Errorf("Expected the other index to add 1 commit, got %d (%v)", added, err)
+	}
+	commits, err := x.Search(repo.Path, CommitQuery{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	want := []string{"docs", "fix parser", "add parser", "initial"}
+	if got := subjects(commits); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Commits the refs no longer reach after a forced push are dropped
+	base := git.commits[len(git.commits)-2].Hash
+	git.commitOn([]string{base}, "carol", "docs again", "docs/guide.md")
+	if added, err := x.Update(ctx, git, repo); err != nil || added != 1 {
+		t.Errorf("Expected the pushed commit indexed, got %d (%v)", added, err)
+	}
+	commits, _ = other.Search(repo.Path, CommitQuery{})
+	want = []string{"docs again", "fix parser", "add parser", "initial"}
+	if got := subjects(commits); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// A rewritten history whose indexed commits are gone is indexed anew
+	git.commits = nil
+	git.commit("dave", "rewritten", "main.go")
+	if added, err := x.Update(ctx, git, repo); err != nil || added != 1 {
+		t.Errorf("Expected the rewritten history indexed, got %d (%v)", added, err)
+	}
+	commits, _ = other.Search(repo.Path, CommitQuery{})
+	if got := subjects(commits); !reflect.DeepEqual(got, []string{"rewritten"}) {
+		t.Errorf("Expected only the rewritten commit, got %v", got)
+	}
+}
+
+func TestCommitIndexSearch(t *testing.T) {
+	x, err := OpenCommitIndex(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+	git := &historyGit{}
+	git.commit("alice", "initial", "README.md")
+	git.commit("bob", "Add parser", "pkg/parser/parser.go", "go.mod")
+	git.commit("alice", "fix parser crash", "pkg/parser/parser.go")
+	git.commit("carol", "docs", "docs/parser.md")
+	repo := &core.Repo{Path: "/repo"}
+	if _, err := x.Update(context.Background(), git, repo); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query CommitQuery
+		want  []string
+	}{
+		{"all", CommitQuery{}, []string{"docs", "fix parser crash", "Add parser", "initial"}},
+		{"author", CommitQuery{Author: "ALICE"}, []string{"fix parser crash", "initial"}},
+		{"email", CommitQuery{Author: "bob@example"}, []string{"Add parser"}},
+		{"message", CommitQuery{Message: "parser"}, []string{"fix parser crash", "Add parser"}},
+		{"file", CommitQuery{Path: "go.mod"}, []string{"Add parser"}},
+		{"directory", CommitQuery{Path: "pkg/parser/"}, []string{"fix parser crash", "Add parser"}},
+		{"directory prefix only", CommitQuery{Path: "pkg/pars"}, nil},
+		{"since", CommitQuery{Since: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)}, []string{"docs", "fix parser crash"}},
+		{"until", CommitQuery{Until: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)}, []string{"Add parser", "initial"}},
+		{"limit", CommitQuery{Limit: 1}, []string{"docs"}},
+		{"combined", CommitQuery{Author: "alice", Path: "pkg"}, []string{"fix parser crash"}},
+		{"unknown repository", CommitQuery{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoPath := repo.Path
+			if tt.name == "unknown repository" {
+				repoPath = "/other"
+			}
+			commits, err := x.Search(repoPath, tt.query)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if got := subjects(commits); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCommitIndexIgnoresInterruptedUpdates(t *testing.T) {
+	dir := t.TempDir()
+	x, err := OpenCommitIndex(dir)
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+	git := &historyGit{}
+	git.commit("alice", "initial", "README.md")
+	repo := &core.Repo{Path: "/repo"}
+	if _, err := x.Update(context.Background(), git, repo); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Commits appended without their state, as by an interrupted update
+	_, commitsFile, _ := x.files(repo.Path)
+	file, err := os.OpenFile(commitsFile, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	_, _ = file.WriteString("{\"hash\":\"partial\",\"subject\":\"partial\"}\n{\"hash\":")
+	file.Close()
+
+	reopened, err := OpenCommitIndex(dir)
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+	commits, err := reopened.Search(repo.Path, CommitQuery{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if got := subjects(commits); !reflect.DeepEqual(got, []string{"initial"}) {
+		t.Errorf("Expected only the indexed commit, got %v", got)
+	}
+
+	git.commit("bob", "second", "main.go")
+	if added, err := reopened.Update(context.Background(), git, repo); err != nil || added != 1 {
+		t.Fatalf("Expected 1 commit indexed after the interrupted update, got %d (%v)", added, err)
+	}
+	fresh, err := OpenCommitIndex(dir)
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+	commits, _ = fresh.Search(repo.Path, CommitQuery{})
+	if got := subjects(commits); !reflect.DeepEqual(got, []string{"second", "initial"}) {
+		t.Errorf("Expected second and initial, got %v", got)
+	}
+}
+
+func TestCommitIndexBatches(t *testing.T) {
+	x, err := OpenCommitIndex(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenCommitIndex failed: %v", err)
+	}
+
+	// A branch forks early and is merged last, so the first batch ends with
+	// commits of main and the second continues on both sides of the fork
+	git := &historyGit{}
+	for i := 0; i < commitBatchSize+1000; i++ {
+		git.commit("alice", "main")
+	}
+	main := git.last()
+	fork := git.commits[100].Hash
+	git.commitOn([]string{fork}, "bob", "side")
+	for i := 0; i < 9; i++ {
+		git.commit("bob", "side")
+	}
+	git.commitOn([]string{main, git.last()}, "alice", "merge")
+
+	repo := &core.Repo{Path: "/repo"}
+	added, err := x.Update(context.Background(), git, repo)
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if added != len(git.commits) || git.calls != 2 {
+		t.Errorf("Expected %d commits indexed in 2 calls, got %d in %d calls", len(git.commits), added, git.calls)
+	}
+
+	commits, err := x.Search(repo.Path, CommitQuery{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, commit := range commits {
+		if seen[commit.Hash] {
+			t.Fatalf("Expected every commit once, got %s twice", commit.Hash)
+		}
+		seen[commit.Hash] = true
+	}
+	if len(seen) != len(git.commits) {
+		t.Errorf("Expected %d commits, got %d", len(git.commits), len(seen))
+	}
+}
@@ -0,0 +1,117 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"time"
+)
+
+// DefaultMaxSize is the default bound of the total size of cache entries
+const DefaultMaxSize = 100 << 20
+
+// DefaultPruneInterval is how often the janitor prunes a cache by default
+const DefaultPruneInterval = 10 * time.Minute
+
+// Prune removes the entries of repositories that no longer exist, entries
+// that expired or whose repository changed since they were stored, and
+// entries that cannot be decoded. It then removes the least recently used
+// entries until the rest fit in the size limit. It returns the number of
+// entries removed, which are counted as evictions.
+func (c *Cache) Prune() (int, error) {
+	entries, err := c.store.Entries()
+	if err != nil {
+		return 0, err
+	}
+
+	byRepo := make(map[string][]StoreEntry)
+	for _, entry := range entries {
+		byRepo[entry.RepoPath] = append(byRepo[entry.RepoPath], entry)
+	}
+
+	removed := 0
+	var errs []error
+	var kept []StoreEntry
+	for repoPath, repoEntries := range byRepo {
+		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+			if err := c.store.Clear(repoPath); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removed += len(repoEntries)
+			continue
+		}
+
+		current := fingerprint(repoPath)
+		for _, entry := range repoEntries {
+			if c.valid(entry, current) {
+				kept = append(kept, entry)
+				continue
+			}
+			if err := c.store.Delete(repoPath, entry.Key); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removed++
+		}
+	}
+
+	if c.maxSize > 0 {
+		var size int64
+		for _, entry := range kept {
+			size += entry.Size
+		}
+		sort.Slice(kept, func(i, j int) bool {
+			return kept[i].Accessed.Before(kept[j].Accessed)
+		})
+		for _, entry := range kept {
+			if size <= c.maxSize {
+				break
+			}
+			if err := c.store.Delete(entry.RepoPath, entry.Key); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			size -= entry.Size
+			removed++
+		}
+	}
+
+	c.evictions.Add(uint64(removed))
+	return removed, errors.Join(errs...)
+}
+
+// valid reports whether an entry has neither expired nor been stored for a
+// git state other than current. It reads the entry from the backing store,
+// so pruning neither fills the memory tier nor counts as an access.
+func (c *Cache) valid(entry StoreEntry, current string) bool {
+	data, found, err := c.backing.Get(entry.RepoPath, entry.Key)
+	if err != nil || !found {
+		return false
+	}
+	stored, ok := decodeEntry(data)
+	if !ok {
+		return false
+	}
+	return time.Since(stored.Timestamp) <= stored.TTL && stored.Fingerprint == current
+}
+
+// RunJanitor prunes the cache every interval until ctx is canceled, passing
+// the outcome of each run to report if it is not nil
+func (c *Cache) RunJanitor(ctx context.Context, interval time.Duration, report func(removed int, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := c.Prune()
+			if report != nil {
+				report(removed, err)
+			}
+		}
+	}
+}
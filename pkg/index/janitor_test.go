@@ -0,0 +1,102 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	cache, err := OpenCache(t.TempDir(), WithMaxSize(0))
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	repo := t.TempDir()
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	_ = cache.Set(repo, "valid", "value", time.Hour)
+	_ = cache.Set(repo, "expired", "value", time.Nanosecond)
+	_ = cache.Set(missing, "status", "value", time.Hour)
+	_ = cache.store.Put(repo, "corrupt", []byte("{"))
+	time.Sleep(time.Millisecond)
+
+	removed, err := cache.Prune()
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("Expected 3 entries removed, got %d", removed)
+	}
+
+	var value string
+	if found, _ := cache.Get(repo, "valid", &value); !found {
+		t.Error("Expected the valid entry to be kept")
+	}
+	stats := cache.Stats()
+	if stats.Entries != 1 || stats.Bytes == 0 || stats.Evictions != 3 {
+		t.Errorf("Expected 1 entry with some bytes and 3 evictions, got %+v", stats)
+	}
+
+	if err := cache.ClearAll(); err != nil {
+		t.Fatalf("ClearAll failed: %v", err)
+	}
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("Expected no entries after ClearAll, got %d", stats.Entries)
+	}
+}
+
+func TestPruneEvictsLeastRecentlyUsed(t *testing.T) {
+	cache, err := OpenCache(t.TempDir(), WithMaxSize(0))
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	files := cache.backing.(*FileStore)
+	repo := t.TempDir()
+
+	for i, key := range []string{"a", "b", "c"} {
+		_ = cache.Set(repo, key, "value", time.Hour)
+		accessed := time.Now().Add(-time.Duration(3-i) * time.Hour)
+		if err := os.Chtimes(files.entryFile(repo, key), accessed, accessed); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+
+	// Reading a makes b the least recently used entry
+	var value string
+	if found, _ := cache.Get(repo, "a", &value); !found {
+		t.Fatal("Expected a to be cached")
+	}
+
+	cache.maxSize = cache.Stats().Bytes - 1
+	removed, err := cache.Prune()
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected 1 entry removed, got %d", removed)
+	}
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, found, _ := files.Get(repo, key); found != want {
+			t.Errorf("Expected %s kept to be %v, got %v", key, want, found)
+		}
+	}
+}
+
+func TestNewFileStoreRemovesLegacyDirs(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, repoHash("/old/repo"))
+	if err := os.MkdirAll(legacy, 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	_ = os.WriteFile(filepath.Join(legacy, "status.json"), []byte("{}"), 0600)
+	old := time.Now().Add(-time.Hour)
+	_ = os.Chtimes(legacy, old, old)
+
+	if _, err := NewFileStore(dir); err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("Expected the directory without a repository path to be removed")
+	}
+}
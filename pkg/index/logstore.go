@@ -0,0 +1,384 @@
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/filelock"
+)
+
+// DefaultCompactSize is the log size below which a LogStore is not compacted
+const DefaultCompactSize = 1 << 20
+
+// Operations of LogStore records
+const (
+	logPut    = "put"
+	logDelete = "delete"
+	logClear  = "clear"
+)
+
+// LogStore stores all entries in a single append-only file, one JSON record
+// per line, which suits many small entries better than a file each. An index
+// of the live records is kept in memory and rebuilt from the file when it is
+// opened. Once the file holds more than twice the bytes of its live records
+// it is compacted by rewriting only those.
+//
+// Processes sharing the file coordinate with an advisory lock on path.lock.
+// Holding it, a store first catches up with the records other processes
+// appended, or reopens the file if another process compacted or cleared it.
+type LogStore struct {
+	path        string
+	compactSize int64
+
+	mu    sync.Mutex
+	file  *os.File
+	size  int64 // Bytes of the file indexed so far
+	live  int64 // Bytes of the records in index
+	index map[string]map[string]logPosition
+}
+
+// logRecord is a line of a LogStore file
+type logRecord struct {
+	Op   string    `json:"op"`
+	Repo string    `json:"repo"`
+	Key  string    `json:"key,omitempty"`
+	Data []byte    `json:"data,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// logPosition locates a record in a LogStore file
+type logPosition struct {
+	offset   int64
+	length   int64
+	accessed time.Time // Initially the time of the record
+}
+
+// OpenLogStore opens or creates the log store file at path. A record left
+// incomplete by an interrupted write is truncated.
+func OpenLogStore(path string) (*LogStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	s := &LogStore{path: path, compactSize: DefaultCompactSize}
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	unlock()
+	return s, nil
+}
+
+// lock takes the in-process and cross-process locks and brings the index up
+// to date with the file. The returned function releases both.
+func (s *LogStore) lock() (func(), error) {
+	s.mu.Lock()
+	unlock, err := filelock.Lock(s.path + ".lock")
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	release := func() {
+		unlock()
+		s.mu.Unlock()
+	}
+	if err := s.sync(); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// sync reads the records appended by other processes, or reopens the file if
+// it was replaced or truncated; the caller holds the locks
+func (s *LogStore) sync() error {
+	if s.file == nil {
+		return s.open()
+	}
+	current, err := os.Stat(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat cache log: %w", err)
+	}
+	opened, statErr := s.file.Stat()
+	if err != nil || statErr != nil || !os.SameFile(current, opened) || current.Size() < s.size {
+		s.file.Close()
+		return s.open()
+	}
+	if current.Size() > s.size {
+		return s.replay()
+	}
+	return nil
+}
+
+// open opens the file and rebuilds the index from its records
+func (s *LogStore) open() error {
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		s.file = nil
+		return fmt.Errorf("failed to open cache log: %w", err)
+	}
+	s.file = file
+	s.index = make(map[string]map[string]logPosition)
+	s.size, s.live = 0, 0
+	return s.replay()
+}
+
+// replay applies the records following the indexed part of the file. A
+// complete record that cannot be decoded is skipped, so it only wastes space
+// until the next compaction; an incomplete last record is truncated.
+func (s *LogStore) replay() error {
+	reader := bufio.NewReader(io.NewSectionReader(s.file, s.size, 1<<62))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				if err := s.file.Truncate(s.size); err != nil {
+					return fmt.Errorf("failed to truncate cache log: %w", err)
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read cache log: %w", err)
+		}
+		var record logRecord
+		if json.Unmarshal(line, &record) == nil {
+			s.apply(record, logPosition{offset: s.size, length: int64(len(line)), accessed: record.Time})
+		}
+		s.size += int64(len(line))
+	}
+}
+
+// apply updates the index with a record found at pos
+func (s *LogStore) apply(record logRecord, pos logPosition) {
+	keys := s.index[record.Repo]
+	switch record.Op {
+	case logPut:
+		if keys == nil {
+			keys = make(map[string]logPosition)
+			s.index[record.Repo] = keys
+		}
+		s.live -= keys[record.Key].length
+		keys[record.Key] = pos
+		s.live += pos.length
+	case logDelete:
+		s.live -= keys[record.Key].length
+		delete(keys, record.Key)
+		if len(keys) == 0 {
+			delete(s.index, record.Repo)
+		}
+	case logClear:
+		for _, old := range keys {
+			s.live -= old.length
+		}
+		delete(s.index, record.Repo)
+	}
+}
+
+// append writes a record at the end of the file, with the current time, and
+// applies it. Records are not synced to disk: a crash may lose the last ones
+// or leave an incomplete record, which is truncated when the file is read.
+func (s *LogStore) append(record logRecord) error {
+	record.Time = time.Now()
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache record: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := s.file.WriteAt(line, s.size); err != nil {
+		// Drop a partial record so later ones stay readable
+		_ = s.file.Truncate(s.size)
+		return fmt.Errorf("failed to write cache log: %w", err)
+	}
+	s.apply(record, logPosition{offset: s.size, length: int64(len(line)), accessed: record.Time})
+	s.size += int64(len(line))
+
+	if s.size > s.compactSize && s.size > 2*s.live {
+		return s.compact()
+	}
+	return nil
+}
+
+// read returns the record at pos
+func (s *LogStore) read(pos logPosition) (logRecord, error) {
+	var record logRecord
+	line := make([]byte, pos.length)
+	if _, err := s.file.ReadAt(line, pos.offset); err != nil {
+		return record, fmt.Errorf("failed to read cache log: %w", err)
+	}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return record, fmt.Errorf("failed to decode cache record: %w", err)
+	}
+	return record, nil
+}
+
+// Get returns the data of the last put record of key
+func (s *LogStore) Get(repoPath, key string) ([]byte, bool, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
+
+	pos, ok := s.index[repoPath][key]
+	if !ok {
+		return nil, false, nil
+	}
+	record, err := s.read(pos)
+	if err != nil {
+		return nil, false, err
+	}
+	return record.Data, true, nil
+}
+
+// Put appends a record storing data for key
+func (s *LogStore) Put(repoPath, key string, data []byte) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.append(logRecord{Op: logPut, Repo: repoPath, Key: key, Data: data})
+}
+
+// Touch updates the access time of key. It is only kept in memory, so after
+// reopening the store the time of the last put counts.
+func (s *LogStore) Touch(repoPath, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pos, ok := s.index[repoPath][key]; ok {
+		pos.accessed = time.Now()
+		s.index[repoPath][key] = pos
+	}
+	return nil
+}
+
+// Delete appends a record removing key, if it is stored
+func (s *LogStore) Delete(repoPath, key string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, ok := s.index[repoPath][key]; !ok {
+		return nil
+	}
+	return s.append(logRecord{Op: logDelete, Repo: repoPath, Key: key})
+}
+
+// Clear appends a record removing all keys of a repository, if any are stored
+func (s *LogStore) Clear(repoPath string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, ok := s.index[repoPath]; !ok {
+		return nil
+	}
+	return s.append(logRecord{Op: logClear, Repo: repoPath})
+}
+
+// ClearAll truncates the file
+func (s *LogStore) ClearAll() error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate cache log: %w", err)
+	}
+	s.index = make(map[string]map[string]logPosition)
+	s.size, s.live = 0, 0
+	return nil
+}
+
+// Entries lists the live records
+func (s *LogStore) Entries() ([]StoreEntry, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	var entries []StoreEntry
+	for repoPath, keys := range s.index {
+		for key, pos := range keys {
+			entries = append(entries, StoreEntry{RepoPath: repoPath, Key: key, Size: pos.length, Accessed: pos.accessed})
+		}
+	}
+	return entries, nil
+}
+
+// Compact rewrites the file with only the live records
+func (s *LogStore) Compact() error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return s.compact()
+}
+
+// compact writes the live records to a temporary file that replaces the
+// log, then reopens it; the caller holds the locks
+func (s *LogStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to compact cache log: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	for _, keys := range s.index {
+		for _, pos := range keys {
+			line := make([]byte, pos.length)
+			if _, err := s.file.ReadAt(line, pos.offset); err != nil {
+				tmp.Close()
+				return fmt.Errorf("failed to compact cache log: %w", err)
+			}
+			if _, err := writer.Write(line); err != nil {
+				tmp.Close()
+				return fmt.Errorf("failed to compact cache log: %w", err)
+			}
+		}
+	}
+	if err := errors.Join(writer.Flush(), tmp.Sync(), tmp.Close()); err != nil {
+		return fmt.Errorf("failed to compact cache log: %w", err)
+	}
+
+	// Windows cannot replace a file that is still open
+	s.file.Close()
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		if openErr := s.open(); openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("failed to compact cache log: %w", err)
+	}
+	return s.open()
+}
+
+// Size returns the size of the log file in bytes
+func (s *LogStore) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Close closes the log file
+func (s *LogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,229 @@
+package index
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Default bounds of the in-memory tier of a Cache
+const (
+	DefaultMemoryEntries = 1000
+	DefaultMemoryBytes   = 16 << 20
+)
+
+// LRUStore keeps entries in memory, evicting the least recently used ones
+// beyond a number of entries or bytes. Given a next store it is a
+// write-through tier in front of it: misses are read from next and kept,
+// and writes go to both. Without one it is a plain memory store.
+type LRUStore struct {
+	next       Store
+	maxEntries int
+	maxBytes   int64
+
+	mu      sync.Mutex
+	order   *list.List // Front is the most recently used
+	entries map[lruKey]*list.Element
+	bytes   int64
+	// generation counts writes, so data read from next is not kept if it
+	// may have been replaced while it was read
+	generation uint64
+}
+
+// lruKey identifies an entry of an LRUStore
+type lruKey struct {
+	repoPath string
+	key      string
+}
+
+// lruEntry is the value of an element of LRUStore.order
+type lruEntry struct {
+	key      lruKey
+	data     []byte
+	accessed time.Time
+}
+
+// NewLRUStore creates a memory store holding at most maxEntries entries and
+// maxBytes bytes, in front of next if it is not nil. A limit <= 0 means no limit.
+func NewLRUStore(next Store, maxEntries int, maxBytes int64) *LRUStore {
+	return &LRUStore{
+		next:       next,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		entries:    make(map[lruKey]*list.Element),
+	}
+}
+
+// size returns the bytes an entry accounts for
+func (e *lruEntry) size() int64 {
+	return int64(len(e.key.repoPath) + len(e.key.key) + len(e.data))
+}
+
+// Get returns the entry from memory, or reads it from the next store
+func (s *LRUStore) Get(repoPath, key string) ([]byte, bool, error) {
+	k := lruKey{repoPath, key}
+	s.mu.Lock()
+	if elem, ok := s.entries[k]; ok {
+		s.order.MoveToFront(elem)
+		data := elem.Value.(*lruEntry).data
+		s.mu.Unlock()
+		return data, true, nil
+	}
+	generation := s.generation
+	s.mu.Unlock()
+
+	if s.next == nil {
+		return nil, false, nil
+	}
+	data, found, err := s.next.Get(repoPath, key)
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation == generation {
+		s.add(k, data)
+	}
+	return data, true, nil
+}
+
+// Put stores the entry in the next store and in memory
+func (s *LRUStore) Put(repoPath, key string, data []byte) error {
+	if s.next != nil {
+		if err := s.next.Put(repoPath, key, data); err != nil {
+			s.remove(lruKey{repoPath, key})
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	s.add(lruKey{repoPath, key}, data)
+	return nil
+}
+
+// Delete removes the entry from memory and the next store
+func (s *LRUStore) Delete(repoPath, key string) error {
+	var err error
+	if s.next != nil {
+		err = s.next.Delete(repoPath, key)
+	}
+	s.remove(lruKey{repoPath, key})
+	return err
+}
+
+// Clear removes the entries of a repository from memory and the next store
+func (s *LRUStore) Clear(repoPath string) error {
+	var err error
+	if s.next != nil {
+		err = s.next.Clear(repoPath)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	for k, elem := range s.entries {
+		if k.repoPath == repoPath {
+			s.removeElement(elem)
+		}
+	}
+	return err
+}
+
+// Touch marks the entry as recently used in memory and the next store
+func (s *LRUStore) Touch(repoPath, key string) error {
+	s.mu.Lock()
+	if elem, ok := s.entries[lruKey{repoPath, key}]; ok {
+		s.order.MoveToFront(elem)
+		elem.Value.(*lruEntry).accessed = time.Now()
+	}
+	s.mu.Unlock()
+
+	if s.next != nil {
+		return s.next.Touch(repoPath, key)
+	}
+	return nil
+}
+
+// ClearAll removes all entries from memory and the next store
+func (s *LRUStore) ClearAll() error {
+	var err error
+	if s.next != nil {
+		err = s.next.ClearAll()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	s.order.Init()
+	s.entries = make(map[lruKey]*list.Element)
+	s.bytes = 0
+	return err
+}
+
+// Entries lists the entries of the next store, or those held in memory
+// without one
+func (s *LRUStore) Entries() ([]StoreEntry, error) {
+	if s.next != nil {
+		return s.next.Entries()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]StoreEntry, 0, s.order.Len())
+	for elem := s.order.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*lruEntry)
+		entries = append(entries, StoreEntry{
+			RepoPath: entry.key.repoPath,
+			Key:      entry.key.key,
+			Size:     entry.size(),
+			Accessed: entry.accessed,
+		})
+	}
+	return entries, nil
+}
+
+// Len returns the number of entries held in memory
+func (s *LRUStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// add keeps an entry in memory and evicts entries beyond the limits. Entries
+// larger than the byte limit are not kept. The caller holds s.mu.
+func (s *LRUStore) add(k lruKey, data []byte) {
+	entry := &lruEntry{key: k, data: data, accessed: time.Now()}
+	if elem, ok := s.entries[k]; ok {
+		s.removeElement(elem)
+	}
+	if s.maxBytes > 0 && entry.size() > s.maxBytes {
+		return
+	}
+	s.entries[k] = s.order.PushFront(entry)
+	s.bytes += entry.size()
+
+	for (s.maxEntries > 0 && s.order.Len() > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		s.removeElement(s.order.Back())
+	}
+}
+
+// remove drops an entry from memory
+func (s *LRUStore) remove(k lruKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	if elem, ok := s.entries[k]; ok {
+		s.removeElement(elem)
+	}
+}
+
+// removeElement drops an element; the caller holds s.mu
+func (s *LRUStore) removeElement(elem *list.Element) {
+	entry := elem.Value.(*lruEntry)
+	s.order.Remove(elem)
+	delete(s.entries, entry.key)
+	s.bytes -= entry.size()
+}
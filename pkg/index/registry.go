@@ -0,0 +1,205 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// RepoRecord describes a registered repository and its cached metadata
+type RepoRecord struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Repo         core.Repo `json:"repo"`
+	Branch       string    `json:"branch,omitempty"`
+	Head         string    `json:"head,omitempty"`
+	RegisteredAt time.Time `json:"registeredAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Registry persists registered repositories in a single JSON file
+type Registry struct {
+	path    string
+	mu      sync.RWMutex
+	records map[string]*RepoRecord
+}
+
+// RepoID derives a stable repository identifier from its path
+func RepoID(repoPath string) string {
+	hash := sha256.Sum256([]byte(repoPath))
+	return fmt.Sprintf("%x", hash[:8])
+}
+
+// NewRegistry opens the registry stored in ~/.gitmgr/registry.json
+func NewRegistry() (*Registry, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return OpenRegistry(filepath.Join(homeDir, ".gitmgr", "registry.json"))
+}
+
+// OpenRegistry opens the registry stored at path, creating it on first save
+func OpenRegistry(path string) (*Registry, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create registry directory: %w", err)
+	}
+
+	r := &Registry{
+		path:    path,
+		records: make(map[string]*RepoRecord),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("failed to read registry file: %w", err)
+	}
+
+	var records []*RepoRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal registry: %w", err)
+	}
+	for _, record := range records {
+		r.records[record.ID] = record
+	}
+
+	return r, nil
+}
+
+// Add registers a repository, replacing any previous record for the same path
+func (r *Registry) Add(record RepoRecord) (RepoRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	record.ID = RepoID(record.Repo.Path)
+	if record.Name == "" {
+		record.Name = filepath.Base(record.Repo.Path)
+	}
+	if existing, ok := r.records[record.ID]; ok {
+		record.RegisteredAt = existing.RegisteredAt
+	} else {
+		record.RegisteredAt = now
+	}
+	record.UpdatedAt = now
+
+	previous, existed := r.records[record.ID]
+	r.records[record.ID] = &record
+	if err := r.save(); err != nil {
+		if existed {
+			r.records[record.ID] = previous
+		} else {
+			delete(r.records, record.ID)
+		}
+		return RepoRecord{}, err
+	}
+
+	return record, nil
+}
+
+// Get returns the record registered under id
+func (r *Registry) Get(id string) (RepoRecord, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, ok := r.records[id]
+	if !ok {
+		return RepoRecord{}, false
+	}
+	return *record, true
+}
+
+// List returns all registered repositories ordered by name
+func (r *Registry) List() []RepoRecord {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	records := make([]RepoRecord, 0, len(r.records))
+	for _, record := range r.records {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return records[i].ID < records[j].ID
+	})
+
+	return records
+}
+
+// Update applies fn to the record registered under id and persists the result
+func (r *Registry) Update(id string, fn func(*RepoRecord)) (RepoRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[id]
+	if !ok {
+		return RepoRecord{}, fmt.Errorf("repository %s is not registered", id)
+	}
+
+	updated := *record
+	fn(&updated)
+	updated.ID = id
+	updated.UpdatedAt = time.Now().UTC()
+
+	r.records[id] = &updated
+	if err := r.save(); err != nil {
+		r.records[id] = record
+		return RepoRecord{}, err
+	}
+	return updated, nil
+}
+
+// Remove unregisters a repository; it reports whether the id was registered
+func (r *Registry) Remove(id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[id]
+	if !ok {
+		return false, nil
+	}
+
+	delete(r.records, id)
+	if err := r.save(); err != nil {
+		r.records[id] = record
+		return true, err
+	}
+	return true, nil
+}
+
+// save writes all records to disk, replacing the file atomically so a crash
+// leaves either the old or the new registry; callers must hold the write lock
+// and restore the records if it fails
+func (r *Registry) save() error {
+	records := make([]*RepoRecord, 0, len(r.records))
+	for _, record := range r.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID < records[j].ID
+	})
+
+	jsonData, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal registry: %w", err)
+	}
+
+	if err := writeFileAtomic(r.path, jsonData); err != nil {
+		return fmt.Errorf("failed to write registry file: %w", err)
+	}
+
+	return nil
+}
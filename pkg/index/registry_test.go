@@ -0,0 +1,106 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+func TestRegistryAddGetRemove(t *testing.T) {
+	registry, err := OpenRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatalf("OpenRegistry failed: %v", err)
+	}
+
+	record, err := registry.Add(RepoRecord{Repo: core.Repo{Path: "/test/repo"}})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if record.ID != RepoID("/test/repo") {
+		t.Errorf("Expected ID %s, got %s", RepoID("/test/repo"), record.ID)
+	}
+	if record.Name != "repo" {
+		t.Errorf("Expected default name 'repo', got %q", record.Name)
+	}
+
+	found, ok := registry.Get(record.ID)
+	if !ok {
+		t.Fatal("Expected to find registered repository")
+	}
+	if found.Repo.Path != "/test/repo" {
+		t.Errorf("Expected path /test/repo, got %s", found.Repo.Path)
+	}
+
+	removed, err := registry.Remove(record.ID)
+	if err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if !removed {
+		t.Error("Expected repository to be removed")
+	}
+	if _, ok := registry.Get(record.ID); ok {
+		t.Error("Expected removed repository to not be found")
+	}
+}
+
+func TestRegistryPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+
+	registry, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatalf("OpenRegistry failed: %v", err)
+	}
+	record, err := registry.Add(RepoRecord{Name: "demo", Repo: core.Repo{Path: "/test/demo"}, Branch: "main"})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	reopened, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatalf("OpenRegistry failed: %v", err)
+	}
+	records := reopened.List()
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	if records[0].ID != record.ID || records[0].Branch != "main" {
+		t.Errorf("Unexpected record after reopen: %+v", records[0])
+	}
+}
+
+func TestRegistryRollsBackFailedSaves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	registry, err := OpenRegistry(path)
+	if err != nil {
+		t.Fatalf("OpenRegistry failed: %v", err)
+	}
+	record, err := registry.Add(RepoRecord{Name: "demo", Repo: core.Repo{Path: "/test/demo"}})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// A directory in place of the file makes every save fail
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatalf("Mkdir failed: %v", err)
+	}
+
+	if _, err := registry.Add(RepoRecord{Repo: core.Repo{Path: "/test/other"}}); err == nil {
+		t.Error("Expected Add to fail")
+	}
+	if _, err := registry.Update(record.ID, func(r *RepoRecord) { r.Name = "renamed" }); err == nil {
+		t.Error("Expected Update to fail")
+	}
+	if _, err := registry.Remove(record.ID); err == nil {
+		t.Error("Expected Remove to fail")
+	}
+
+	records := registry.List()
+	if len(records) != 1 || records[0].ID != record.ID || records[0].Name != "demo" {
+		t.Errorf("Expected the registry to be unchanged, got %+v", records)
+	}
+}
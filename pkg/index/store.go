@@ -0,0 +1,280 @@
+package index
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/filelock"
+)
+
+// Store persists encoded cache entries by repository path and key. Stores
+// are safe for concurrent use.
+type Store interface {
+	// Get returns the data stored for key, reporting whether it was found
+	Get(repoPath, key string) ([]byte, bool, error)
+	// Put stores data for key, replacing any previous data
+	Put(repoPath, key string, data []byte) error
+	// Touch records that key was used, for least recently used eviction
+	Touch(repoPath, key string) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(repoPath, key string) error
+	// Clear removes all keys of a repository
+	Clear(repoPath string) error
+	// ClearAll removes all keys
+	ClearAll() error
+	// Entries lists the stored keys
+	Entries() ([]StoreEntry, error)
+}
+
+// StoreEntry describes a key held by a Store
+type StoreEntry struct {
+	RepoPath string
+	Key      string
+	Size     int64     // Bytes used by the entry
+	Accessed time.Time // Last Put or Touch
+}
+
+// repoPathFile records the repository path in a FileStore directory
+const repoPathFile = "repo"
+
+// fileStoreLock is the lock file coordinating the processes sharing a FileStore
+const fileStoreLock = ".lock"
+
+// repoDirPattern matches the names of FileStore directories
+var repoDirPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// FileStore stores each entry in its own file, in a directory per repository.
+// The modification time of a file is the last time its entry was accessed.
+// Files are replaced atomically, so readers and a crash leave either the old
+// or the new entry, and processes sharing the directory serialize changes
+// with an advisory lock on its .lock file.
+type FileStore struct {
+	basePath string
+}
+
+// NewFileStore creates a file store in the directory at basePath.
+// Directories left by earlier versions, which do not record the path of
+// their repository and thus cannot be maintained, are removed.
+func NewFileStore(basePath string) (*FileStore, error) {
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	s := &FileStore{basePath: basePath}
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	s.removeLegacyDirs()
+	return s, nil
+}
+
+// lock takes the cross-process lock of the store
+func (s *FileStore) lock() (func(), error) {
+	return filelock.Lock(filepath.Join(s.basePath, fileStoreLock))
+}
+
+// writeFileAtomic replaces the file at path with data through a synced
+// temporary file in the same directory
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// removeLegacyDirs removes the repository directories without a
+// repoPathFile. Directories modified in the last minute are kept, in case a
+// process not taking the lock is writing to them.
+func (s *FileStore) removeLegacyDirs() {
+	dirs, err := os.ReadDir(s.basePath)
+	if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || !repoDirPattern.MatchString(dir.Name()) {
+			continue
+		}
+		path := filepath.Join(s.basePath, dir.Name())
+		if _, err := os.Stat(filepath.Join(path, repoPathFile)); !os.IsNotExist(err) {
+			continue
+		}
+		if info, err := dir.Info(); err == nil && time.Since(info.ModTime()) > time.Minute {
+			_ = os.RemoveAll(path)
+		}
+	}
+}
+
+// repoHash generates a unique hash for a repository path
+func repoHash(repoPath string) string {
+	hash := sha256.Sum256([]byte(repoPath))
+	return fmt.Sprintf("%x", hash)
+}
+
+// repoDir returns the directory holding the entries of a repository
+func (s *FileStore) repoDir(repoPath string) string {
+	return filepath.Join(s.basePath, repoHash(repoPath))
+}
+
+// entryFile returns the file holding an entry
+func (s *FileStore) entryFile(repoPath, key string) string {
+	return filepath.Join(s.repoDir(repoPath), key+".json")
+}
+
+// Get reads the file of key
+func (s *FileStore) Get(repoPath, key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(s.entryFile(repoPath, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to read cache file: %w", err)
+	}
+	return data, true, nil
+}
+
+// Put replaces the file of key
+func (s *FileStore) Put(repoPath, key string, data []byte) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dir := s.repoDir(repoPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	pathFile := filepath.Join(dir, repoPathFile)
+	if _, err := os.Stat(pathFile); os.IsNotExist(err) {
+		if err := writeFileAtomic(pathFile, []byte(repoPath)); err != nil {
+			return fmt.Errorf("failed to write cache file: %w", err)
+		}
+	}
+	if err := writeFileAtomic(filepath.Join(dir, key+".json"), data); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
+
+// Touch sets the modification time of the file of key
+func (s *FileStore) Touch(repoPath, key string) error {
+	now := time.Now()
+	err := os.Chtimes(s.entryFile(repoPath, key), now, now)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to touch cache file: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the file of key
+func (s *FileStore) Delete(repoPath, key string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = os.Remove(s.entryFile(repoPath, key))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete cache file: %w", err)
+	}
+	return nil
+}
+
+// Clear removes the directory of a repository
+func (s *FileStore) Clear(repoPath string) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.RemoveAll(s.repoDir(repoPath)); err != nil {
+		return fmt.Errorf("failed to clear cache directory: %w", err)
+	}
+	return nil
+}
+
+// ClearAll removes the directories of all repositories, leaving other files
+// in the base directory alone
+func (s *FileStore) ClearAll() error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dirs, err := os.ReadDir(s.basePath)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+	for _, dir := range dirs {
+		if dir.IsDir() && repoDirPattern.MatchString(dir.Name()) {
+			if err := os.RemoveAll(filepath.Join(s.basePath, dir.Name())); err != nil {
+				return fmt.Errorf("failed to clear cache directory: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Entries lists the entry files of all repository directories
+func (s *FileStore) Entries() ([]StoreEntry, error) {
+	dirs, err := os.ReadDir(s.basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var entries []StoreEntry
+	for _, dir := range dirs {
+		if !dir.IsDir() || !repoDirPattern.MatchString(dir.Name()) {
+			continue
+		}
+		path := filepath.Join(s.basePath, dir.Name())
+		repoPath, err := os.ReadFile(filepath.Join(path, repoPathFile))
+		if err != nil {
+			continue // Removed concurrently, or not written yet
+		}
+		files, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			key, ok := strings.CutSuffix(file.Name(), ".json")
+			if !ok || file.IsDir() {
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
+			entries = append(entries, StoreEntry{
+				RepoPath: string(repoPath),
+				Key:      key,
+				Size:     info.Size(),
+				Accessed: info.ModTime(),
+			})
+		}
+	}
+	return entries, nil
+}
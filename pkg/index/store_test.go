@@ -0,0 +1,358 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"file": func(t *testing.T) Store {
+			store, err := NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("NewFileStore failed: %v", err)
+			}
+			return store
+		},
+		"log": func(t *testing.T) Store {
+			store, err := OpenLogStore(filepath.Join(t.TempDir(), "cache.log"))
+			if err != nil {
+				t.Fatalf("OpenLogStore failed: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+		"memory": func(t *testing.T) Store {
+			return NewLRUStore(nil, 10, 0)
+		},
+		"memory tier": func(t *testing.T) Store {
+			next, err := NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("NewFileStore failed: %v", err)
+			}
+			return NewLRUStore(next, 10, 0)
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			expect := func(repo, key, want string) {
+				t.Helper()
+				data, found, err := store.Get(repo, key)
+				if err != nil {
+					t.Fatalf("Get failed: %v", err)
+				}
+				if found != (want != "") || string(data) != want {
+					t.Errorf("Expected %s/%s to be %q, got %q (found %v)", repo, key, want, data, found)
+				}
+			}
+
+			for _, entry := range [][3]string{{"/a", "status", "1"}, {"/a", "remotes", "2"}, {"/b", "status", "3"}, {"/a", "status", "4"}} {
+				if err := store.Put(entry[0], entry[1], []byte(entry[2])); err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+			expect("/a", "status", "4")
+			expect("/a", "remotes", "2")
+			expect("/b", "status", "3")
+			expect("/b", "remotes", "")
+
+			if err := store.Delete("/a", "remotes"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if err := store.Delete("/a", "missing"); err != nil {
+				t.Fatalf("Delete of a missing key failed: %v", err)
+			}
+			expect("/a", "remotes", "")
+			expect("/a", "status", "4")
+
+			if err := store.Clear("/a"); err != nil {
+				t.Fatalf("Clear failed: %v", err)
+			}
+			expect("/a", "status", "")
+			expect("/b", "status", "3")
+
+			if err := store.Touch("/b", "status"); err != nil {
+				t.Fatalf("Touch failed: %v", err)
+			}
+			entries, err := store.Entries()
+			if err != nil {
+				t.Fatalf("Entries failed: %v", err)
+			}
+			if len(entries) != 1 || entries[0].RepoPath != "/b" || entries[0].Key != "status" || entries[0].Size == 0 {
+				t.Errorf("Expected the entry of /b, got %+v", entries)
+			}
+
+			if err := store.ClearAll(); err != nil {
+				t.Fatalf("ClearAll failed: %v", err)
+			}
+			expect("/b", "status", "")
+		})
+	}
+}
+
+func TestLRUStoreEviction(t *testing.T) {
+	store := NewLRUStore(nil, 2, 0)
+	_ = store.Put("/repo", "a", []byte("1"))
+	_ = store.Put("/repo", "b", []byte("2"))
+	_, _, _ = store.Get("/repo", "a") // b is now the least recently used
+	_ = store.Put("/repo", "c", []byte("3"))
+
+	if store.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", store.Len())
+	}
+	if _, found, _ := store.Get("/repo", "b"); found {
+		t.Error("Expected b to be evicted")
+	}
+	if _, found, _ := store.Get("/repo", "a"); !found {
+		t.Error("Expected a to be kept")
+	}
+
+	// Entries are bounded by size too, counting repository path and key
+	store = NewLRUStore(nil, 0, 20)
+	_ = store.Put("/repo", "a", []byte("0123456789"))
+	_ = store.Put("/repo", "b", []byte("0123456789"))
+	if store.Len() != 1 {
+		t.Errorf("Expected 1 entry within 20 bytes, got %d", store.Len())
+	}
+	_ = store.Put("/repo", "c", []byte(strings.Repeat("x", 30)))
+	if _, found, _ := store.Get("/repo", "c"); found {
+		t.Error("Expected an entry larger than the limit not to be kept")
+	}
+}
+
+func TestLRUStoreReadsThrough(t *testing.T) {
+	next, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+	_ = next.Put("/repo", "status", []byte("on disk"))
+
+	store := NewLRUStore(next, 10, 0)
+	data, found, err := store.Get("/repo", "status")
+	if err != nil || !found || string(data) != "on disk" {
+		t.Fatalf("Expected the entry of the next store, got %q (found %v, err %v)", data, found, err)
+	}
+	if store.Len() != 1 {
+		t.Errorf("Expected the entry to be kept in memory, got %d entries", store.Len())
+	}
+
+	// Deleting through the tier removes the entry from both
+	_ = store.Delete("/repo", "status")
+	if _, found, _ := next.Get("/repo", "status"); found {
+		t.Error("Expected the entry to be deleted from the next store")
+	}
+}
+
+func TestLogStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	store, err := OpenLogStore(path)
+	if err != nil {
+		t.Fatalf("OpenLogStore failed: %v", err)
+	}
+	_ = store.Put("/a", "status", []byte("1"))
+	_ = store.Put("/a", "remotes", []byte("2"))
+	_ = store.Put("/b", "status", []byte("3"))
+	_ = store.Delete("/a", "remotes")
+	_ = store.Clear("/b")
+	store.Close()
+
+	// A record cut short by an interrupted write is dropped
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	_, _ = file.WriteString(`{"op":"put","repo":"/c","key":"status","da`)
+	file.Close()
+
+	store, err = OpenLogStore(path)
+	if err != nil {
+		t.Fatalf("Reopening failed: %v", err)
+	}
+	defer store.Close()
+
+	for _, tc := range []struct {
+		repo, key, want string
+	}{
+		{"/a", "status", "1"},
+		{"/a", "remotes", ""},
+		{"/b", "status", ""},
+		{"/c", "status", ""},
+	} {
+		data, _, err := store.Get(tc.repo, tc.key)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if string(data) != tc.want {
+			t.Errorf("Expected %s/%s to be %q after reopening, got %q", tc.repo, tc.key, tc.want, data)
+		}
+	}
+
+	if err := store.Put("/c", "status", []byte("4")); err != nil {
+		t.Fatalf("Put after truncation failed: %v", err)
+	}
+	if data, _, _ := store.Get("/c", "status"); string(data) != "4" {
+		t.Errorf("Expected 4, got %q", data)
+	}
+}
+
+func TestLogStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	store, err := OpenLogStore(path)
+	if err != nil {
+		t.Fatalf("OpenLogStore failed: %v", err)
+	}
+	defer store.Close()
+	store.compactSize = 1024
+
+	value := []byte(strings.Repeat("x", 100))
+	for i := 0; i < 100; i++ {
+		if err := store.Put("/repo", "status", value); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	_ = store.Put("/repo", "remotes", []byte("kept"))
+
+	if size := store.Size(); size > 2*store.compactSize {
+		t.Errorf("Expected the log to be compacted, got %d bytes", size)
+	}
+	if data, _, _ := store.Get("/repo", "status"); string(data) != string(value) {
+		t.Errorf("Expected the last value after compaction, got %q", data)
+	}
+
+	if err := store.Compact(); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat log: %v", err)
+	}
+	if info.Size() != store.Size() {
+		t.Errorf("Expected file size %d, got %d", store.Size(), info.Size())
+	}
+	if data, _, _ := store.Get("/repo", "remotes"); string(data) != "kept" {
+		t.Errorf("Expected kept, got %q", data)
+	}
+}
+
+func TestDefaultCacheDir(t *testing.T) {
+	cacheHome := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheHome)
+	dir, err := DefaultCacheDir()
+	if err != nil {
+		t.Fatalf("DefaultCacheDir failed: %v", err)
+	}
+	if dir != filepath.Join(cacheHome, "gitmgr") {
+		t.Errorf("Expected the XDG cache directory, got %s", dir)
+	}
+
+	t.Setenv("XDG_CACHE_HOME", "")
+	dir, err = DefaultCacheDir()
+	if err != nil {
+		t.Fatalf("DefaultCacheDir failed: %v", err)
+	}
+	if filepath.Base(dir) != "cache" || filepath.Base(filepath.Dir(dir)) != ".gitmgr" {
+		t.Errorf("Expected ~/.gitmgr/cache, got %s", dir)
+	}
+}
+
+func TestCacheLogStore(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := OpenCache(dir, WithLogStore(), WithMemoryLimits(0, 0))
+	if err != nil {
+		t.Fatalf("OpenCache failed: %v", err)
+	}
+	if err := cache.Set("/repo", "key", "value", CommitsTTL); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	var value string
+	if found, err := cache.Get("/repo", "key", &value); err != nil || !found || value != "value" {
+		t.Errorf("Expected value, got %q (found %v, err %v)", value, found, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cache.log")); err != nil {
+		t.Errorf("Expected entries in cache.log: %v", err)
+	}
+}
+
+func TestStoresSharedBetweenProcesses(t *testing.T) {
+	// Two stores on the same files stand in for two processes: their file
+	// locks exclude each other like those of separate processes
+	dir := t.TempDir()
+	stores := map[string]func(t *testing.T) Store{
+		"file": func(t *testing.T) Store {
+			store, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatalf("NewFileStore failed: %v", err)
+			}
+			return store
+		},
+		"log": func(t *testing.T) Store {
+			store, err := OpenLogStore(filepath.Join(dir, "cache.log"))
+			if err != nil {
+				t.Fatalf("OpenLogStore failed: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			a, b := newStore(t), newStore(t)
+
+			var wg sync.WaitGroup
+			for i, store := range []Store{a, b} {
+				wg.Add(1)
+				go func(i int, store Store) {
+					defer wg.Done()
+					for j := 0; j < 50; j++ {
+						key := fmt.Sprintf("key-%d-%d", i, j)
+						if err := store.Put("/repo", key, []byte(key)); err != nil {
+							t.Errorf("Put failed: %v", err)
+						}
+					}
+				}(i, store)
+			}
+			wg.Wait()
+
+			for _, store := range []Store{a, b} {
+				entries, err := store.Entries()
+				if err != nil {
+					t.Fatalf("Entries failed: %v", err)
+				}
+				if len(entries) != 100 {
+					t.Errorf("Expected the 100 entries written by both stores, got %d", len(entries))
+				}
+			}
+			if data, _, _ := a.Get("/repo", "key-1-49"); string(data) != "key-1-49" {
+				t.Errorf("Expected an entry written by the other store, got %q", data)
+			}
+
+			if log, ok := b.(*LogStore); ok {
+				if err := log.Compact(); err != nil {
+					t.Fatalf("Compact failed: %v", err)
+				}
+				if data, _, _ := a.Get("/repo", "key-0-0"); string(data) != "key-0-0" {
+					t.Errorf("Expected entries to survive a compaction by the other store, got %q", data)
+				}
+			}
+
+			if err := a.ClearAll(); err != nil {
+				t.Fatalf("ClearAll failed: %v", err)
+			}
+			if _, found, _ := b.Get("/repo", "key-0-0"); found {
+				t.Error("Expected entries cleared by the other store to be gone")
+			}
+
+			tmp, _ := filepath.Glob(filepath.Join(dir, "*", "*.tmp"))
+			if len(tmp) != 0 {
+				t.Errorf("Expected no temporary files, got %v", tmp)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// State represents the lifecycle state of a job
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCanceled  State = "canceled"
+)
+
+// Done reports whether the state is final
+func (s State) Done() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCanceled
+}
+
+// maxLogLines bounds the number of log lines kept per job
+const maxLogLines = 500
+
+// ErrNotFound is returned for unknown or expired job IDs
+var ErrNotFound = errors.New("job not found")
+
+// ErrFinished is returned when canceling a job that already finished
+var ErrFinished = errors.New("job already finished")
+
+// Job is a point-in-time view of an asynchronous operation
+type Job struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	RepoID     string      `json:"repoId,omitempty"`
+	State      State       `json:"state"`
+	Progress   int         `json:"progress"`
+	Phase      string      `json:"phase,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	ErrorCode  string      `json:"errorCode,omitempty"`
+	ErrorHint  interface{} `json:"errorHint,omitempty"`
+	Logs       []string    `json:"logs,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	StartedAt  *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt *time.Time  `json:"finishedAt,omitempty"`
+}
+
+// Func is the work performed by a job
+type Func func(ctx context.Context, task *Task) (interface{}, error)
+
+// Task is the handle a running job uses to report progress and logs
+type Task struct {
+	mu     sync.Mutex
+	job    Job
+	cancel context.CancelFunc
+}
+
+// SetProgress updates the job progress percentage and phase description
+func (t *Task) SetProgress(percent int, phase string) {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+
+	t.mu.Lock()
+	t.job.Progress = percent
+	t.job.Phase = phase
+	t.mu.Unlock()
+}
+
+// SetErrorCode records a machine-readable code describing why the job failed
+func (t *Task) SetErrorCode(code string) {
+	t.mu.Lock()
+	t.job.ErrorCode = code
+	t.mu.Unlock()
+}
+
+// SetErrorHint records guidance for resolving the failure, such as an authentication hint
+func (t *Task) SetErrorHint(hint interface{}) {
+	t.mu.Lock()
+	t.job.ErrorHint = hint
+	t.mu.Unlock()
+}
+
+// Logf appends a line to the job log
+func (t *Task) Logf(format string, args ...interface{}) {
+	t.appendLog(fmt.Sprintf(format, args...))
+}
+
+// gitProgressPattern matches git progress lines such as "Receiving objects:  45% (450/1000)"
+var gitProgressPattern = regexp.MustCompile(`^(?:remote: )?([A-Za-z ]+):\s+(\d{1,3})%`)
+
+// Write implements io.Writer so a task can receive streamed git output.
+// Each call is treated as one line; git progress lines update the progress
+// instead of being logged, so the log is not flooded with percentages.
+func (t *Task) Write(p []byte) (int, error) {
+	line := string(p)
+	if match := gitProgressPattern.FindStringSubmatch(line); match != nil {
+		percent, _ := strconv.Atoi(match[2])
+		t.SetProgress(percent, match[1])
+		return len(p), nil
+	}
+
+	t.appendLog(line)
+	return len(p), nil
+}
+
+func (t *Task) appendLog(line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.job.Logs = append(t.job.Logs, line)
+	if len(t.job.Logs) > maxLogLines {
+		t.job.Logs = t.job.Logs[len(t.job.Logs)-maxLogLines:]
+	}
+}
+
+// snapshot returns a copy of the job that is safe to hand out
+func (t *Task) snapshot() Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job := t.job
+	job.Logs = append([]string(nil), t.job.Logs...)
+	return job
+}
+
+// Manager runs jobs in the background and keeps finished jobs for a retention window
+type Manager struct {
+	ctx       context.Context
+	stop      context.CancelFunc
+	retention time.Duration
+	mu        sync.Mutex
+	tasks     map[string]*Task
+	wg        sync.WaitGroup
+	observers []func(Job)
+}
+
+// NewManager creates a job manager that keeps finished jobs for retention
+func NewManager(retention time.Duration) *Manager {
+	ctx, stop := context.WithCancel(context.Background())
+	return &Manager{
+		ctx:       ctx,
+		stop:      stop,
+		retention: retention,
+		tasks:     make(map[string]*Task),
+	}
+}
+
+// Observe registers fn to be called when a job starts running and when it finishes.
+// Observers must be registered before jobs are submitted.
+func (m *Manager) Observe(fn func(Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observers = append(m.observers, fn)
+}
+
+// notify passes a snapshot of task to all observers
+func (m *Manager) notify(task *Task) {
+	m.mu.Lock()
+	observers := m.observers
+	m.mu.Unlock()
+
+	if len(observers) == 0 {
+		return
+	}
+	job := task.snapshot()
+	for _, fn := range observers {
+		fn(job)
+	}
+}
+
+// Submit starts fn in the background and returns the queued job.
+// The job context is canceled after timeout, on Cancel, or on Close.
+func (m *Manager) Submit(kind, repoID string, timeout time.Duration, fn Func) Job {
+	ctx, cancel := context.WithTimeout(m.ctx, timeout)
+
+	task := &Task{
+		job: Job{
+			ID:        newID(),
+			Kind:      kind,
+			RepoID:    repoID,
+			State:     StateQueued,
+			CreatedAt: time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+
+	m.mu.Lock()
+	m.pruneLocked()
+	m.tasks[task.job.ID] = task
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go m.run(ctx, task, fn)
+
+	return task.snapshot()
+}
+
+// run executes a job and records its outcome
+func (m *Manager) run(ctx context.Context, task *Task, fn Func) {
+	defer m.wg.Done()
+	defer task.cancel()
+
+	task.mu.Lock()
+	if ctx.Err() != nil {
+		// Canceled before it got a chance to start
+		task.mu.Unlock()
+		m.finish(ctx, task, nil, ctx.Err())
+		m.notify(task)
+		return
+	}
+	started := time.Now().UTC()
+	task.job.State = StateRunning
+	task.job.StartedAt = &started
+	task.mu.Unlock()
+	m.notify(task)
+
+	result, err := fn(ctx, task)
+	m.finish(ctx, task, result, err)
+	m.notify(task)
+}
+
+// finish records the final state of a job
+func (m *Manager) finish(ctx context.Context, task *Task, result interface{}, err error) {
+	task.mu.Lock()
+	defer task.mu.Unlock()
+
+	finished := time.Now().UTC()
+	task.job.FinishedAt = &finished
+
+	switch {
+	case err == nil:
+		task.job.State = StateSucceeded
+		task.job.Progress = 100
+		task.job.Result = result
+	case errors.Is(ctx.Err(), context.Canceled):
+		task.job.State = StateCanceled
+		task.job.Error = "job canceled"
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		task.job.State = StateFailed
+		task.job.Error = fmt.Sprintf("job timed out: %v", err)
+	default:
+		task.job.State = StateFailed
+		task.job.Error = err.Error()
+	}
+}
+
+// Get returns the job with the given ID
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	m.pruneLocked()
+	task, ok := m.tasks[id]
+	m.mu.Unlock()
+
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return task.snapshot(), nil
+}
+
+// List returns all known jobs, newest first
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	m.pruneLocked()
+	tasks := make([]*Task, 0, len(m.tasks))
+	for _, task := range m.tasks {
+		tasks = append(tasks, task)
+	}
+	m.mu.Unlock()
+
+	jobs := make([]Job, 0, len(tasks))
+	for _, task := range tasks {
+		job := task.snapshot()
+		// Logs are only returned for single job lookups
+		job.Logs = nil
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	return jobs
+}
+
+// Active returns the number of queued and running jobs
+func (m *Manager) Active() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	active := 0
+	for _, task := range m.tasks {
+		if !task.snapshot().State.Done() {
+			active++
+		}
+	}
+	return active
+}
+
+// Cancel cancels a queued or running job
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	task, ok := m.tasks[id]
+	m.mu.Unlock()
+
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+
+	job := task.snapshot()
+	if job.State.Done() {
+		return job, ErrFinished
+	}
+
+	task.cancel()
+	return task.snapshot(), nil
+}
+
+// Close cancels all running jobs and waits for them to finish
+func (m *Manager) Close() {
+	m.stop()
+	m.wg.Wait()
+}
+
+// pruneLocked drops finished jobs older than the retention window; callers must hold m.mu
+func (m *Manager) pruneLocked() {
+	cutoff := time.Now().Add(-m.retention)
+	for id, task := range m.tasks {
+		job := task.snapshot()
+		if job.State.Done() && job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(m.tasks, id)
+		}
+	}
+}
+
+// newID generates a random job identifier
+func newID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitDone polls until the job reaches a final state
+func waitDone(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if job.State.Done() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestSubmitSucceeded(t *testing.T) {
+	m := NewManager(time.Minute)
+	defer m.Close()
+
+	job := m.Submit("fetch", "repo1", time.Minute, func(ctx context.Context, task *Task) (interface{}, error) {
+		task.Logf("fetching %s", "origin")
+		return "ok", nil
+	})
+	if job.ID == "" {
+		t.Fatal("Expected job ID")
+	}
+
+	done := waitDone(t, m, job.ID)
+	if done.State != StateSucceeded {
+		t.Errorf("Expected state %s, got %s", StateSucceeded, done.State)
+	}
+	if done.Result != "ok" {
+		t.Errorf("Expected result 'ok', got %v", done.Result)
+	}
+	if done.Progress != 100 {
+		t.Errorf("Expected progress 100, got %d", done.Progress)
+	}
+	if len(done.Logs) != 1 || done.Logs[0] != "fetching origin" {
+		t.Errorf("Unexpected logs: %v", done.Logs)
+	}
+}
+
+func TestSubmitFailed(t *testing.T) {
+	m := NewManager(time.Minute)
+	defer m.Close()
+
+	job := m.Submit("push", "", time.Minute, func(ctx context.Context, task *Task) (interface{}, error) {
+		return nil, errors.New("push rejected")
+	})
+
+	done := waitDone(t, m, job.ID)
+	if done.State != StateFailed {
+		t.Errorf("Expected state %s, got %s", StateFailed, done.State)
+	}
+	if done.Error != "push rejected" {
+		t.Errorf("Expected error 'push rejected', got %q", done.Error)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	m := NewManager(time.Minute)
+	defer m.Close()
+
+	started := make(chan struct{})
+	job := m.Submit("clone", "", time.Minute, func(ctx context.Context, task *Task) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	<-started
+	if active := m.Active(); active != 1 {
+		t.Errorf("Expected 1 active job, got %d", active)
+	}
+
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+
+	done := waitDone(t, m, job.ID)
+	if done.State != StateCanceled {
+		t.Errorf("Expected state %s, got %s", StateCanceled, done.State)
+	}
+	if active := m.Active(); active != 0 {
+		t.Errorf("Expected no active jobs, got %d", active)
+	}
+
+	if _, err := m.Cancel(job.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("Expected ErrFinished, got %v", err)
+	}
+	if _, err := m.Cancel("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTaskWriteProgress(t *testing.T) {
+	task := &Task{}
+
+	_, _ = task.Write([]byte("Cloning into 'repo'..."))
+	_, _ = task.Write([]byte("Receiving objects:  45% (450/1000)"))
+
+	job := task.snapshot()
+	if job.Progress != 45 {
+		t.Errorf("Expected progress 45, got %d", job.Progress)
+	}
+	if job.Phase != "Receiving objects" {
+		t.Errorf("Expected phase 'Receiving objects', got %q", job.Phase)
+	}
+	if len(job.Logs) != 1 {
+		t.Errorf("Expected progress lines to be kept out of logs, got %v", job.Logs)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	m := NewManager(50 * time.Millisecond)
+	defer m.Close()
+
+	job := m.Submit("gc", "", time.Minute, func(ctx context.Context, task *Task) (interface{}, error) {
+		return nil, nil
+	})
+	waitDone(t, m, job.ID)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := m.Get(job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected expired job to be pruned, got %v", err)
+	}
+}
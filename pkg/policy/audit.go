@@ -0,0 +1,60 @@
+package policy
+
+import (
+	"time"
+
+	"github.com/felipemacedo1/go-coregit-pe/internal/logging"
+)
+
+// Record describes a raw git invocation and the policy decision about it
+type Record struct {
+	Time      time.Time     `json:"time"`
+	RequestID string        `json:"requestId,omitempty"` // See logging.WithRequestID
+	Caller    string        `json:"caller"`
+	Profile   string        `json:"profile,omitempty"`
+	Repo      string        `json:"repo"`
+	Args      []string      `json:"args"`
+	Allowed   bool          `json:"allowed"`
+	Reason    string        `json:"reason,omitempty"` // Why it was denied or failed to run
+	ExitCode  int           `json:"exitCode"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// Auditor receives a record of every raw git invocation
+type Auditor interface {
+	Audit(record Record)
+}
+
+// LogAuditor writes audit records to a logger
+type LogAuditor struct {
+	Logger *logging.Logger
+}
+
+// NewLogAuditor creates an auditor writing to logger
+func NewLogAuditor(logger *logging.Logger) *LogAuditor {
+	return &LogAuditor{Logger: logger}
+}
+
+// Audit implements Auditor. Denied invocations are logged as warnings.
+func (a *LogAuditor) Audit(record Record) {
+	fields := map[string]interface{}{
+		"caller":   record.Caller,
+		"profile":  record.Profile,
+		"repo":     record.Repo,
+		"args":     record.Args,
+		"allowed":  record.Allowed,
+		"exitCode": record.ExitCode,
+		"duration": record.Duration.String(),
+	}
+	if record.Reason != "" {
+		fields["reason"] = record.Reason
+	}
+	if record.RequestID != "" {
+		fields["requestId"] = record.RequestID
+	}
+	if !record.Allowed {
+		a.Logger.Warn("Raw command denied", fields)
+		return
+	}
+	a.Logger.Info("Raw command executed", fields)
+}
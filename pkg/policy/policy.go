@@ -0,0 +1,291 @@
+package policy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+// ReadOnlyProfile is the built-in profile allowing only commands that do not
+// modify repositories. It is the default for callers without a profile.
+const ReadOnlyProfile = "read-only"
+
+// DefaultForbiddenOptions are rejected in every profile because they let a
+// command run programs, write arbitrary files or escape the repository.
+// Git accepts unambiguous abbreviations of long options, so abbreviations of
+// these are rejected too.
+var DefaultForbiddenOptions = []string{
+	"-c",
+	"--config",
+	"--config-env",
+	"--exec",
+	"--exec-path",
+	"--upload-pack",
+	"--receive-pack",
+	"--output",
+	"--open-files-in-pager",
+	"-O",
+	"--template",
+	"--git-dir",
+	"--work-tree",
+	"--separate-git-dir",
+	"--no-index",
+}
+
+// DefaultForbiddenSubcommandOptions are rejected in every profile for the
+// given subcommands, because they make it read any file, e.g.
+// "blame --contents /etc/shadow". The same letters mean other things
+// elsewhere, such as the pickaxe of log -S.
+var DefaultForbiddenSubcommandOptions = map[string][]string{
+	"blame":    {"--contents", "-S", "--ignore-revs-file"},
+	"grep":     {"-f", "--file"},
+	"ls-files": {"-X", "--exclude-from"},
+}
+
+// pathOperandSubcommands read files outside the repository when given such
+// paths as operands: diff falls back to --no-index for them on its own
+var pathOperandSubcommands = map[string]bool{
+	"diff": true,
+}
+
+// Profile describes which raw git commands a caller may run
+type Profile struct {
+	// Subcommands that may be run; "*" allows any subcommand
+	Subcommands []string `json:"subcommands"`
+	// ReadOnly additionally rejects commands that modify the repository
+	ReadOnly bool `json:"readOnly"`
+	// ForbiddenOptions are rejected in addition to DefaultForbiddenOptions
+	ForbiddenOptions []string `json:"forbiddenOptions,omitempty"`
+}
+
+// Caller binds a bearer token to a profile
+type Caller struct {
+	Token   string `json:"token"`
+	Profile string `json:"profile"`
+}
+
+// Policy assigns profiles to callers
+type Policy struct {
+	// Default is the profile of callers that are not listed
+	Default  string              `json:"default"`
+	Profiles map[string]*Profile `json:"profiles,omitempty"`
+	Callers  map[string]*Caller  `json:"callers,omitempty"`
+}
+
+// Default returns a policy applying the read-only profile to every caller
+func Default() *Policy {
+	return &Policy{Default: ReadOnlyProfile}
+}
+
+// Load reads a policy from a JSON file
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if p.Default == "" {
+		p.Default = ReadOnlyProfile
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks that every referenced profile exists and tokens are unique
+func (p *Policy) Validate() error {
+	if _, ok := p.profile(p.Default); !ok {
+		return fmt.Errorf("unknown default profile: %s", p.Default)
+	}
+
+	tokens := make(map[string]string)
+	for name, caller := range p.Callers {
+		if caller == nil || caller.Token == "" {
+			return fmt.Errorf("caller %s has no token", name)
+		}
+		if other, ok := tokens[caller.Token]; ok {
+			return fmt.Errorf("callers %s and %s share a token", other, name)
+		}
+		tokens[caller.Token] = name
+		if _, ok := p.profile(caller.Profile); !ok {
+			return fmt.Errorf("unknown profile %s for caller %s", caller.Profile, name)
+		}
+	}
+	return nil
+}
+
+// Authenticate returns the caller owning token
+func (p *Policy) Authenticate(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	for name, caller := range p.Callers {
+		if caller != nil && subtle.ConstantTimeCompare([]byte(caller.Token), []byte(token)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// ProfileFor returns the name and profile applied to caller
+func (p *Policy) ProfileFor(caller string) (string, *Profile) {
+	name := p.Default
+	if c, ok := p.Callers[caller]; ok && c != nil {
+		name = c.Profile
+	}
+	profile, ok := p.profile(name)
+	if !ok {
+		// Validate rejects unknown profiles; deny everything if it was skipped
+		return name, &Profile{}
+	}
+	return name, profile
+}
+
+// profile looks up a configured or built-in profile
+func (p *Policy) profile(name string) (*Profile, bool) {
+	if profile, ok := p.Profiles[name]; ok && profile != nil {
+		return profile, true
+	}
+	if name == ReadOnlyProfile {
+		return &Profile{Subcommands: []string{"*"}, ReadOnly: true}, true
+	}
+	return nil, false
+}
+
+// Check returns the name of the profile applied to caller and a
+// core.ErrPolicyDenied error if that profile does not allow args
+func (p *Policy) Check(caller string, args []string) (string, error) {
+	name, profile := p.ProfileFor(caller)
+	if err := profile.Check(args); err != nil {
+		return name, err
+	}
+	return name, nil
+}
+
+// subcommandPattern matches git subcommand names
+var subcommandPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Check returns a core.ErrPolicyDenied error if the profile does not allow
+// running git with args
+func (pr *Profile) Check(args []string) error {
+	if len(args) == 0 {
+		return denied("no subcommand given")
+	}
+
+	subcommand := args[0]
+	if !subcommandPattern.MatchString(subcommand) {
+		// Global options such as -c or -C come before the subcommand
+		return denied(fmt.Sprintf("global option %q is not allowed; the first argument must be a subcommand", subcommand))
+	}
+	if !pr.allows(subcommand) {
+		return denied(fmt.Sprintf("subcommand %q is not allowed", subcommand))
+	}
+
+	forbidden := append(append([]string{}, DefaultForbiddenOptions...), pr.ForbiddenOptions...)
+	forbidden = append(forbidden, DefaultForbiddenSubcommandOptions[subcommand]...)
+	for _, arg := range options(args[1:]) {
+		for _, opt := range forbidden {
+			if matchOption(arg, opt) {
+				return denied(fmt.Sprintf("option %q is not allowed", arg))
+			}
+		}
+	}
+
+	if pathOperandSubcommands[subcommand] {
+		for _, operand := range positional(args[1:]) {
+			if escapesRepository(operand) {
+				return denied(fmt.Sprintf("path %q outside the repository is not allowed", operand))
+			}
+		}
+	}
+
+	if pr.ReadOnly && !readOnly(subcommand, args[1:]) {
+		return denied(fmt.Sprintf("%q modifies the repository and the profile is read-only", strings.Join(args, " ")))
+	}
+	return nil
+}
+
+// escapesRepository reports whether operand is an absolute path or has a
+// ".." component. Revision ranges such as main..feature have none.
+func escapesRepository(operand string) bool {
+	if filepath.IsAbs(operand) || strings.HasPrefix(operand, "/") {
+		return true
+	}
+	for _, part := range strings.FieldsFunc(operand, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether subcommand is listed in the profile
+func (pr *Profile) allows(subcommand string) bool {
+	for _, allowed := range pr.Subcommands {
+		if allowed == "*" || allowed == subcommand {
+			return true
+		}
+	}
+	return false
+}
+
+// options returns the arguments before "--" that look like options
+func options(args []string) []string {
+	var opts []string
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			opts = append(opts, arg)
+		}
+	}
+	return opts
+}
+
+// matchOption reports whether arg sets opt. Long options match when the name
+// in arg is opt or an abbreviation of it; short options match anywhere in a
+// cluster of single-letter flags such as "-qc".
+func matchOption(arg, opt string) bool {
+	if strings.HasPrefix(opt, "--") {
+		if !strings.HasPrefix(arg, "--") {
+			return false
+		}
+		name, _, _ := strings.Cut(arg, "=")
+		return len(name) > 2 && strings.HasPrefix(opt, name)
+	}
+
+	if strings.HasPrefix(arg, "--") || len(opt) != 2 {
+		return false
+	}
+	for _, r := range arg[1:] {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+			// The rest of the cluster is the value of an option
+			return false
+		}
+		if byte(r) == opt[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// denied returns a policy error
+func denied(reason string) error {
+	return &core.GitError{
+		Op:      "raw",
+		Kind:    core.ErrPolicyDenied,
+		Message: "command not allowed by policy: " + reason,
+	}
+}
@@ -0,0 +1,176 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/felipemacedo1/go-coregit-pe/pkg/core"
+)
+
+func TestReadOnlyProfile(t *testing.T) {
+	tests := []struct {
+		args    []string
+		allowed bool
+	}{
+		{[]string{"status", "--porcelain"}, true},
+		{[]string{"log", "--oneline", "-n", "5"}, true},
+		{[]string{"diff", "--stat", "HEAD~1"}, true},
+		{[]string{"diff", "/etc/passwd", "/dev/null"}, false},
+		{[]string{"diff", "--", "/etc/shadow", "/dev/null"}, false},
+		{[]string{"branch", "-a", "-v"}, true},
+		{[]string{"branch", "--list", "feature/*"}, true},
+		{[]string{"branch", "new"}, false},
+		{[]string{"branch", "-D", "main"}, false},
+		{[]string{"branch", "-vd", "main"}, false},
+		{[]string{"tag", "-l", "v1.*"}, true},
+		{[]string{"tag", "v2.0"}, false},
+		{[]string{"config", "--get", "user.name"}, true},
+		{[]string{"config", "get", "user.name"}, true},
+		{[]string{"config", "core.sshCommand", "touch /tmp/pwned"}, false},
+		{[]string{"config", "--file", "/etc/passwd", "--list"}, false},
+		{[]string{"remote", "-v"}, true},
+		{[]string{"remote", "get-url", "origin"}, true},
+		{[]string{"remote", "add", "x", "/tmp/x"}, false},
+		{[]string{"stash", "list"}, true},
+		{[]string{"stash"}, false},
+		{[]string{"checkout", "main"}, false},
+		{[]string{"filter-branch", "--all"}, false},
+		{[]string{"commit", "-m", "x"}, false},
+	}
+
+	profile, _ := Default().profile(ReadOnlyProfile)
+	for _, tt := range tests {
+		err := profile.Check(tt.args)
+		if tt.allowed && err != nil {
+			t.Errorf("Expected %q to be allowed, got %v", tt.args, err)
+		}
+		if !tt.allowed && !errors.Is(err, core.ErrPolicyDenied) {
+			t.Errorf("Expected %q to be denied, got %v", tt.args, err)
+		}
+	}
+}
+
+func TestForbiddenOptions(t *testing.T) {
+	profile := &Profile{Subcommands: []string{"*"}, ForbiddenOptions: []string{"--force"}}
+
+	tests := []struct {
+		args    []string
+		allowed bool
+	}{
+		{[]string{"-c", "core.fsmonitor=touch /tmp/pwned", "status"}, false},
+		{[]string{"-C", "/", "status"}, false},
+		{[]string{"fetch", "--upload-pack=touch /tmp/pwned", "origin"}, false},
+		{[]string{"fetch", "--upload-p=touch /tmp/pwned", "origin"}, false},
+		{[]string{"clone", "-qc", "core.sshCommand=x", "url", "dir"}, false},
+		{[]string{"clone", "--config=core.sshCommand=x", "url", "dir"}, false},
+		{[]string{"rebase", "--exec", "touch /tmp/pwned", "main"}, false},
+		{[]string{"log", "--output=/tmp/x"}, false},
+		{[]string{"grep", "-Ovi", "x"}, false},
+		{[]string{"diff", "--no-index", "/etc/passwd", "/dev/null"}, false},
+		{[]string{"diff", "/etc/passwd", "/dev/null"}, false},
+		{[]string{"diff", "--", "/etc/shadow", "/dev/null"}, false},
+		{[]string{"diff", "--stat", "../../etc/passwd", "file.txt"}, false},
+		{[]string{"diff", "sub/../../outside", "file.txt"}, false},
+		{[]string{"diff", "main..feature", "--", "pkg/a.go"}, true},
+		{[]string{"diff", "main...feature"}, true},
+		{[]string{"push", "--force", "origin"}, false},
+		{[]string{"push", "origin", "main"}, true},
+		{[]string{"log", "-n5", "--oneline"}, true},
+		{[]string{"log", "--", "-c"}, true},
+		{[]string{"commit", "-m", "fix -c handling"}, true},
+		{[]string{"blame", "--contents", "/etc/shadow", "--", "f"}, false},
+		{[]string{"blame", "--cont=/etc/shadow", "--", "f"}, false},
+		{[]string{"blame", "-wS", "/etc/shadow", "f"}, false},
+		{[]string{"blame", "--ignore-revs-file=/etc/shadow", "f"}, false},
+		{[]string{"ls-files", "--exclude-from=/etc/shadow", "-i", "-o"}, false},
+		{[]string{"ls-files", "-X", "/etc/shadow", "-i", "-o"}, false},
+		{[]string{"grep", "-f", "/etc/shadow"}, false},
+		{[]string{"grep", "--file=/etc/shadow"}, false},
+		{[]string{"log", "-S", "needle"}, true},
+		{[]string{"blame", "-w", "--", "f"}, true},
+		{[]string{"grep", "-n", "needle"}, true},
+	}
+
+	for _, tt := range tests {
+		err := profile.Check(tt.args)
+		if tt.allowed && err != nil {
+			t.Errorf("Expected %q to be allowed, got %v", tt.args, err)
+		}
+		if !tt.allowed && !errors.Is(err, core.ErrPolicyDenied) {
+			t.Errorf("Expected %q to be denied, got %v", tt.args, err)
+		}
+	}
+}
+
+func TestReadOnlyProfileFileOptions(t *testing.T) {
+	for _, args := range [][]string{
+		{"blame", "--contents", "/etc/shadow", "--", "f"},
+		{"blame", "-S", "/etc/shadow", "f"},
+		{"blame", "--ignore-revs-file", "/etc/shadow", "f"},
+		{"ls-files", "--exclude-from=/etc/shadow", "--ignored", "--others"},
+		{"grep", "-f", "/etc/shadow", "HEAD"},
+	} {
+		if _, err := Default().Check("", args); !errors.Is(err, core.ErrPolicyDenied) {
+			t.Errorf("Expected %q to be denied by the read-only profile, got %v", args, err)
+		}
+	}
+}
+
+func TestPolicyCallers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	content := `{
+		"profiles": {"maintenance": {"subcommands": ["gc", "fetch", "status"]}},
+		"callers": {"ci": {"token": "secret", "profile": "maintenance"}}
+	}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	caller, ok := p.Authenticate("secret")
+	if !ok || caller != "ci" {
+		t.Fatalf("Expected caller ci, got %q %v", caller, ok)
+	}
+	if _, ok := p.Authenticate("wrong"); ok {
+		t.Error("Expected unknown token to be rejected")
+	}
+
+	if profile, err := p.Check("ci", []string{"gc", "--auto"}); err != nil || profile != "maintenance" {
+		t.Errorf("Expected gc to be allowed for ci, got %s %v", profile, err)
+	}
+	if _, err := p.Check("ci", []string{"log"}); err == nil {
+		t.Error("Expected log to be denied for ci")
+	}
+	if profile, err := p.Check("", []string{"gc"}); err == nil || profile != ReadOnlyProfile {
+		t.Errorf("Expected gc to be denied by %s, got %s %v", ReadOnlyProfile, profile, err)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+	}{
+		{"unknown default", &Policy{Default: "missing"}},
+		{"unknown caller profile", &Policy{Default: ReadOnlyProfile, Callers: map[string]*Caller{"a": {Token: "t", Profile: "missing"}}}},
+		{"missing token", &Policy{Default: ReadOnlyProfile, Callers: map[string]*Caller{"a": {Profile: ReadOnlyProfile}}}},
+		{"shared token", &Policy{Default: ReadOnlyProfile, Callers: map[string]*Caller{
+			"a": {Token: "t", Profile: ReadOnlyProfile},
+			"b": {Token: "t", Profile: ReadOnlyProfile},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package policy
+
+import "strings"
+
+// readOnlySubcommands never modify a repository
+var readOnlySubcommands = map[string]bool{
+	"blame":            true,
+	"cat-file":         true,
+	"check-attr":       true,
+	"check-ignore":     true,
+	"check-ref-format": true,
+	"cherry":           true,
+	"count-objects":    true,
+	"describe":         true,
+	"diff":             true,
+	"diff-files":       true,
+	"diff-index":       true,
+	"diff-tree":        true,
+	"for-each-ref":     true,
+	"grep":             true,
+	"log":              true,
+	"ls-files":         true,
+	"ls-tree":          true,
+	"merge-base":       true,
+	"name-rev":         true,
+	"rev-list":         true,
+	"rev-parse":        true,
+	"shortlog":         true,
+	"show":             true,
+	"show-branch":      true,
+	"show-ref":         true,
+	"status":           true,
+	"verify-commit":    true,
+	"verify-tag":       true,
+	"version":          true,
+	"whatchanged":      true,
+}
+
+// readOnlyForms decide whether subcommands that can both read and write
+// are used in a read-only form
+var readOnlyForms = map[string]func(args []string) bool{
+	// Listing only: no operands unless --list is given, no modifying options
+	"branch": listing([]string{"--list", "-l"}, []string{
+		"-d", "-D", "--delete", "-m", "-M", "--move", "-c", "-C", "--copy",
+		"-f", "--force", "-u", "--set-upstream-to", "--unset-upstream",
+		"-t", "--track", "--edit-description", "--create-reflog",
+	}),
+	"tag": listing([]string{"--list", "-l"}, []string{
+		"-a", "--annotate", "-s", "--sign", "-u", "--local-user", "-f", "--force",
+		"-d", "--delete", "-m", "--message", "-F", "--file", "-e", "--edit",
+	}),
+	// Reads of the repository's configuration; --file could read any file
+	"config": func(args []string) bool {
+		if hasOption(args, "--file", "-f", "--blob", "--edit", "-e") {
+			return false
+		}
+		if operands := positional(args); len(operands) > 0 && (operands[0] == "get" || operands[0] == "list") {
+			return true
+		}
+		return hasOption(args, "--get", "--get-all", "--get-regexp", "--get-urlmatch", "--list", "-l") &&
+			!hasOption(args, "--add", "--unset", "--unset-all", "--replace-all",
+				"--rename-section", "--remove-section")
+	},
+	"remote":   subcommands("", "show", "get-url"),
+	"stash":    subcommands("list", "show"),
+	"worktree": subcommands("list"),
+	"notes":    subcommands("list", "show"),
+	"reflog":   subcommands("", "show"),
+	"symbolic-ref": func(args []string) bool {
+		return len(positional(args)) <= 1 && !hasOption(args, "-d", "--delete")
+	},
+}
+
+// IsReadOnly reports whether running git with args, which start with the
+// subcommand, leaves the repository unchanged
+func IsReadOnly(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	return readOnly(args[0], args[1:])
+}
+
+// readOnly reports whether running subcommand with args leaves the repository unchanged
+func readOnly(subcommand string, args []string) bool {
+	if readOnlySubcommands[subcommand] {
+		return true
+	}
+	if form, ok := readOnlyForms[subcommand]; ok {
+		return form(args)
+	}
+	return false
+}
+
+// listing accepts invocations without modifying options that either have no
+// operands or pass one of listFlags
+func listing(listFlags, modifying []string) func(args []string) bool {
+	return func(args []string) bool {
+		if hasOption(args, modifying...) {
+			return false
+		}
+		return len(positional(args)) == 0 || hasOption(args, listFlags...)
+	}
+}
+
+// subcommands accepts invocations whose first operand is one of names;
+// "" accepts invocations without operands
+func subcommands(names ...string) func(args []string) bool {
+	return func(args []string) bool {
+		first := ""
+		if operands := positional(args); len(operands) > 0 {
+			first = operands[0]
+		}
+		for _, name := range names {
+			if first == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// positional returns the arguments that are not options
+func positional(args []string) []string {
+	var operands []string
+	for i, arg := range args {
+		if arg == "--" {
+			return append(operands, args[i+1:]...)
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			operands = append(operands, arg)
+		}
+	}
+	return operands
+}
+
+// hasOption reports whether any of opts is set in args
+func hasOption(args []string, opts ...string) bool {
+	for _, arg := range options(args) {
+		for _, opt := range opts {
+			if matchOption(arg, opt) {
+				return true
+			}
+		}
+	}
+	return false
+}